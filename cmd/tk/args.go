@@ -46,3 +46,10 @@ var workflowArgs = cli.Args{
 		return complete.PredictFiles("*").Predict(args)
 	}),
 }
+
+// multiWorkflowArgs are like workflowArgs, but accept multiple paths
+func multiWorkflowArgs() cli.Args {
+	args := workflowArgs
+	args.Validator = cli.ValidateMin(1)
+	return args
+}
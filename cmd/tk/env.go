@@ -232,6 +232,7 @@ func envListCmd() *cli.Command {
 	getLabelSelector := labelSelectorFlag(cmd.Flags())
 
 	useNames := cmd.Flags().Bool("names", false, "plain names output")
+	getNixOpts := nixFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		var path string
@@ -245,7 +246,7 @@ func envListCmd() *cli.Command {
 			}
 		}
 
-		envs, err := tanka.FindEnvs(path, tanka.FindOpts{Selector: getLabelSelector()})
+		envs, err := getBackend().FindEnvs(path, tanka.FindOpts{Nix: getNixOpts(), Selector: getLabelSelector()})
 		if err != nil {
 			return err
 		}
@@ -37,8 +37,9 @@ func exportCmd() *cli.Command {
 	extension := cmd.Flags().String("extension", "yaml", "File extension")
 	merge := cmd.Flags().Bool("merge", false, "Allow merging with existing directory")
 	parallel := cmd.Flags().IntP("parallel", "p", 8, "Number of environments to process in parallel")
-	cachePath := cmd.Flags().StringP("cache-path", "c", "", "Local file path where cached evaluations should be stored")
+	cachePath := cmd.Flags().StringP("cache-path", "c", "", "Local directory or http(s):// URL where cached evaluations should be stored")
 	cacheEnvs := cmd.Flags().StringArrayP("cache-envs", "e", nil, "Regexes which define which environment should be cached (if caching is enabled)")
+	cacheMaxSize := cmd.Flags().String("cache-max-size", "1Gi", "Size the cache is limited to. Least recently used evaluations are removed first. 0 disables the limit")
 
 	ballastBytes := cmd.Flags().Int("mem-ballast-size-bytes", 0, "(Experimental) Size of memory ballast to allocate.")
 	if err := cmd.Flags().MarkHidden("mem-ballast-size-bytes"); err != nil {
@@ -47,6 +48,7 @@ func exportCmd() *cli.Command {
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
 	getLabelSelector := labelSelectorFlag(cmd.Flags())
 
 	recursive := cmd.Flags().BoolP("recursive", "r", false, "Look recursively for Tanka environments")
@@ -67,6 +69,7 @@ func exportCmd() *cli.Command {
 			Merge:     *merge,
 			Opts: tanka.Opts{
 				JsonnetOpts: getJsonnetOpts(),
+				Nix:         getNixOpts(),
 				Filters:     filters,
 				Name:        vars.name,
 			},
@@ -74,6 +77,14 @@ func exportCmd() *cli.Command {
 			Parallelism: *parallel,
 		}
 		opts.Opts.CachePath = *cachePath
+		maxSize, err := parseSize(*cacheMaxSize)
+		if err != nil {
+			return fmt.Errorf("parsing --cache-max-size: %w", err)
+		}
+		opts.Opts.CacheMaxSize = maxSize
+		if maxSize == 0 {
+			opts.Opts.CacheMaxSize = -1
+		}
 		for _, expr := range *cacheEnvs {
 			regex, err := regexp.Compile(expr)
 			if err != nil {
@@ -82,12 +93,13 @@ func exportCmd() *cli.Command {
 			opts.Opts.CachePathRegexes = append(opts.Opts.CachePathRegexes, regex)
 		}
 
+		b := getBackend()
 		var exportEnvs []*v1alpha1.Environment
 		for _, path := range args[1:] {
 			// find possible environments
 			if *recursive {
 				// get absolute path to Environment
-				envs, err := tanka.FindEnvs(path, tanka.FindOpts{Selector: opts.Selector})
+				envs, err := b.FindEnvs(path, tanka.FindOpts{Nix: opts.Opts.Nix, Selector: opts.Selector})
 				if err != nil {
 					return err
 				}
@@ -102,7 +114,7 @@ func exportCmd() *cli.Command {
 			}
 
 			// validate environment
-			env, err := tanka.Peek(path, opts.Opts)
+			env, err := b.Peek(path, opts.Opts)
 			if err != nil {
 				switch err.(type) {
 				case tanka.ErrMultipleEnvs:
@@ -117,7 +129,7 @@ func exportCmd() *cli.Command {
 		}
 
 		// export them
-		return tanka.ExportEnvironments(exportEnvs, args[0], &opts)
+		return b.Export(exportEnvs, args[0], &opts, vars.targets)
 	}
 	return cmd
 }
@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/labels"
 
+	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 	"github.com/grafana/tanka/pkg/tanka"
 )
@@ -52,6 +54,83 @@ func jsonnetFlags(fs *pflag.FlagSet) func() tanka.JsonnetOpts {
 	}
 }
 
+func nixFlags(fs *pflag.FlagSet) func() tanka.NixOpts {
+	binary := fs.String("nix-binary", "", "Nix binary to evaluate flakes with (default \"nix\")")
+	attribute := fs.String("nix-attribute", "", "attribute of the flake holding the environment (default \"kube.tanka\")")
+	options := fs.StringArray("nix-option", nil, "set a Nix option (Format: name=value)")
+	impure := fs.Bool("nix-impure", false, "allow impure Nix evaluation. Overrides spec.nix.impure if set, including to false")
+	overrides := fs.StringArray("nix-override-input", nil, "override a flake input (Format: input=path)")
+	cachePath := fs.String("nix-cache-path", "", "local directory or http(s):// URL where Nix evaluations should be cached")
+
+	parse := func(flag string, values []string) map[string]string {
+		if len(values) == 0 {
+			return nil
+		}
+		m := make(map[string]string)
+		for _, s := range values {
+			split := strings.SplitN(s, "=", 2)
+			if len(split) != 2 {
+				log.Fatalf("--%s argument has wrong format: `%s`. Expected `key=value`", flag, s)
+			}
+			m[split[0]] = split[1]
+		}
+		return m
+	}
+
+	return func() tanka.NixOpts {
+		opts := tanka.NixOpts{
+			Binary:         *binary,
+			Attribute:      *attribute,
+			Options:        parse("nix-option", *options),
+			FlakeOverrides: parse("nix-override-input", *overrides),
+			CachePath:      *cachePath,
+		}
+		// only if set, so that --nix-impure=false overrides spec.nix.impure
+		if fs.Changed("nix-impure") {
+			opts.Impure = impure
+		}
+		return opts
+	}
+}
+
+type profileFlagVars struct {
+	enabled bool
+	output  string
+	top     int
+}
+
+func profileFlags(fs *pflag.FlagSet) *profileFlagVars {
+	v := profileFlagVars{}
+	fs.BoolVar(&v.enabled, "profile", false, "report the time spent evaluating, reading imported files and calling native functions")
+	fs.StringVar(&v.output, "profile-output", "tanka-profile.json", "file to write the profile to, in the Chrome trace event format")
+	fs.IntVar(&v.top, "profile-top", 20, "number of entries of the profile to print. 0 prints all")
+	return &v
+}
+
+// backend returns the backend to evaluate opts with. When profiling, opts are
+// set up to record a profile, which is reported using the returned function.
+func (v *profileFlagVars) backend(opts *tanka.Opts) (backend, func() error) {
+	if !v.enabled {
+		return getBackend(), func() error { return nil }
+	}
+
+	// `tk serve` evaluates in another process, so it can't be profiled
+	profile := jsonnet.NewProfile()
+	opts.Profile = profile
+
+	return localBackend{}, func() error {
+		fmt.Fprintln(os.Stderr)
+		if err := profile.WriteTable(os.Stderr, v.top); err != nil {
+			return err
+		}
+		if err := profile.WriteTraceFile(v.output); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "\nWrote trace to %s. Open it using chrome://tracing or https://ui.perfetto.dev\n", v.output)
+		return nil
+	}
+}
+
 func cliCodeParser(fs *pflag.FlagSet) (func() map[string]string, func() map[string]string) {
 	// need to use StringArray instead of StringSlice, because pflag attempts to
 	// parse StringSlice using the csv parser, which breaks when passing objects
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 
 	"github.com/go-clix/cli"
 
@@ -19,17 +20,24 @@ func evalCmd() *cli.Command {
 	evalPattern := cmd.Flags().StringP("eval", "e", "", "Evaluate expression on output of jsonnet")
 
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
+	profile := profileFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		jsonnetOpts := tanka.Opts{
 			JsonnetOpts: getJsonnetOpts(),
+			Nix:         getNixOpts(),
 		}
 		if *evalPattern != "" {
 			jsonnetOpts.EvalScript = fmt.Sprintf(tanka.PatternEvalScript, *evalPattern)
 		}
-		raw, err := tanka.Eval(args[0], jsonnetOpts)
+		b, report := profile.backend(&jsonnetOpts)
+		raw, err := b.Eval(args[0], jsonnetOpts)
 
 		if raw == nil && err != nil {
+			if rerr := report(); rerr != nil {
+				log.Println("Reporting profile:", rerr)
+			}
 			return err
 		}
 
@@ -42,7 +50,7 @@ func evalCmd() *cli.Command {
 			return err
 		}
 
-		return nil
+		return report()
 	}
 
 	return cmd
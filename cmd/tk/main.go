@@ -31,6 +31,7 @@ func main() {
 		applyCmd(),
 		showCmd(),
 		diffCmd(),
+		planCmd(),
 		pruneCmd(),
 		deleteCmd(),
 	)
@@ -39,6 +40,7 @@ func main() {
 		envCmd(),
 		statusCmd(),
 		exportCmd(),
+		serveCmd(),
 	)
 
 	// jsonnet commands
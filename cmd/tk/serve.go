@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-clix/cli"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/server"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+func serveCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "serve",
+		Short: "keep evaluation state in memory, to speed up other tk commands",
+		Args:  cli.ArgsNone(),
+	}
+
+	socket := cmd.Flags().String("socket", server.DefaultSocket(), "unix socket to listen on")
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		s, err := server.New()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		l, err := server.Listen(*socket)
+		if err != nil {
+			return err
+		}
+
+		// remove the socket on exit
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			l.Close()
+		}()
+
+		log.Printf("Listening on %s", *socket)
+		return s.Serve(l)
+	}
+
+	return cmd
+}
+
+// backend runs the evaluating parts of commands, either in-process or using a
+// running `tk serve`
+type backend interface {
+	Eval(path string, opts tanka.Opts) (interface{}, error)
+	Show(path string, opts tanka.Opts, targets []string) (manifest.List, error)
+	Peek(path string, opts tanka.Opts) (*v1alpha1.Environment, error)
+	FindEnvs(path string, opts tanka.FindOpts) ([]*v1alpha1.Environment, error)
+	Export(envs []*v1alpha1.Environment, to string, opts *tanka.ExportEnvOpts, targets []string) error
+	Imports(dir string) ([]string, error)
+}
+
+// getBackend returns a backend using `tk serve` if it is running with the same
+// version and environment, unless disabled using $TANKA_SERVER=off
+func getBackend() backend {
+	switch os.Getenv("TANKA_SERVER") {
+	case "off", "false", "0":
+		return localBackend{}
+	}
+
+	c, err := server.Dial(server.DefaultSocket())
+	if err != nil {
+		switch err.(type) {
+		case server.ErrVersionMismatch, server.ErrEnvMismatch:
+			log.Println("Not using tk serve:", err)
+		}
+		return localBackend{}
+	}
+	return remoteBackend{c}
+}
+
+// localBackend evaluates in-process
+type localBackend struct{}
+
+func (localBackend) Eval(path string, opts tanka.Opts) (interface{}, error) {
+	return tanka.Eval(path, opts)
+}
+
+func (localBackend) Show(path string, opts tanka.Opts, _ []string) (manifest.List, error) {
+	return tanka.Show(path, opts)
+}
+
+func (localBackend) Peek(path string, opts tanka.Opts) (*v1alpha1.Environment, error) {
+	return tanka.Peek(path, opts)
+}
+
+func (localBackend) FindEnvs(path string, opts tanka.FindOpts) ([]*v1alpha1.Environment, error) {
+	return tanka.FindEnvs(path, opts)
+}
+
+func (localBackend) Export(envs []*v1alpha1.Environment, to string, opts *tanka.ExportEnvOpts, _ []string) error {
+	return tanka.ExportEnvironments(envs, to, opts)
+}
+
+func (localBackend) Imports(dir string) ([]string, error) {
+	return jsonnet.TransitiveImports(dir)
+}
+
+// remoteBackend uses a running `tk serve`
+type remoteBackend struct {
+	c *server.Client
+}
+
+func (r remoteBackend) Eval(path string, opts tanka.Opts) (interface{}, error) {
+	return r.c.Eval(path, server.NewOpts(opts, nil))
+}
+
+func (r remoteBackend) Show(path string, opts tanka.Opts, targets []string) (manifest.List, error) {
+	return r.c.Show(path, server.NewOpts(opts, targets))
+}
+
+func (r remoteBackend) Peek(path string, opts tanka.Opts) (*v1alpha1.Environment, error) {
+	return r.c.Peek(path, server.NewOpts(opts, nil))
+}
+
+func (r remoteBackend) FindEnvs(path string, opts tanka.FindOpts) ([]*v1alpha1.Environment, error) {
+	o := server.NewOpts(tanka.Opts{JsonnetOpts: opts.JsonnetOpts, Nix: opts.Nix}, nil)
+	return r.c.FindEnvs(path, o, selectorString(opts.Selector))
+}
+
+func (r remoteBackend) Export(envs []*v1alpha1.Environment, to string, opts *tanka.ExportEnvOpts, targets []string) error {
+	return r.c.Export(envs, server.ExportOpts{
+		To:          to,
+		Format:      opts.Format,
+		Extension:   opts.Extension,
+		Merge:       opts.Merge,
+		Parallelism: opts.Parallelism,
+	}, server.NewOpts(opts.Opts, targets), selectorString(opts.Selector))
+}
+
+func (r remoteBackend) Imports(dir string) ([]string, error) {
+	return r.c.Imports(dir)
+}
+
+func selectorString(s labels.Selector) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
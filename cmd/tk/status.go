@@ -22,10 +22,12 @@ func statusCmd() *cli.Command {
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		status, err := tanka.Status(args[0], tanka.Opts{
 			JsonnetOpts: getJsonnetOpts(),
+			Nix:         getNixOpts(),
 			Name:        vars.name,
 		})
 		if err != nil {
@@ -12,7 +12,6 @@ import (
 
 	"github.com/go-clix/cli"
 
-	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/jsonnet/jpath"
 )
 
@@ -25,6 +24,7 @@ func toolCmd() *cli.Command {
 		jpathCmd(),
 		importsCmd(),
 		chartsCmd(),
+		cacheCmd(),
 	)
 	return cmd
 }
@@ -92,7 +92,7 @@ func importsCmd() *cli.Command {
 			return fmt.Errorf("Loading environment: %s", err)
 		}
 
-		deps, err := jsonnet.TransitiveImports(path)
+		deps, err := getBackend().Imports(path)
 		if err != nil {
 			return fmt.Errorf("Resolving imports: %s", err)
 		}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-clix/cli"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+)
+
+func cacheCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "cache",
+		Short: "Manage the evaluation cache (see tk export --cache-path)",
+	}
+
+	cmd.AddCommand(
+		cacheStatsCmd(),
+		cachePruneCmd(),
+		cacheClearCmd(),
+	)
+
+	return cmd
+}
+
+func cacheStatsCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "stats <cache-path>",
+		Short: "Show the number and size of cached evaluations",
+		Args:  cli.ArgsExact(1),
+	}
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		c, err := localCache(args[0])
+		if err != nil {
+			return err
+		}
+		usage, err := c.Usage()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Entries:\t%d\n", usage.Entries)
+		fmt.Fprintf(w, "Size:\t%s\n", formatSize(usage.Size))
+		if usage.Entries > 0 {
+			fmt.Fprintf(w, "Least recently used:\t%s\n", usage.Oldest.Format(time.RFC3339))
+			fmt.Fprintf(w, "Most recently used:\t%s\n", usage.Newest.Format(time.RFC3339))
+		}
+		return w.Flush()
+	}
+
+	return cmd
+}
+
+func cachePruneCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "prune <cache-path>",
+		Short: "Remove the least recently used evaluations from the cache",
+		Args:  cli.ArgsExact(1),
+	}
+
+	maxSize := cmd.Flags().String("max-size", "1Gi", "remove the least recently used evaluations until the cache is at most this large. 0 disables")
+	maxAge := cmd.Flags().Duration("max-age", 0, "remove evaluations not used for this long, e.g. 720h. 0 disables")
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		size, err := parseSize(*maxSize)
+		if err != nil {
+			return fmt.Errorf("parsing --max-size: %w", err)
+		}
+
+		c, err := localCache(args[0])
+		if err != nil {
+			return err
+		}
+		removed, err := c.Prune(size, *maxAge)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %d evaluations (%s)\n", removed.Entries, formatSize(removed.Size))
+		return nil
+	}
+
+	return cmd
+}
+
+func cacheClearCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "clear <cache-path>",
+		Short: "Remove all evaluations from the cache",
+		Args:  cli.ArgsExact(1),
+	}
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		c, err := localCache(args[0])
+		if err != nil {
+			return err
+		}
+		removed, err := c.Clear()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %d evaluations (%s)\n", removed.Entries, formatSize(removed.Size))
+		return nil
+	}
+
+	return cmd
+}
+
+// localCache returns the cache at path, which must be a local directory. Remote
+// caches are managed by their server.
+func localCache(path string) (*jsonnet.FileEvalCache, error) {
+	c, ok := jsonnet.NewEvalCache(path).(*jsonnet.FileEvalCache)
+	if !ok {
+		return nil, fmt.Errorf("only local caches can be managed, '%s' is a remote cache", path)
+	}
+	return c, nil
+}
+
+// parseSize parses a size in bytes, in the Kubernetes quantity format (e.g.
+// 512Mi or 1G)
+func parseSize(s string) (int64, error) {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
+
+// formatSize formats bytes using binary units
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
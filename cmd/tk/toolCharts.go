@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 
 	"github.com/go-clix/cli"
 	"github.com/grafana/tanka/pkg/helm"
@@ -22,6 +23,8 @@ func chartsCmd() *cli.Command {
 		chartsAddCmd(),
 		chartsAddRepoCmd(),
 		chartsVendorCmd(),
+		chartsOutdatedCmd(),
+		chartsUpdateCmd(),
 		chartsConfigCmd(),
 	)
 
@@ -34,13 +37,75 @@ func chartsVendorCmd() *cli.Command {
 		Short: "Download Charts to a local folder",
 	}
 
+	frozen := cmd.Flags().Bool("frozen", false, "only verify the vendored Charts against chartfile.lock, failing instead of downloading")
+
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		c, err := loadChartfile()
 		if err != nil {
 			return err
 		}
 
-		return c.Vendor()
+		return c.Vendor(helm.VendorOpts{Frozen: *frozen})
+	}
+
+	return cmd
+}
+
+func chartsOutdatedCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "outdated [chart] [...]",
+		Short: "Lists the latest versions of the required Charts",
+	}
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		c, err := loadChartfile()
+		if err != nil {
+			return err
+		}
+
+		versions, err := c.Versions(args...)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+		f := "%s\t%s\t%s\t%s\t%s\t\n"
+		fmt.Fprintf(w, f, "CHART", "CURRENT", "PATCH", "MINOR", "MAJOR")
+		for _, v := range versions {
+			fmt.Fprintf(w, f, v.Chart, v.Current.String(), v.Patch.String(), v.Minor.String(), v.Major.String())
+		}
+		return w.Flush()
+	}
+
+	return cmd
+}
+
+func chartsUpdateCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "update [chart] [...]",
+		Short: "Updates Charts to their latest version and vendors them",
+	}
+
+	minor := cmd.Flags().Bool("minor", false, "only update to the latest version of the same major version")
+	patch := cmd.Flags().Bool("patch", false, "only update to the latest version of the same minor version")
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		level := helm.LevelMajor
+		switch {
+		case *minor && *patch:
+			return fmt.Errorf("--minor can't be combined with --patch")
+		case *minor:
+			level = helm.LevelMinor
+		case *patch:
+			level = helm.LevelPatch
+		}
+
+		c, err := loadChartfile()
+		if err != nil {
+			return err
+		}
+
+		return c.Update(level, args...)
 	}
 
 	return cmd
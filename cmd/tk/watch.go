@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/tanka"
+	"github.com/grafana/tanka/pkg/term"
+)
+
+// watchShow prints the objects of the environment at path, and then those that
+// changed whenever its files change
+func watchShow(path string, opts tanka.Opts) error {
+	first := true
+	return tanka.Watch(path, opts, tanka.WatchOpts{}, func(c tanka.WatchChange) {
+		watchHeader()
+		if c.Err != nil {
+			log.Println(color.RedString("Error:"), c.Err)
+			return
+		}
+
+		if !first {
+			printRemoved(c.Removed)
+		}
+		first = false
+
+		if len(c.Changed) > 0 {
+			fmt.Print(c.Changed.String())
+		}
+	})
+}
+
+// watchDiff diffs the environment at path against the cluster, and then the
+// objects that changed whenever its files change
+func watchDiff(path string, opts tanka.DiffOpts) error {
+	return tanka.Watch(path, opts.Opts, tanka.WatchOpts{}, func(c tanka.WatchChange) {
+		watchHeader()
+		if c.Err != nil {
+			log.Println(color.RedString("Error:"), c.Err)
+			return
+		}
+
+		printRemoved(c.Removed)
+
+		changes, err := tanka.DiffChange(c, opts)
+		if err != nil {
+			log.Println(color.RedString("Error:"), err)
+			return
+		}
+		if changes == nil {
+			log.Println("No differences.")
+			return
+		}
+		fmt.Print(term.Colordiff(*changes).String())
+	})
+}
+
+func watchHeader() {
+	log.Println(color.New(color.Bold).Sprintf("--- %s", time.Now().Format("15:04:05")))
+}
+
+func printRemoved(removed manifest.List) {
+	for _, m := range removed {
+		log.Printf("%s was removed from the environment", m.KindName())
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/go-clix/cli"
 	"github.com/posener/complete"
+	"k8s.io/apimachinery/pkg/labels"
 
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
 	"github.com/grafana/tanka/pkg/process"
 	"github.com/grafana/tanka/pkg/tanka"
 	"github.com/grafana/tanka/pkg/term"
@@ -31,15 +39,28 @@ func validateDryRun(dryRunStr string) error {
 
 func applyCmd() *cli.Command {
 	cmd := &cli.Command{
-		Use:   "apply <path>",
+		Use:   "apply <path> [<path>...]",
 		Short: "apply the configuration to the cluster",
-		Args:  workflowArgs,
 		Predictors: complete.Flags{
-			"diff-strategy":  cli.PredictSet("native", "subset", "validate", "server", "none"),
+			"diff-strategy":  cli.PredictSet("native", "subset", "validate", "server", "semantic", "none"),
 			"apply-strategy": cli.PredictSet("client", "server"),
+			"plan":           complete.PredictFiles("*.tkplan"),
 		},
 	}
 
+	planFile := cmd.Flags().String("plan", "", "apply a plan created by 'tk plan' instead of evaluating the environment at <path>")
+	args := multiWorkflowArgs()
+	args.Validator = cli.ValidateFunc(func(args []string) error {
+		if *planFile != "" {
+			if len(args) != 0 {
+				return fmt.Errorf("--plan can't be combined with <path>")
+			}
+			return nil
+		}
+		return cli.ValidateMin(1)(args)
+	})
+	cmd.Args = args
+
 	var opts tanka.ApplyOpts
 	cmd.Flags().BoolVar(&opts.Force, "force", false, "force applying (kubectl apply --force)")
 	cmd.Flags().BoolVar(&opts.Validate, "validate", true, "validation of resources (kubectl --validate=false)")
@@ -47,9 +68,15 @@ func applyCmd() *cli.Command {
 	cmd.Flags().StringVar(&opts.DryRun, "dry-run", "", `--dry-run parameter to pass down to kubectl, must be "none", "server", or "client"`)
 	cmd.Flags().StringVar(&opts.ApplyStrategy, "apply-strategy", "", "force the apply strategy to use. Automatically chosen if not set.")
 	cmd.Flags().StringVar(&opts.DiffStrategy, "diff-strategy", "", "force the diff strategy to use. Automatically chosen if not set.")
+	cmd.Flags().BoolVar(&opts.Wait, "wait", false, "wait for Deployments, StatefulSets, DaemonSets and Jobs to become ready after applying")
+	cmd.Flags().DurationVar(&opts.WaitTimeout, "wait-timeout", 5*time.Minute, "maximum time to wait for with --wait")
+	cmd.Flags().BoolVar(&opts.Atomic, "atomic", false, "roll back all changes if applying or waiting fails. Implies --wait")
+	cmd.Flags().IntVar(&opts.Parallelism, "parallel", 8, "number of environments to evaluate in parallel")
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
+	getLabelSelector := labelSelectorFlag(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		err := validateDryRun(opts.DryRun)
@@ -63,8 +90,28 @@ func applyCmd() *cli.Command {
 		}
 		opts.Filters = filters
 		opts.JsonnetOpts = getJsonnetOpts()
+		opts.Nix = getNixOpts()
 		opts.Name = vars.name
 
+		if *planFile != "" {
+			if len(vars.targets) > 0 || vars.name != "" || getLabelSelector() != nil {
+				return fmt.Errorf("--plan can't be combined with --target, --name or --selector, as the plan defines what is applied")
+			}
+			plan, err := tanka.LoadPlan(*planFile)
+			if err != nil {
+				return err
+			}
+			return tanka.ApplyPlan(plan, opts)
+		}
+
+		if selector := getLabelSelector(); len(args) > 1 || selector != nil {
+			envs, err := tanka.FindTargets(args, tanka.TargetOpts{Opts: opts.Opts, Selector: selector})
+			if err != nil {
+				return err
+			}
+			return tanka.ApplyEnvironments(envs, opts)
+		}
+
 		return tanka.Apply(args[0], opts)
 	}
 	return cmd
@@ -83,6 +130,7 @@ func pruneCmd() *cli.Command {
 	cmd.Flags().BoolVar(&opts.AutoApprove, "dangerous-auto-approve", false, "skip interactive approval. Only for automation!")
 	cmd.Flags().StringVar(&opts.Name, "name", "", "string that only a single inline environment contains in its name")
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		err := validateDryRun(opts.DryRun)
@@ -91,6 +139,7 @@ func pruneCmd() *cli.Command {
 		}
 
 		opts.JsonnetOpts = getJsonnetOpts()
+		opts.Nix = getNixOpts()
 
 		return tanka.Prune(args[0], opts)
 	}
@@ -113,6 +162,7 @@ func deleteCmd() *cli.Command {
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		err := validateDryRun(opts.DryRun)
@@ -126,6 +176,7 @@ func deleteCmd() *cli.Command {
 		}
 		opts.Filters = filters
 		opts.JsonnetOpts = getJsonnetOpts()
+		opts.Nix = getNixOpts()
 		opts.Name = vars.name
 
 		return tanka.Delete(args[0], opts)
@@ -135,11 +186,12 @@ func deleteCmd() *cli.Command {
 
 func diffCmd() *cli.Command {
 	cmd := &cli.Command{
-		Use:   "diff <path>",
+		Use:   "diff <path> [<path>...]",
 		Short: "differences between the configuration and the cluster",
-		Args:  workflowArgs,
+		Args:  multiWorkflowArgs(),
 		Predictors: complete.Flags{
-			"diff-strategy": cli.PredictSet("native", "subset", "validate", "server"),
+			"diff-strategy": cli.PredictSet("native", "subset", "validate", "server", "semantic"),
+			"output":        cli.PredictSet("text", "json"),
 		},
 	}
 
@@ -148,9 +200,15 @@ func diffCmd() *cli.Command {
 	cmd.Flags().BoolVarP(&opts.Summarize, "summarize", "s", false, "print summary of the differences, not the actual contents")
 	cmd.Flags().BoolVarP(&opts.WithPrune, "with-prune", "p", false, "include objects deleted from the configuration in the differences")
 	cmd.Flags().BoolVarP(&opts.ExitZero, "exit-zero", "z", false, "Exit with 0 even when differences are found.")
+	cmd.Flags().IntVar(&opts.Context, "context", util.DefaultDiffContext, "number of unchanged lines to show around each change. Not supported by the native and validate diff strategies of kubectl")
+	cmd.Flags().IntVar(&opts.Parallelism, "parallel", 8, "number of environments to process in parallel")
+	output := cmd.Flags().String("output", "text", "output format. One of: text, json")
+	watch := cmd.Flags().Bool("watch", false, "diff again whenever files of the environment change, showing only objects that changed")
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
+	getLabelSelector := labelSelectorFlag(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		filters, err := process.StrExps(vars.targets...)
@@ -159,8 +217,47 @@ func diffCmd() *cli.Command {
 		}
 		opts.Filters = filters
 		opts.JsonnetOpts = getJsonnetOpts()
+		opts.Nix = getNixOpts()
 		opts.Name = vars.name
 
+		// the library treats 0 as the default
+		if opts.Context == 0 {
+			opts.Context = util.NoDiffContext
+		}
+
+		exitStatusDiff := ExitStatusDiff
+		if opts.ExitZero {
+			exitStatusDiff = ExitStatusClean
+		}
+
+		selector := getLabelSelector()
+		multi := len(args) > 1 || selector != nil
+
+		if *watch {
+			if multi || *output != "text" {
+				return fmt.Errorf("--watch is only supported for a single environment and text output")
+			}
+			return watchDiff(args[0], opts)
+		}
+
+		switch *output {
+		case "text":
+		case "json":
+			if opts.Summarize {
+				return fmt.Errorf("--summarize can't be combined with --output=json")
+			}
+			if multi {
+				return fmt.Errorf("--output=json is only supported for a single environment")
+			}
+			return diffJSON(args[0], opts, exitStatusDiff)
+		default:
+			return fmt.Errorf("unknown output format `%s`. Pick one of: [text, json]", *output)
+		}
+
+		if multi {
+			return diffEnvironments(args, selector, opts, exitStatusDiff)
+		}
+
 		changes, err := tanka.Diff(args[0], opts)
 		if err != nil {
 			return err
@@ -176,10 +273,6 @@ func diffCmd() *cli.Command {
 			return err
 		}
 
-		exitStatusDiff := ExitStatusDiff
-		if opts.ExitZero {
-			exitStatusDiff = ExitStatusClean
-		}
 		os.Exit(exitStatusDiff)
 		return nil
 	}
@@ -187,6 +280,148 @@ func diffCmd() *cli.Command {
 	return cmd
 }
 
+func planCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "plan <path>",
+		Short: "save the differences to the cluster as a plan, to apply exactly those later",
+		Args:  workflowArgs,
+		Predictors: complete.Flags{
+			"diff-strategy": cli.PredictSet("native", "subset", "validate", "server", "semantic"),
+		},
+	}
+
+	var opts tanka.PlanOpts
+	cmd.Flags().StringVar(&opts.DiffStrategy, "diff-strategy", "", "force the diff-strategy to use. Automatically chosen if not set.")
+	output := cmd.Flags().StringP("output", "o", "", "file to write the plan to, e.g. 'plan.tkplan'")
+
+	vars := workflowFlags(cmd.Flags())
+	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
+
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if *output == "" {
+			return fmt.Errorf("--output is required")
+		}
+
+		filters, err := process.StrExps(vars.targets...)
+		if err != nil {
+			return err
+		}
+		opts.Filters = filters
+		opts.JsonnetOpts = getJsonnetOpts()
+		opts.Nix = getNixOpts()
+		opts.Name = vars.name
+
+		plan, err := tanka.MakePlan(args[0], opts)
+		if err != nil {
+			return err
+		}
+
+		if plan.Diff == nil {
+			fmt.Println("No differences.")
+		} else {
+			fmt.Print(term.Colordiff(*plan.Diff).String())
+		}
+
+		if err := plan.Save(*output); err != nil {
+			return err
+		}
+		fmt.Printf("Plan saved to '%s'. Apply it using: tk apply --plan %s\n", *output, *output)
+		return nil
+	}
+
+	return cmd
+}
+
+// diffEnvironments diffs all environments at paths and prints the results
+// grouped by environment, followed by a summary. Exits with exitStatusDiff if
+// any environment has changes and fails if any could not be diffed.
+func diffEnvironments(paths []string, selector labels.Selector, opts tanka.DiffOpts, exitStatusDiff int) error {
+	envs, err := tanka.FindTargets(paths, tanka.TargetOpts{Opts: opts.Opts, Selector: selector})
+	if err != nil {
+		return err
+	}
+
+	diffs, err := tanka.DiffEnvironments(envs, opts)
+	if err != nil {
+		return err
+	}
+
+	bold := color.New(color.Bold).SprintFunc()
+	var buf bytes.Buffer
+	for _, d := range diffs {
+		fmt.Fprintln(&buf, bold("# Environment "+d.Env.Metadata.Name))
+		switch {
+		case d.Err != nil:
+			fmt.Fprintf(&buf, "Error: %s\n", d.Err)
+		case d.Changes == nil:
+			fmt.Fprintln(&buf, "No differences.")
+		default:
+			r := term.Colordiff(*d.Changes)
+			buf.Write(r.Bytes())
+		}
+		fmt.Fprintln(&buf)
+	}
+
+	changed, failed := 0, 0
+	fmt.Fprintln(&buf, bold("# Summary"))
+	w := tabwriter.NewWriter(&buf, 0, 0, 4, ' ', 0)
+	for _, d := range diffs {
+		status := "no differences"
+		switch {
+		case d.Err != nil:
+			status = color.RedString("failed")
+			failed++
+		case d.Changes != nil:
+			status = color.YellowString("changed")
+			changed++
+		}
+		fmt.Fprintf(w, "%s\t%s\n", d.Env.Metadata.Name, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := fPageln(&buf); err != nil {
+		return err
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d of %d environments could not be diffed", failed, len(diffs))
+	case changed > 0:
+		os.Exit(exitStatusDiff)
+	}
+	os.Exit(ExitStatusClean)
+	return nil
+}
+
+// diffJSON prints the differences as a JSON array of objects and exits with
+// exitStatusDiff if any object changes
+func diffJSON(path string, opts tanka.DiffOpts, exitStatusDiff int) error {
+	diffs, err := tanka.DiffStructured(path, opts)
+	if err != nil {
+		return err
+	}
+	if diffs == nil {
+		diffs = []kubernetes.ObjectDiff{}
+	}
+
+	out, err := json.MarshalIndent(diffs, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	for _, d := range diffs {
+		if d.Change != kubernetes.ChangeUnchanged {
+			os.Exit(exitStatusDiff)
+		}
+	}
+	os.Exit(ExitStatusClean)
+	return nil
+}
+
 func showCmd() *cli.Command {
 	cmd := &cli.Command{
 		Use:   "show <path>",
@@ -195,9 +430,12 @@ func showCmd() *cli.Command {
 	}
 
 	allowRedirect := cmd.Flags().Bool("dangerous-allow-redirect", false, "allow redirecting output to a file or a pipe.")
+	watch := cmd.Flags().Bool("watch", false, "show again whenever files of the environment change, printing only objects that changed")
 
 	vars := workflowFlags(cmd.Flags())
 	getJsonnetOpts := jsonnetFlags(cmd.Flags())
+	getNixOpts := nixFlags(cmd.Flags())
+	profile := profileFlags(cmd.Flags())
 
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		if !interactive && !*allowRedirect {
@@ -212,17 +450,33 @@ Otherwise run tk show --dangerous-allow-redirect to bypass this check.`)
 			return err
 		}
 
-		pretty, err := tanka.Show(args[0], tanka.Opts{
+		opts := tanka.Opts{
 			JsonnetOpts: getJsonnetOpts(),
+			Nix:         getNixOpts(),
 			Filters:     filters,
 			Name:        vars.name,
-		})
+		}
+		if *watch {
+			if profile.enabled {
+				return fmt.Errorf("--profile can't be combined with --watch")
+			}
+			return watchShow(args[0], opts)
+		}
+
+		b, report := profile.backend(&opts)
+		pretty, err := b.Show(args[0], opts, vars.targets)
 
 		if err != nil {
+			if rerr := report(); rerr != nil {
+				log.Println("Reporting profile:", rerr)
+			}
 			return err
 		}
 
-		return pageln(pretty.String())
+		if err := pageln(pretty.String()); err != nil {
+			return err
+		}
+		return report()
 	}
 	return cmd
 }
@@ -52,6 +52,12 @@ export default {
         "Kustomize support",
         "Output filtering",
         "Exporting as YAML",
+        "Multiple environments",
+        "Plan files",
+        "Apply order",
+        "Evaluation server",
+        "Watch mode",
+        "Profiling",
       ],
     },
     {
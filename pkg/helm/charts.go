@@ -38,8 +38,8 @@ func LoadChartfile(projectRoot string) (*Charts, error) {
 	}
 
 	for i, r := range c.Requires {
-		if r.Chart == "" {
-			return nil, fmt.Errorf("requirements[%v]: 'chart' must be set", i)
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("requirements[%v]: %w", i, err)
 		}
 	}
 
@@ -69,6 +69,7 @@ type Charts struct {
 
 // chartManifest represents a Helm chart's Chart.yaml
 type chartManifest struct {
+	Name    string `yaml:"name"`
 	Version string `yaml:"version"`
 }
 
@@ -82,64 +83,229 @@ func (c Charts) ManifestFile() string {
 	return filepath.Join(c.projectRoot, Filename)
 }
 
+// VendorOpts are additional, non-required options for Charts.Vendor
+type VendorOpts struct {
+	// Frozen only verifies the charts directory against chartfile.lock,
+	// failing instead of downloading anything
+	Frozen bool
+}
+
 // Vendor pulls all Charts specified in the manifest into the local charts
 // directory. It fetches the repository index before doing so.
-func (c Charts) Vendor() error {
+//
+// What was vendored is recorded in chartfile.lock. Charts that still match it
+// are not pulled again, and charts pulled again must have the same digest as
+// before, so that a re-published chart does not go unnoticed.
+func (c Charts) Vendor(opts VendorOpts) error {
 	dir := c.ChartDir()
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return err
 	}
 
+	lock, err := c.LoadLock()
+	if err != nil {
+		return err
+	}
+	next := Lockfile{Version: LockVersion, Charts: []LockedChart{}}
+
 	repositoriesUpdated := false
+	indexes := make(map[string]*Index)
 	log.Println("Pulling Charts ...")
 	for _, r := range c.Manifest.Requires {
-		chartName := parseReqName(r.Chart)
-		chartPath := filepath.Join(dir, chartName)
-
-		_, err := os.Stat(chartPath)
-		if err == nil {
-			chartManifestPath := filepath.Join(chartPath, "Chart.yaml")
-			chartManifestBytes, err := os.ReadFile(chartManifestPath)
-			if err != nil {
-				return fmt.Errorf("reading chart manifest: %w", err)
+		locked, isLocked := lock.find(r)
+		var verifyErr error
+		if isLocked {
+			if verifyErr = c.verify(r, locked); verifyErr == nil {
+				log.Printf(" %s exists", r)
+				next.Charts = append(next.Charts, locked)
+				continue
 			}
-			var chartYAML chartManifest
-			if err := yaml.Unmarshal(chartManifestBytes, &chartYAML); err != nil {
-				return fmt.Errorf("unmarshalling chart manifest: %w", err)
+		}
+
+		if opts.Frozen {
+			if !isLocked {
+				return fmt.Errorf("%s is not locked in %s. Run 'tk tool charts vendor' without --frozen to lock it", r, LockFilename)
 			}
+			return fmt.Errorf("%s does not match %s: %w", r, LockFilename, verifyErr)
+		}
+		if verifyErr != nil {
+			log.Printf(" %s does not match %s (%s), vendoring again", r, LockFilename, verifyErr)
+		}
 
-			if chartYAML.Version == r.Version.String() {
-				log.Printf(" %s@%s exists", r.Chart, r.Version.String())
-				continue
-			} else {
-				log.Printf("Removing %s@%s", r.Chart, r.Version.String())
-				if err := os.RemoveAll(chartPath); err != nil {
+		var vendored *LockedChart
+		switch r.Source() {
+		case SourceArchive, SourceDir:
+			if vendored, err = c.vendorLocal(r); err != nil {
+				return err
+			}
+			log.Printf(" %s copied", r)
+		default:
+			// OCI registries have no index
+			if r.Source() == SourceRepo && !repositoriesUpdated {
+				log.Println("Syncing Repositories ...")
+				if err := c.Helm.RepoUpdate(Opts{Repositories: c.Manifest.Repositories}); err != nil {
 					return err
 				}
+				repositoriesUpdated = true
 			}
-		} else if !os.IsNotExist(err) {
-			return err
-		}
-
-		if !repositoriesUpdated {
-			log.Println("Syncing Repositories ...")
-			if err := c.Helm.RepoUpdate(Opts{Repositories: c.Manifest.Repositories}); err != nil {
+			if vendored, err = c.pull(r, indexes); err != nil {
 				return err
 			}
-			repositoriesUpdated = true
+			log.Printf(" %s downloaded", r)
 		}
-		err = c.Helm.Pull(r.Chart, r.Version.String(), PullOpts{
-			Destination: dir,
-			Opts:        Opts{Repositories: c.Manifest.Repositories},
-		})
-		if err != nil {
-			return err
+
+		// the same version must always have the same contents. Local charts
+		// are expected to change though
+		if isLocked && r.Source() != SourceArchive && r.Source() != SourceDir && vendored.Digest != locked.Digest {
+			return fmt.Errorf("%s was re-published: its digest changed from '%s' to '%s'. If this is expected, remove it from %s and vendor again", r, locked.Digest, vendored.Digest, LockFilename)
 		}
+		next.Charts = append(next.Charts, *vendored)
+	}
+
+	if opts.Frozen {
+		return nil
+	}
+	return c.writeLock(next)
+}
 
-		log.Printf(" %s@%s downloaded", r.Chart, r.Version.String())
+// pull downloads the archive of r and unpacks it into the charts directory,
+// after verifying it against the digest r is pinned to. indexes caches the
+// repository indexes used to resolve the URL of r.
+func (c Charts) pull(r Requirement, indexes map[string]*Index) (*LockedChart, error) {
+	tmp, err := os.MkdirTemp("", "tanka-chart")
+	if err != nil {
+		return nil, err
 	}
+	defer os.RemoveAll(tmp)
 
-	return nil
+	err = c.Helm.Pull(r.Chart, r.Version.String(), PullOpts{
+		Destination: tmp,
+		Archive:     true,
+		Opts:        Opts{Repositories: c.Manifest.Repositories},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := findArchive(tmp)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := digestFile(archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verifyDigest(digest); err != nil {
+		return nil, err
+	}
+
+	url, err := c.resolveURL(r, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.unpack(r, r.name(), url, digest, func(dest string) error {
+		return extractChart(archive, dest)
+	})
+}
+
+// resolveURL returns the URL the archive of r is downloaded from. If the index
+// of its repository can't be fetched, the URL of the repository is returned.
+func (c Charts) resolveURL(r Requirement, indexes map[string]*Index) (string, error) {
+	if r.Source() == SourceOCI {
+		return r.Chart + ":" + r.Version.String(), nil
+	}
+
+	index, repo, err := c.repoIndex(r, indexes)
+	if err != nil {
+		if repo.URL == "" {
+			return "", err
+		}
+		// helm pulled the chart already, but the index of repositories
+		// served by plugins (e.g. s3://) can't be fetched by Tanka. Record the
+		// repository instead.
+		log.Printf(" %s: recording the repository URL, as its index can't be fetched: %s", r, err)
+		return repo.URL, nil
+	}
+	return index.URL(repo.URL, r.name(), r.Version.String())
+}
+
+// vendorLocal copies the local chart archive or directory of r into the charts
+// directory, named like the chart. It is verified against the digest and
+// version r is pinned to.
+func (c Charts) vendorLocal(r Requirement) (*LockedChart, error) {
+	src := c.localPath(r)
+
+	var digest, name string
+	var err error
+	switch r.Source() {
+	case SourceArchive:
+		if digest, err = digestFile(src); err != nil {
+			return nil, err
+		}
+		name, err = archiveChartName(src)
+	case SourceDir:
+		if digest, err = digestTree(src); err != nil {
+			return nil, err
+		}
+		name, err = dirChartName(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verifyDigest(digest); err != nil {
+		return nil, err
+	}
+
+	return c.unpack(r, name, r.Chart, digest, func(dest string) error {
+		if r.Source() == SourceArchive {
+			return extractChart(src, dest)
+		}
+		return copyChart(src, dest)
+	})
+}
+
+// unpack writes the chart of r into the charts directory as name using write,
+// and checks it is of the version r requires
+func (c Charts) unpack(r Requirement, name, url, digest string, write func(dest string) error) (*LockedChart, error) {
+	dest := filepath.Join(c.ChartDir(), name)
+	if err := write(dest); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "Chart.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("reading chart manifest: %w", err)
+	}
+	var m chartManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshalling chart manifest: %w", err)
+	}
+	if v := r.versionString(); v != "" && m.Version != v {
+		return nil, fmt.Errorf("version of '%s' does not match: expected '%s', got '%s'", r.Chart, v, m.Version)
+	}
+
+	tree, err := digestTree(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LockedChart{
+		Chart:      r.Chart,
+		Version:    r.versionString(),
+		Name:       name,
+		URL:        url,
+		Digest:     digest,
+		TreeDigest: tree,
+	}, nil
+}
+
+// localPath returns the path of the local chart of r
+func (c Charts) localPath(r Requirement) string {
+	if filepath.IsAbs(r.Chart) {
+		return r.Chart
+	}
+	return filepath.Join(c.projectRoot, r.Chart)
 }
 
 // Add adds every Chart in reqs to the Manifest after validation, and runs
@@ -178,7 +344,7 @@ func (c *Charts) Add(reqs []string) error {
 
 	// worked fine? vendor it
 	log.Printf("Added %v Charts to helmfile.yaml. Vendoring ...", added)
-	return c.Vendor()
+	return c.Vendor(VendorOpts{})
 }
 
 func (c *Charts) AddRepos(repos ...Repo) error {
@@ -235,15 +401,19 @@ func write(c Chartfile, dest string) error {
 
 var chartExp = regexp.MustCompile(`\w+\/.+@.+`)
 
-// parseReq parses a requirement from a string of the format `repo/name@version`
+// parseReq parses a requirement from a string of the format
+// `repo/name@version`, `oci://registry/path/name@version` or `./path`
 func parseReq(s string) (*Requirement, error) {
+	if isLocalPath(s) {
+		return &Requirement{Chart: s}, nil
+	}
 	if !chartExp.MatchString(s) {
-		return nil, fmt.Errorf("not of form 'repo/chart@version'")
+		return nil, fmt.Errorf("not of form 'repo/chart@version', 'oci://registry/chart@version' or './path'")
 	}
 
-	elems := strings.Split(s, "@")
-	chart := elems[0]
-	ver, err := semver.NewVersion(elems[1])
+	i := strings.LastIndex(s, "@")
+	chart := s[:i]
+	ver, err := semver.NewVersion(s[i+1:])
 	if errors.Is(err, semver.ErrInvalidSemVer) {
 		return nil, fmt.Errorf("version is invalid")
 	} else if err != nil {
@@ -1,25 +1,74 @@
 package helm
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"path/filepath"
 	"testing"
 
+	"github.com/Masterminds/semver"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 )
 
-type fakeHelm struct{}
+// fakeHelm pulls charts consisting of only a Chart.yaml, recording what was
+// pulled
+type fakeHelm struct {
+	pulled []string
 
-func (f fakeHelm) Pull(chart, version string, opts PullOpts) error {
-	return nil
+	// republished makes pulled charts differ from earlier pulls
+	republished bool
+}
+
+func (f *fakeHelm) Pull(chart, version string, opts PullOpts) error {
+	f.pulled = append(f.pulled, chart+"@"+version)
+
+	name := path.Base(chart)
+	archive := filepath.Join(opts.Destination, fmt.Sprintf("%s-%s.tgz", name, version))
+	if f.republished {
+		return writeChartArchive(archive, name, version+"\ndescription: republished")
+	}
+	return writeChartArchive(archive, name, version)
+}
+
+// testRepo serves a repository index.yaml listing the given versions of each
+// chart, using relative download URLs
+func testRepo(t *testing.T, charts map[string][]string) string {
+	index := Index{Entries: make(map[string][]IndexEntry)}
+	for name, versions := range charts {
+		for _, v := range versions {
+			index.Entries[name] = append(index.Entries[name], IndexEntry{
+				Version: v,
+				URLs:    []string{fmt.Sprintf("charts/%s-%s.tgz", name, v)},
+			})
+		}
+	}
+	data, err := yaml.Marshal(index)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
 }
 
-func (f fakeHelm) RepoUpdate(opts Opts) error {
+func (f *fakeHelm) RepoUpdate(opts Opts) error {
 	return nil
 }
 
-func (f fakeHelm) Template(name, chart string, opts TemplateOpts) (manifest.List, error) {
+func (f *fakeHelm) Template(name, chart string, opts TemplateOpts) (manifest.List, error) {
 	return nil, nil
 }
 
@@ -43,6 +92,7 @@ func TestAdd(t *testing.T) {
 	c, err := InitChartfile(filepath.Join(t.TempDir(), Filename))
 	require.NoError(t, err)
 	c.Helm = &fakeHelm{}
+	c.Manifest.Repositories[0].URL = testRepo(t, map[string][]string{"package": {"1.0.0", "1.1.0"}})
 
 	err = c.Add([]string{"stable/package@1.0.0"})
 	assert.NoError(t, err)
@@ -55,3 +105,282 @@ func TestAdd(t *testing.T) {
 	err = c.Add([]string{"stable/package@1.1.0"})
 	assert.NoError(t, err)
 }
+
+// writeChartArchive writes a chart archive holding only a Chart.yaml
+func writeChartArchive(archive, name, version string) error {
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	content := []byte(fmt.Sprintf("name: %s\nversion: %s\n", name, version))
+	if err := tw.WriteHeader(&tar.Header{Name: name + "/Chart.yaml", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func TestParseReq(t *testing.T) {
+	cases := []struct {
+		input string
+		want  Requirement
+		err   bool
+	}{
+		{input: "stable/mysql@1.6.7", want: Requirement{Chart: "stable/mysql", Version: *semver.MustParse("1.6.7")}},
+		{input: "oci://registry.example.com/charts/mysql@1.6.7", want: Requirement{Chart: "oci://registry.example.com/charts/mysql", Version: *semver.MustParse("1.6.7")}},
+		{input: "./vendored/mysql-1.6.7.tgz", want: Requirement{Chart: "./vendored/mysql-1.6.7.tgz"}},
+		{input: "../mysql", want: Requirement{Chart: "../mysql"}},
+		{input: "mysql", err: true},
+		{input: "stable/mysql@latest", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := parseReq(c.input)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, *got)
+		})
+	}
+}
+
+func TestRequirementValidate(t *testing.T) {
+	v := *semver.MustParse("1.0.0")
+	cases := []struct {
+		name string
+		req  Requirement
+		err  string
+	}{
+		{name: "repo", req: Requirement{Chart: "stable/mysql", Version: v}},
+		{name: "repo-no-version", req: Requirement{Chart: "stable/mysql"}, err: "'version' must be set for 'stable/mysql'"},
+		{name: "oci-no-version", req: Requirement{Chart: "oci://registry/mysql"}, err: "'version' must be set for 'oci://registry/mysql'"},
+		{name: "local", req: Requirement{Chart: "./mysql"}},
+		{name: "no-repo", req: Requirement{Chart: "mysql", Version: v}, err: "'chart' must be of form 'repo/chart', './path' or 'oci://registry/chart', got 'mysql'"},
+		{name: "bad-digest", req: Requirement{Chart: "./mysql", Digest: "md5:abc"}, err: "'digest' must be of form 'sha256:<hex>', got 'md5:abc'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.req.validate()
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestRequirementMarshal(t *testing.T) {
+	data, err := yaml.Marshal(Requirements{
+		{Chart: "stable/mysql", Version: *semver.MustParse("1.0.0")},
+		{Chart: "./mysql.tgz", Digest: "sha256:abc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `- chart: stable/mysql
+  version: 1.0.0
+- chart: ./mysql.tgz
+  digest: sha256:abc
+`, string(data))
+}
+
+func TestVendorSources(t *testing.T) {
+	dir := t.TempDir()
+	c, err := InitChartfile(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	h := &fakeHelm{}
+	c.Helm = h
+	c.Manifest.Repositories[0].URL = testRepo(t, map[string][]string{"repo": {"0.1.0"}})
+
+	// local archive and directory
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src/dir"), 0755))
+	require.NoError(t, writeChartArchive(filepath.Join(dir, "src/archive-1.0.0.tgz"), "archive", "1.0.0"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src/dir/Chart.yaml"), []byte("name: dir\nversion: 2.0.0\n"), 0644))
+
+	ociDigest := func() string {
+		tmp := t.TempDir()
+		require.NoError(t, writeChartArchive(filepath.Join(tmp, "oci.tgz"), "oci", "3.0.0"))
+		d, err := digestFile(filepath.Join(tmp, "oci.tgz"))
+		require.NoError(t, err)
+		return d
+	}()
+
+	c.Manifest.Requires = Requirements{
+		{Chart: "stable/repo", Version: *semver.MustParse("0.1.0")},
+		{Chart: "oci://registry.example.com/charts/oci", Version: *semver.MustParse("3.0.0"), Digest: ociDigest},
+		{Chart: "./src/archive-1.0.0.tgz"},
+		{Chart: "./src/dir", Version: *semver.MustParse("2.0.0")},
+	}
+	require.NoError(t, c.Vendor(VendorOpts{}))
+
+	assert.Equal(t, []string{"stable/repo@0.1.0", "oci://registry.example.com/charts/oci@3.0.0"}, h.pulled)
+	for name, version := range map[string]string{"repo": "0.1.0", "oci": "3.0.0", "archive": "1.0.0", "dir": "2.0.0"} {
+		data, err := os.ReadFile(filepath.Join(dir, "charts", name, "Chart.yaml"))
+		require.NoError(t, err, name)
+		assert.Contains(t, string(data), "version: "+version, name)
+	}
+
+	// existing charts are not pulled again
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	assert.Len(t, h.pulled, 2)
+}
+
+func TestVendorDigestMismatch(t *testing.T) {
+	wrong := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	cases := []struct {
+		name string
+		req  Requirement
+	}{
+		{name: "oci", req: Requirement{Chart: "oci://registry/oci", Version: *semver.MustParse("1.0.0"), Digest: wrong}},
+		{name: "archive", req: Requirement{Chart: "./archive.tgz", Digest: wrong}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			charts, err := InitChartfile(filepath.Join(dir, Filename))
+			require.NoError(t, err)
+			charts.Helm = &fakeHelm{}
+			require.NoError(t, writeChartArchive(filepath.Join(dir, "archive.tgz"), "archive", "1.0.0"))
+
+			charts.Manifest.Requires = Requirements{c.req}
+			err = charts.Vendor(VendorOpts{})
+			assert.ErrorContains(t, err, "digest of '"+c.req.Chart+"' does not match")
+
+			files, err := os.ReadDir(charts.ChartDir())
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+func TestVendorLock(t *testing.T) {
+	dir := t.TempDir()
+	c, err := InitChartfile(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	h := &fakeHelm{}
+	c.Helm = h
+	repo := testRepo(t, map[string][]string{"repo": {"0.1.0"}})
+	c.Manifest.Repositories[0].URL = repo
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src/dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src/dir/Chart.yaml"), []byte("name: dir\nversion: 2.0.0\n"), 0644))
+	c.Manifest.Requires = Requirements{
+		{Chart: "stable/repo", Version: *semver.MustParse("0.1.0")},
+		{Chart: "./src/dir"},
+	}
+
+	// frozen fails without a lock file, without downloading
+	err = c.Vendor(VendorOpts{Frozen: true})
+	assert.EqualError(t, err, "stable/repo@0.1.0 is not locked in chartfile.lock. Run 'tk tool charts vendor' without --frozen to lock it")
+	assert.Empty(t, h.pulled)
+
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	lock, err := c.LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Charts, 2)
+	assert.Equal(t, "stable/repo", lock.Charts[0].Chart)
+	assert.Equal(t, "0.1.0", lock.Charts[0].Version)
+	assert.Equal(t, "repo", lock.Charts[0].Name)
+	assert.Equal(t, repo+"/charts/repo-0.1.0.tgz", lock.Charts[0].URL)
+	assert.Regexp(t, digestExp, lock.Charts[0].Digest)
+	assert.Regexp(t, digestExp, lock.Charts[0].TreeDigest)
+	assert.Equal(t, LockedChart{
+		Chart:      "./src/dir",
+		Name:       "dir",
+		URL:        "./src/dir",
+		Digest:     lock.Charts[1].TreeDigest,
+		TreeDigest: lock.Charts[1].TreeDigest,
+	}, lock.Charts[1])
+
+	// the vendored state passes frozen
+	require.NoError(t, c.Vendor(VendorOpts{Frozen: true}))
+	assert.Len(t, h.pulled, 1)
+
+	// modified charts fail frozen, and are restored otherwise
+	chart := filepath.Join(c.ChartDir(), "repo", "Chart.yaml")
+	require.NoError(t, os.WriteFile(chart, []byte("name: repo\nversion: 0.1.0\nhacked: true\n"), 0644))
+	err = c.Vendor(VendorOpts{Frozen: true})
+	assert.ErrorContains(t, err, "stable/repo@0.1.0 does not match chartfile.lock: ")
+	assert.ErrorContains(t, err, "was modified")
+
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	assert.Len(t, h.pulled, 2)
+	data, err := os.ReadFile(chart)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hacked")
+
+	// so are changed local sources
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src/dir/values.yaml"), []byte("a: b\n"), 0644))
+	err = c.Vendor(VendorOpts{Frozen: true})
+	assert.ErrorContains(t, err, "'./src/dir' changed")
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	_, err = os.Stat(filepath.Join(c.ChartDir(), "dir", "values.yaml"))
+	assert.NoError(t, err)
+
+	// re-published charts are refused
+	require.NoError(t, os.RemoveAll(filepath.Join(c.ChartDir(), "repo")))
+	h.republished = true
+	err = c.Vendor(VendorOpts{})
+	assert.ErrorContains(t, err, "stable/repo@0.1.0 was re-published")
+
+	// entries of removed requirements are dropped
+	c.Manifest.Requires = c.Manifest.Requires[1:]
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	lock, err = c.LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Charts, 1)
+	assert.Equal(t, "./src/dir", lock.Charts[0].Chart)
+}
+
+func TestExtractChartTraversal(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.tgz")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "evil/../../escaped", Mode: 0644, Typeflag: tar.TypeReg}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	err = extractChart(archive, filepath.Join(dir, "charts", "evil"))
+	assert.ErrorContains(t, err, "invalid path")
+	_, err = os.Stat(filepath.Join(dir, "escaped"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestVendorLockPluginRepo(t *testing.T) {
+	dir := t.TempDir()
+	c, err := InitChartfile(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	c.Helm = &fakeHelm{}
+
+	// served by a helm plugin, which Tanka can't fetch the index of
+	c.Manifest.Repositories[0].URL = "s3://charts/stable"
+	c.Manifest.Requires = Requirements{
+		{Chart: "stable/repo", Version: *semver.MustParse("0.1.0")},
+	}
+
+	require.NoError(t, c.Vendor(VendorOpts{}))
+	lock, err := c.LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Charts, 1)
+	assert.Equal(t, "s3://charts/stable", lock.Charts[0].URL)
+	assert.Regexp(t, digestExp, lock.Charts[0].Digest)
+
+	require.NoError(t, c.Vendor(VendorOpts{Frozen: true}))
+}
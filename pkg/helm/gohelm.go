@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// EngineEnvVar selects the Helm implementation used by helmTemplate. Set it to
+// "go" to render charts in-process using GoHelm instead of ExecHelm
+const EngineEnvVar = "TANKA_HELM_ENGINE"
+
+// Default returns the Helm implementation selected using EngineEnvVar.
+// ExecHelm is the default.
+func Default() Helm {
+	if os.Getenv(EngineEnvVar) == "go" {
+		return GoHelm{}
+	}
+	return ExecHelm{}
+}
+
+// GoHelm is a Helm implementation that renders charts in-process using the
+// Helm Go libraries, which avoids starting `helm` for every Template call.
+// Pull and RepoUpdate are still handled by the `helm` binary.
+type GoHelm struct {
+	ExecHelm
+}
+
+// Version is empty, as GoHelm renders using the Helm libraries Tanka is built
+// with. Pull and RepoUpdate don't render.
+func (g GoHelm) Version() (string, error) {
+	return "", nil
+}
+
+// Template implements Helm.Template, like `helm template` does
+func (g GoHelm) Template(name, chart string, opts TemplateOpts) (manifest.List, error) {
+	chrt, err := loader.Load(chart)
+	if err != nil {
+		return nil, errors.Wrap(err, "Expanding Helm Chart")
+	}
+	if t := chrt.Metadata.Type; t != "" && t != "application" {
+		return nil, fmt.Errorf("Expanding Helm Chart: %s charts are not installable", t)
+	}
+	if deps := chrt.Metadata.Dependencies; deps != nil {
+		if err := action.CheckDependencies(chrt, deps); err != nil {
+			return nil, errors.Wrap(err, "Expanding Helm Chart")
+		}
+	}
+
+	// round-trip the values through YAML, so they are of the same types as
+	// for `helm template --values`
+	data, err := yaml.Marshal(opts.Values)
+	if err != nil {
+		return nil, errors.Wrap(err, "Converting Helm values to YAML")
+	}
+	values, err := chartutil.ReadValues(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Converting Helm values to YAML")
+	}
+
+	install, err := templateAction(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := install.Run(chrt, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "Expanding Helm Chart")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, strings.TrimSpace(rel.Manifest))
+	if !opts.NoHooks {
+		for _, h := range rel.Hooks {
+			if opts.SkipTests && isTestHook(h) {
+				continue
+			}
+			fmt.Fprintf(&buf, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+		}
+	}
+
+	return parseManifests(&buf)
+}
+
+// templateAction returns an action.Install configured like `helm template`
+// with the flags of opts
+func templateAction(name string, opts TemplateOpts) (*action.Install, error) {
+	cfg := &action.Configuration{
+		Log: func(string, ...interface{}) {},
+	}
+
+	install := action.NewInstall(cfg)
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.ReleaseName = name
+	install.Namespace = opts.Namespace
+	if install.Namespace == "" {
+		install.Namespace = "default"
+	}
+	install.APIVersions = chartutil.VersionSet(opts.APIVersions)
+	install.IncludeCRDs = opts.IncludeCRDs
+	install.DisableHooks = opts.NoHooks
+
+	if opts.KubeVersion != "" {
+		v, err := chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube version '%s': %s", opts.KubeVersion, err)
+		}
+		install.KubeVersion = v
+	}
+
+	return install, nil
+}
+
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
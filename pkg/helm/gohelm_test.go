@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoHelmTemplate(t *testing.T) {
+	cases := []struct {
+		name string
+		opts TemplateOpts
+
+		want     []string
+		wantData map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "defaults",
+			want:     []string{"ConfigMap/default/test-config", "Job/test-migrate", "Pod/test-test"},
+			wantData: map[string]interface{}{"value": "default", "kubeVersion": "v1.20.0", "hasWidgets": "false"},
+		},
+		{
+			name: "options",
+			opts: TemplateOpts{
+				Values:      map[string]interface{}{"value": 42},
+				APIVersions: []string{"widgets.example.com/v1"},
+				KubeVersion: "1.23.4",
+				Namespace:   "custom",
+			},
+			want:     []string{"ConfigMap/custom/test-config", "Job/test-migrate", "Pod/test-test"},
+			wantData: map[string]interface{}{"value": "42", "kubeVersion": "v1.23.4", "hasWidgets": "true"},
+		},
+		{
+			name: "include-crds",
+			opts: TemplateOpts{IncludeCRDs: true},
+			want: []string{"ConfigMap/default/test-config", "CustomResourceDefinition/widgets.example.com", "Job/test-migrate", "Pod/test-test"},
+		},
+		{
+			name: "no-hooks",
+			opts: TemplateOpts{NoHooks: true},
+			want: []string{"ConfigMap/default/test-config"},
+		},
+		{
+			name: "skip-tests",
+			opts: TemplateOpts{SkipTests: true},
+			want: []string{"ConfigMap/default/test-config", "Job/test-migrate"},
+		},
+		{
+			name: "invalid-kube-version",
+			opts: TemplateOpts{KubeVersion: "latest"},
+			err:  "invalid kube version 'latest'",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			list, err := GoHelm{}.Template("test", "./testdata/demo", c.opts)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, c.want, kindNames(list))
+			if c.wantData != nil {
+				for _, m := range list {
+					if m.Kind() == "ConfigMap" {
+						assert.Equal(t, c.wantData, m["data"])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGoHelmTemplateMissingChart(t *testing.T) {
+	_, err := GoHelm{}.Template("test", "./testdata/missing", TemplateOpts{})
+	assert.ErrorContains(t, err, "Expanding Helm Chart")
+}
+
+func kindNames(list manifest.List) []string {
+	var out []string
+	for _, m := range list {
+		s := m.Kind() + "/"
+		if ns := m.Metadata().Namespace(); ns != "" {
+			s += ns + "/"
+		}
+		out = append(out, s+m.Metadata().Name())
+	}
+	sort.Strings(out)
+	return out
+}
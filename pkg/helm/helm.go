@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
 
 // Helm provides high level access to some Helm operations
 type Helm interface {
-	// Pull downloads a Helm Chart from a remote
+	// Pull downloads a Helm Chart from a remote. Charts of OCI registries are
+	// referred to as oci://registry/path/chart
 	Pull(chart, version string, opts PullOpts) error
 
 	// RepoUpdate fetches the latest remote index
@@ -28,6 +31,9 @@ type PullOpts struct {
 
 	// Directory to put the resulting .tgz into
 	Destination string
+
+	// Archive keeps the .tgz instead of unpacking it into Destination
+	Archive bool
 }
 
 // Opts are additional, non-required options that all Helm operations accept
@@ -46,14 +52,16 @@ func (e ExecHelm) Pull(chart, version string, opts PullOpts) error {
 	}
 	defer os.Remove(repoFile)
 
-	cmd := e.cmd("pull", chart,
+	args := []string{chart,
 		"--version", version,
 		"--destination", opts.Destination,
 		"--repository-config", repoFile,
-		"--untar",
-	)
+	}
+	if !opts.Archive {
+		args = append(args, "--untar")
+	}
 
-	return cmd.Run()
+	return e.cmd("pull", args...).Run()
 }
 
 // RepoUpdate implements Helm.RepoUpdate
@@ -77,6 +85,35 @@ func (e ExecHelm) RepoUpdate(opts Opts) error {
 	return nil
 }
 
+// binaryVersions memoizes the output of `helm version` per binary
+var binaryVersions = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Version returns the version of the `helm` binary, as reported by `helm
+// version --short`
+func (e ExecHelm) Version() (string, error) {
+	cmd := helmCmd("version", "--short")
+
+	binaryVersions.Lock()
+	defer binaryVersions.Unlock()
+	if v, ok := binaryVersions.m[cmd.Path]; ok {
+		return v, nil
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("getting the version of helm: %w", err)
+	}
+
+	v := strings.TrimSpace(out.String())
+	binaryVersions.m[cmd.Path] = v
+	return v, nil
+}
+
 // cmd returns a prepared exec.Cmd to use the `helm` binary
 func (e ExecHelm) cmd(action string, args ...string) *exec.Cmd {
 	argv := []string{action}
@@ -0,0 +1,33 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecHelmVersion(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "helm")
+	log := filepath.Join(dir, "calls")
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\necho \"$@\" >> "+log+"\necho v3.14.0+g3fc9f4b\n"), 0755))
+	t.Setenv("TANKA_HELM_PATH", bin)
+
+	for i := 0; i < 2; i++ {
+		v, err := ExecHelm{}.Version()
+		require.NoError(t, err)
+		assert.Equal(t, "v3.14.0+g3fc9f4b", v)
+	}
+
+	// the version is memoized
+	calls, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "version --short\n", string(calls))
+
+	v, err := GoHelm{}.Version()
+	require.NoError(t, err)
+	assert.Empty(t, v)
+}
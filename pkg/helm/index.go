@@ -0,0 +1,143 @@
+package helm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Index is the index.yaml of a chart repository
+type Index struct {
+	// Entries are the versions of each chart of the repository
+	Entries map[string][]IndexEntry `json:"entries"`
+}
+
+// IndexEntry is a single version of a chart of an Index
+type IndexEntry struct {
+	Version string   `json:"version"`
+	URLs    []string `json:"urls"`
+	Digest  string   `json:"digest,omitempty"`
+}
+
+// FetchIndex downloads the index.yaml of repo
+func FetchIndex(repo Repo) (*Index, error) {
+	client, err := repoClient(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	u := strings.TrimSuffix(repo.URL, "/") + "/index.yaml"
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if repo.Username != "" || repo.Password != "" {
+		req.SetBasicAuth(repo.Username, repo.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching index of repository '%s': %w", repo.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching index of repository '%s': %s", repo.Name, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parsing index of repository '%s': %w", repo.Name, err)
+	}
+	return &index, nil
+}
+
+// URL returns the absolute download URL of the archive of chart at version,
+// resolving relative URLs against repoURL
+func (i Index) URL(repoURL, chart, version string) (string, error) {
+	for _, e := range i.Entries[chart] {
+		if e.Version != version {
+			continue
+		}
+		if len(e.URLs) == 0 {
+			return "", fmt.Errorf("chart '%s@%s' has no download URL", chart, version)
+		}
+
+		base, err := url.Parse(strings.TrimSuffix(repoURL, "/") + "/")
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(e.URLs[0])
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+
+	return "", fmt.Errorf("chart '%s@%s' not found in repository index", chart, version)
+}
+
+// repoIndex returns the Index of the repository of r. Indexes are fetched
+// once, and cached in indexes afterwards
+func (c Charts) repoIndex(r Requirement, indexes map[string]*Index) (*Index, Repo, error) {
+	repoName := strings.SplitN(r.Chart, "/", 2)[0]
+	for _, repo := range c.Manifest.Repositories {
+		if repo.Name != repoName {
+			continue
+		}
+
+		if index, ok := indexes[repo.Name]; ok {
+			return index, repo, nil
+		}
+		index, err := FetchIndex(repo)
+		if err != nil {
+			return nil, repo, err
+		}
+		indexes[repo.Name] = index
+		return index, repo, nil
+	}
+
+	return nil, Repo{}, fmt.Errorf("repository '%s' of '%s' not found in %s", repoName, r.Chart, Filename)
+}
+
+// repoClient returns a http.Client using the TLS settings of repo
+func repoClient(repo Repo) (*http.Client, error) {
+	client := &http.Client{Timeout: time.Minute}
+	if repo.CAFile == "" && repo.CertFile == "" {
+		return client, nil
+	}
+
+	config := &tls.Config{}
+	if repo.CAFile != "" {
+		ca, err := os.ReadFile(repo.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in caFile '%s'", repo.CAFile)
+		}
+	}
+	if repo.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(repo.CertFile, repo.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	client.Transport = &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment}
+	return client, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/rendercache"
 )
 
 // DefaultNameFormat to use when no nameFormat is supplied
@@ -31,7 +32,11 @@ type JsonnetOpts struct {
 // present on the local filesystem, at a relative location to the file that
 // calls `helm.template()` / `std.native('helmTemplate')`. This guarantees
 // hermeticity
-func NativeFunc(h Helm) *jsonnet.NativeFunction {
+//
+// Renders are memoized in cache, keyed on the contents of the chart, the name
+// and the TemplateOpts. Renders persisted to a Store are also keyed on the
+// version of h (see ExecHelm.Version). cache may be nil to always render.
+func NativeFunc(h Helm, cache *rendercache.Cache) *jsonnet.NativeFunction {
 	return &jsonnet.NativeFunction{
 		Name: "helmTemplate",
 		// Similar to `helm template [NAME] [CHART] [flags]` except 'conf' is a
@@ -62,7 +67,25 @@ func NativeFunc(h Helm) *jsonnet.NativeFunction {
 			}
 
 			// render resources
-			list, err := h.Template(name, chart, opts.TemplateOpts)
+			var key string
+			if cache != nil {
+				args := []interface{}{name, opts.TemplateOpts}
+				if v, ok := h.(versioner); ok && cache.Persistent() {
+					version, err := v.Version()
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, version)
+				}
+
+				key, err = rendercache.Key(fmt.Sprintf("helmTemplate/%T", h), []string{chart}, args...)
+				if err != nil {
+					return nil, err
+				}
+			}
+			list, err := cache.Render(key, func() (manifest.List, error) {
+				return h.Template(name, chart, opts.TemplateOpts)
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -78,6 +101,12 @@ func NativeFunc(h Helm) *jsonnet.NativeFunction {
 	}
 }
 
+// versioner is implemented by Helm implementations that render using an
+// external binary, whose version changes what is rendered
+type versioner interface {
+	Version() (string, error)
+}
+
 func parseOpts(data interface{}) (*JsonnetOpts, error) {
 	c, err := json.Marshal(data)
 	if err != nil {
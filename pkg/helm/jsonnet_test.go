@@ -0,0 +1,118 @@
+package helm
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/rendercache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHelm renders a single ConfigMap, counting the calls to Template
+type countingHelm struct {
+	*fakeHelm
+	calls *int32
+}
+
+func (h countingHelm) Template(name, chart string, opts TemplateOpts) (manifest.List, error) {
+	atomic.AddInt32(h.calls, 1)
+	return manifest.List{{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name},
+		"data":       opts.Values,
+	}}, nil
+}
+
+func TestNativeFuncMemoized(t *testing.T) {
+	var calls int32
+	fn := NativeFunc(countingHelm{calls: &calls}, rendercache.New(nil))
+
+	call := func(name string, values map[string]interface{}) map[string]interface{} {
+		out, err := fn.Func([]interface{}{name, "./demo", map[string]interface{}{
+			"calledFrom": "./testdata/main.jsonnet",
+			"values":     values,
+		}})
+		require.NoError(t, err)
+		return out.(map[string]interface{})
+	}
+
+	// environments exported in parallel render the same chart once
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := call("memoized", map[string]interface{}{"value": "a"})
+			assert.Contains(t, out, "config_map_memoized")
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, calls)
+
+	// other names or options are rendered separately
+	call("memoized", map[string]interface{}{"value": "b"})
+	call("other", map[string]interface{}{"value": "a"})
+	assert.EqualValues(t, 3, calls)
+
+	// without a cache, every call renders
+	uncached := NativeFunc(countingHelm{calls: &calls}, nil)
+	for i := 0; i < 2; i++ {
+		_, err := uncached.Func([]interface{}{"memoized", "./demo", map[string]interface{}{"calledFrom": "./testdata/main.jsonnet"}})
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 5, calls)
+}
+
+// versionedHelm is a countingHelm of the given version
+type versionedHelm struct {
+	countingHelm
+	version string
+	err     error
+}
+
+func (h versionedHelm) Version() (string, error) {
+	return h.version, h.err
+}
+
+// mapStore is an in-memory rendercache.Store
+type mapStore map[string]string
+
+func (s mapStore) Get(key string) (string, error) { return s[key], nil }
+
+func (s mapStore) Store(key, content string) error {
+	s[key] = content
+	return nil
+}
+
+func TestNativeFuncVersion(t *testing.T) {
+	var calls int32
+	store := mapStore{}
+	call := func(h Helm, cache *rendercache.Cache) {
+		_, err := NativeFunc(h, cache).Func([]interface{}{"versioned", "./demo", map[string]interface{}{
+			"calledFrom": "./testdata/main.jsonnet",
+		}})
+		require.NoError(t, err)
+	}
+
+	call(versionedHelm{countingHelm: countingHelm{calls: &calls}, version: "v3.14.0"}, rendercache.New(store))
+	call(versionedHelm{countingHelm: countingHelm{calls: &calls}, version: "v3.14.0"}, rendercache.New(store))
+	assert.EqualValues(t, 1, calls)
+
+	// persisted renders of other versions of helm are not used
+	call(versionedHelm{countingHelm: countingHelm{calls: &calls}, version: "v3.15.0"}, rendercache.New(store))
+	assert.EqualValues(t, 2, calls)
+	assert.Len(t, store, 2)
+
+	// the version is only needed for persisted renders
+	failing := versionedHelm{countingHelm: countingHelm{calls: &calls}, err: errors.New("no helm")}
+	call(failing, rendercache.New(nil))
+	_, err := NativeFunc(failing, rendercache.New(store)).Func([]interface{}{"versioned", "./demo", map[string]interface{}{
+		"calledFrom": "./testdata/main.jsonnet",
+	}})
+	assert.EqualError(t, err, "no helm")
+}
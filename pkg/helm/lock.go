@@ -0,0 +1,135 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// LockFilename is the name of the lock file next to the Chartfile
+	LockFilename = "chartfile.lock"
+
+	// LockVersion of the current lock file implementation
+	LockVersion = 1
+)
+
+// Lockfile records what exactly was vendored for each requirement of the
+// Chartfile, so that vendoring is reproducible
+type Lockfile struct {
+	// Version of the lock file schema (for future use)
+	Version uint `json:"version"`
+
+	Charts []LockedChart `json:"charts"`
+}
+
+// LockedChart is the vendored state of a single Requirement
+type LockedChart struct {
+	// Chart and Version of the Requirement
+	Chart   string `json:"chart"`
+	Version string `json:"version,omitempty"`
+
+	// Name is the directory the chart is vendored to, below
+	// Chartfile.Directory
+	Name string `json:"name"`
+
+	// URL the chart was downloaded from. Local charts keep their path
+	URL string `json:"url"`
+
+	// Digest is the sha256 of the chart archive, or of the source directory
+	// for local directories (see Requirement.Digest)
+	Digest string `json:"digest"`
+
+	// TreeDigest is the sha256 of the paths and contents of all files of the
+	// vendored directory
+	TreeDigest string `json:"treeDigest"`
+}
+
+// versionString is the Version of r as recorded in the lock file
+func (r Requirement) versionString() string {
+	if r.Version.Equal(&zeroVersion) {
+		return ""
+	}
+	return r.Version.String()
+}
+
+// find returns the entry locking r, if any. Entries of another version or
+// digest of the chart don't lock r.
+func (l Lockfile) find(r Requirement) (LockedChart, bool) {
+	for _, c := range l.Charts {
+		if c.Chart != r.Chart || c.Version != r.versionString() {
+			continue
+		}
+		if r.Digest != "" && r.Digest != c.Digest {
+			continue
+		}
+		return c, true
+	}
+	return LockedChart{}, false
+}
+
+// LockFile returns the full path to the chartfile.lock
+func (c Charts) LockFile() string {
+	return filepath.Join(c.projectRoot, LockFilename)
+}
+
+// LoadLock returns the lock file of the Chartfile. If it does not exist, an
+// empty one is returned
+func (c Charts) LoadLock() (*Lockfile, error) {
+	lock := &Lockfile{Version: LockVersion}
+
+	data, err := os.ReadFile(c.LockFile())
+	if os.IsNotExist(err) {
+		return lock, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, lock); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", LockFilename, err)
+	}
+	return lock, nil
+}
+
+func (c Charts) writeLock(lock Lockfile) error {
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.LockFile(), data, 0644)
+}
+
+// verify checks the vendored directory of locked still matches it. For local
+// charts, the source must not have changed either.
+func (c Charts) verify(r Requirement, locked LockedChart) error {
+	dir := filepath.Join(c.ChartDir(), locked.Name)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("'%s' is missing", dir)
+	}
+	tree, err := digestTree(dir)
+	if err != nil {
+		return err
+	}
+	if tree != locked.TreeDigest {
+		return fmt.Errorf("'%s' was modified: expected '%s', got '%s'", dir, locked.TreeDigest, tree)
+	}
+
+	var source string
+	switch r.Source() {
+	case SourceArchive:
+		source, err = digestFile(c.localPath(r))
+	case SourceDir:
+		source, err = digestTree(c.localPath(r))
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if source != locked.Digest {
+		return fmt.Errorf("'%s' changed: expected '%s', got '%s'", r.Chart, locked.Digest, source)
+	}
+	return nil
+}
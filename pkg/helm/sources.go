@@ -0,0 +1,307 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Source is where a Requirement is vendored from
+type Source int
+
+const (
+	// SourceRepo is a chart of a named repository of the Chartfile
+	// (`repo/chart`)
+	SourceRepo Source = iota
+	// SourceOCI is a chart of an OCI registry (`oci://registry/path/chart`)
+	SourceOCI
+	// SourceArchive is a local chart archive (`./path/chart-1.0.0.tgz`)
+	SourceArchive
+	// SourceDir is a local chart directory (`./path/chart`)
+	SourceDir
+)
+
+// OCIPrefix marks charts of OCI registries
+const OCIPrefix = "oci://"
+
+// Source returns where r is vendored from. Local paths must be absolute or
+// start with ./ or ../, and are relative to the chartfile.yaml
+func (r Requirement) Source() Source {
+	switch {
+	case strings.HasPrefix(r.Chart, OCIPrefix):
+		return SourceOCI
+	case !isLocalPath(r.Chart):
+		return SourceRepo
+	case strings.HasSuffix(r.Chart, ".tgz") || strings.HasSuffix(r.Chart, ".tar.gz"):
+		return SourceArchive
+	default:
+		return SourceDir
+	}
+}
+
+func isLocalPath(s string) bool {
+	return strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") || filepath.IsAbs(s)
+}
+
+var digestExp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// validate checks r is complete for its source
+func (r Requirement) validate() error {
+	if r.Chart == "" {
+		return fmt.Errorf("'chart' must be set")
+	}
+	if r.Digest != "" && !digestExp.MatchString(r.Digest) {
+		return fmt.Errorf("'digest' must be of form 'sha256:<hex>', got '%s'", r.Digest)
+	}
+
+	switch r.Source() {
+	case SourceRepo:
+		if !strings.Contains(r.Chart, "/") {
+			return fmt.Errorf("'chart' must be of form 'repo/chart', './path' or 'oci://registry/chart', got '%s'", r.Chart)
+		}
+		fallthrough
+	case SourceOCI:
+		if r.Version.Equal(&zeroVersion) {
+			return fmt.Errorf("'version' must be set for '%s'", r.Chart)
+		}
+	}
+	return nil
+}
+
+// name is the directory a remote chart is vendored as
+func (r Requirement) name() string {
+	if r.Source() == SourceOCI {
+		return path.Base(strings.TrimPrefix(r.Chart, OCIPrefix))
+	}
+	return parseReqName(r.Chart)
+}
+
+// digestFile returns the sha256 digest of the file at path, in the
+// `sha256:<hex>` format of Requirement.Digest
+func digestFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestTree returns the sha256 digest of the relative paths and contents of
+// all files below dir, in the `sha256:<hex>` format of Requirement.Digest
+func digestTree(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", err
+		}
+		sum, err := digestFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, filepath.ToSlash(rel))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyDigest checks got matches the digest r is pinned to, if any
+func (r Requirement) verifyDigest(got string) error {
+	if r.Digest != "" && r.Digest != got {
+		return fmt.Errorf("digest of '%s' does not match: expected '%s', got '%s'", r.Chart, r.Digest, got)
+	}
+	return nil
+}
+
+// findArchive returns the single chart archive Helm.Pull left in dir
+func findArchive(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("expected a single chart archive in '%s', found %d", dir, len(matches))
+	}
+	return matches[0], nil
+}
+
+// archiveChartName returns the name of the chart in archive: the top level
+// directory all its files are in
+func archiveChartName(archive string) (string, error) {
+	var name string
+	err := walkArchive(archive, func(hdr *tar.Header, _ io.Reader) error {
+		top, _, err := archivePath(archive, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name != "" && top != name {
+			return fmt.Errorf("chart archive '%s' holds more than one chart", archive)
+		}
+		name = top
+		return nil
+	})
+	if err == nil && name == "" {
+		err = fmt.Errorf("chart archive '%s' is empty", archive)
+	}
+	return name, err
+}
+
+// extractChart unpacks the chart in archive into dest, replacing whatever
+// existed there before. The top level directory of the archive is stripped.
+func extractChart(archive, dest string) error {
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	return walkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+		_, rel, err := archivePath(archive, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			return nil
+		}
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, r); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}
+
+		// Helm does not package links or devices either
+		return nil
+	})
+}
+
+// archivePath splits the path of an archive entry into its top level directory
+// and the rest. Paths escaping the archive, like ../../etc/passwd, are refused.
+func archivePath(archive, name string) (top, rel string, err error) {
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", "", fmt.Errorf("chart archive '%s' contains invalid path '%s'", archive, name)
+	}
+
+	parts := strings.SplitN(clean, "/", 2)
+	if len(parts) < 2 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+func walkArchive(archive string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("reading chart archive '%s': %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading chart archive '%s': %w", archive, err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// copyChart copies the chart directory src to dest, replacing whatever existed
+// there before
+func copyChart(src, dest string) error {
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type().IsRegular():
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, 0644)
+		}
+		return nil
+	})
+}
+
+// dirChartName returns the name of the chart in dir, as set in its Chart.yaml
+func dirChartName(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return "", fmt.Errorf("reading chart manifest: %w", err)
+	}
+	var m chartManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return "", fmt.Errorf("unmarshalling chart manifest: %w", err)
+	}
+	if m.Name == "" {
+		return "", fmt.Errorf("chart at '%s' has no name", dir)
+	}
+	return m.Name, nil
+}
@@ -1,6 +1,8 @@
 package helm
 
 import (
+	"encoding/json"
+
 	"github.com/Masterminds/semver"
 )
 
@@ -56,11 +58,48 @@ func (r Repos) Has(repo Repo) bool {
 	return false
 }
 
-// Requirement describes a single required Helm Chart.
-// Both, Chart and Version are required
+// Requirement describes a single required Helm Chart. Chart is one of:
+//
+// - `repo/chart`: a chart of a repository of the Chartfile
+// - `oci://registry/path/chart`: a chart of an OCI registry
+// - `./path/chart-1.0.0.tgz`: a local chart archive, relative to the Chartfile
+// - `./path/chart`: a local chart directory, relative to the Chartfile
+//
+// Version is required for charts of repositories and registries. Local charts
+// are vendored as they are.
 type Requirement struct {
 	Chart   string         `json:"chart"`
 	Version semver.Version `json:"version"`
+
+	// Digest optionally pins the chart to the sha256 of its archive
+	// ("sha256:<hex>"). For OCI charts, this is the digest of the chart
+	// layer. For local directories, it covers the paths and contents of all
+	// files.
+	Digest string `json:"digest,omitempty"`
+}
+
+var zeroVersion = semver.Version{}
+
+// String returns r in the form accepted by `tk tool charts add`
+func (r Requirement) String() string {
+	if v := r.versionString(); v != "" {
+		return r.Chart + "@" + v
+	}
+	return r.Chart
+}
+
+// MarshalJSON omits the Version of local charts
+func (r Requirement) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Chart   string          `json:"chart"`
+		Version *semver.Version `json:"version,omitempty"`
+		Digest  string          `json:"digest,omitempty"`
+	}{Chart: r.Chart, Digest: r.Digest}
+
+	if !r.Version.Equal(&zeroVersion) {
+		out.Version = &r.Version
+	}
+	return json.Marshal(out)
 }
 
 // Requirements is an aggregate of all required Charts
@@ -33,8 +33,13 @@ func (h ExecHelm) Template(name, chart string, opts TemplateOpts) (manifest.List
 		return nil, errors.Wrap(err, "Expanding Helm Chart")
 	}
 
+	return parseManifests(&buf)
+}
+
+// parseManifests parses the YAML stream of rendered manifests of a chart
+func parseManifests(r io.Reader) (manifest.List, error) {
 	var list manifest.List
-	d := yaml.NewDecoder(&buf)
+	d := yaml.NewDecoder(r)
 	for {
 		var m manifest.Manifest
 		if err := d.Decode(&m); err != nil {
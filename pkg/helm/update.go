@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Masterminds/semver"
+)
+
+// Level is how far Charts.Update may move a chart
+type Level int
+
+const (
+	// LevelMajor updates to the latest version
+	LevelMajor Level = iota
+	// LevelMinor updates to the latest version of the same major version
+	LevelMinor
+	// LevelPatch updates to the latest version of the same minor version
+	LevelPatch
+)
+
+// ChartVersions are the versions of a chart available in its repository,
+// relative to the required one
+type ChartVersions struct {
+	Chart   string
+	Current semver.Version
+
+	// Latest version of the same minor version, same major version and
+	// overall. Equal to Current if there is nothing newer
+	Patch semver.Version
+	Minor semver.Version
+	Major semver.Version
+}
+
+// Latest returns the newest version within level
+func (v ChartVersions) Latest(level Level) semver.Version {
+	switch level {
+	case LevelPatch:
+		return v.Patch
+	case LevelMinor:
+		return v.Minor
+	default:
+		return v.Major
+	}
+}
+
+// Outdated reports whether a newer version is available
+func (v ChartVersions) Outdated() bool {
+	return v.Major.GreaterThan(&v.Current)
+}
+
+// Versions looks up the available versions of the required charts in the
+// index.yaml of their repositories. Only charts of repositories are
+// considered, as OCI registries and local charts have no index. If charts is
+// not empty, only these are looked up.
+func (c Charts) Versions(charts ...string) ([]ChartVersions, error) {
+	reqs, err := c.selectRequirements(charts)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]*Index)
+	var out []ChartVersions
+	for _, r := range reqs {
+		if r.Source() != SourceRepo {
+			continue
+		}
+
+		index, _, err := c.repoIndex(r, indexes)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, versions(r, index.Entries[r.name()]))
+	}
+	return out, nil
+}
+
+// versions finds the latest patch, minor and major versions of r in entries.
+// Pre-releases are skipped, unless r itself is one.
+func versions(r Requirement, entries []IndexEntry) ChartVersions {
+	v := ChartVersions{Chart: r.Chart, Current: r.Version, Patch: r.Version, Minor: r.Version, Major: r.Version}
+	for _, e := range entries {
+		ver, err := semver.NewVersion(e.Version)
+		if err != nil {
+			continue
+		}
+		if ver.Prerelease() != "" && r.Version.Prerelease() == "" {
+			continue
+		}
+
+		if ver.GreaterThan(&v.Major) {
+			v.Major = *ver
+		}
+		if ver.Major() != r.Version.Major() {
+			continue
+		}
+		if ver.GreaterThan(&v.Minor) {
+			v.Minor = *ver
+		}
+		if ver.Minor() != r.Version.Minor() {
+			continue
+		}
+		if ver.GreaterThan(&v.Patch) {
+			v.Patch = *ver
+		}
+	}
+	return v
+}
+
+// Update moves the required charts to their latest version within level,
+// writes the Chartfile and runs Vendor afterwards. If charts is not empty,
+// only these are updated.
+//
+// Digests pinned for updated charts no longer apply and are removed.
+func (c *Charts) Update(level Level, charts ...string) error {
+	all, err := c.Versions(charts...)
+	if err != nil {
+		return err
+	}
+
+	latest := make(map[string]semver.Version)
+	for _, v := range all {
+		latest[v.Chart+"@"+v.Current.String()] = v.Latest(level)
+	}
+
+	log.Println("Updating Charts ...")
+	updated := 0
+	for i, r := range c.Manifest.Requires {
+		v, ok := latest[r.String()]
+		if !ok || !v.GreaterThan(&r.Version) {
+			continue
+		}
+
+		next := Requirement{Chart: r.Chart, Version: v}
+		if c.Manifest.Requires.Has(next) {
+			skip(r.String(), fmt.Errorf("%s is already required", next))
+			continue
+		}
+
+		log.Printf(" %s -> %s", r, v.String())
+		if r.Digest != "" {
+			log.Printf(" Removing the digest pinned for %s", r.Chart)
+		}
+		c.Manifest.Requires[i] = next
+		updated++
+	}
+
+	if updated == 0 {
+		log.Println("All Charts are up to date")
+		return nil
+	}
+
+	if err := write(c.Manifest, c.ManifestFile()); err != nil {
+		return err
+	}
+
+	log.Printf("Updated %v Charts in %s. Vendoring ...", updated, Filename)
+	return c.Vendor(VendorOpts{})
+}
+
+// selectRequirements returns the requirements of the given charts, or all if
+// none are given
+func (c Charts) selectRequirements(charts []string) (Requirements, error) {
+	if len(charts) == 0 {
+		return c.Manifest.Requires, nil
+	}
+
+	var out Requirements
+	for _, chart := range charts {
+		found := false
+		for _, r := range c.Manifest.Requires {
+			if r.Chart == chart {
+				out = append(out, r)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("chart '%s' is not required in %s", chart, Filename)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	available := []string{"1.2.3", "1.2.4", "1.2.5-rc.1", "1.3.0", "1.4.1", "2.0.0", "2.1.0", "3.0.0-beta.1", "invalid"}
+	entries := make([]IndexEntry, 0, len(available))
+	for _, v := range available {
+		entries = append(entries, IndexEntry{Version: v})
+	}
+
+	cases := []struct {
+		name                string
+		current             string
+		patch, minor, major string
+		wantOutdated        bool
+	}{
+		{name: "outdated", current: "1.2.3", patch: "1.2.4", minor: "1.4.1", major: "2.1.0", wantOutdated: true},
+		{name: "latest-minor", current: "1.4.1", patch: "1.4.1", minor: "1.4.1", major: "2.1.0", wantOutdated: true},
+		{name: "latest", current: "2.1.0", patch: "2.1.0", minor: "2.1.0", major: "2.1.0"},
+		{name: "prerelease", current: "1.2.5-rc.0", patch: "1.2.5-rc.1", minor: "1.4.1", major: "3.0.0-beta.1", wantOutdated: true},
+		{name: "unknown", current: "0.1.0", patch: "0.1.0", minor: "0.1.0", major: "2.1.0", wantOutdated: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := versions(Requirement{Chart: "stable/chart", Version: *semver.MustParse(c.current)}, entries)
+			assert.Equal(t, c.patch, v.Patch.String())
+			assert.Equal(t, c.minor, v.Minor.String())
+			assert.Equal(t, c.major, v.Major.String())
+			assert.Equal(t, c.wantOutdated, v.Outdated())
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	repo := testRepo(t, map[string][]string{
+		"a": {"1.0.0", "1.0.1", "1.1.0", "2.0.0"},
+		"b": {"0.1.0", "0.2.0"},
+	})
+
+	tmp := t.TempDir()
+	require.NoError(t, writeChartArchive(filepath.Join(tmp, "a.tgz"), "a", "1.0.0"))
+	digest, err := digestFile(filepath.Join(tmp, "a.tgz"))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		level  Level
+		charts []string
+		want   []string
+		err    string
+	}{
+		{name: "major", level: LevelMajor, want: []string{"stable/a@2.0.0", "stable/b@0.2.0", "./local"}},
+		{name: "minor", level: LevelMinor, want: []string{"stable/a@1.1.0", "stable/b@0.2.0", "./local"}},
+		{name: "patch", level: LevelPatch, want: []string{"stable/a@1.0.1", "stable/b@0.1.0", "./local"}},
+		{name: "selected", level: LevelMajor, charts: []string{"stable/b"}, want: []string{"stable/a@1.0.0", "stable/b@0.2.0", "./local"}},
+		{name: "unknown", level: LevelMajor, charts: []string{"stable/c"}, err: "chart 'stable/c' is not required in chartfile.yaml"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			charts, err := InitChartfile(filepath.Join(dir, Filename))
+			require.NoError(t, err)
+			charts.Helm = &fakeHelm{}
+			charts.Manifest.Repositories[0].URL = repo
+
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "local"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "local/Chart.yaml"), []byte("name: local\nversion: 0.0.1\n"), 0644))
+			charts.Manifest.Requires = Requirements{
+				{Chart: "stable/a", Version: *semver.MustParse("1.0.0"), Digest: digest},
+				{Chart: "stable/b", Version: *semver.MustParse("0.1.0")},
+				{Chart: "./local"},
+			}
+			require.NoError(t, write(charts.Manifest, charts.ManifestFile()))
+
+			err = charts.Update(c.level, c.charts...)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+
+			// the chartfile was rewritten
+			loaded, err := LoadChartfile(dir)
+			require.NoError(t, err)
+			var got []string
+			for _, r := range loaded.Manifest.Requires {
+				got = append(got, r.String())
+			}
+			assert.Equal(t, c.want, got)
+
+			// updated charts lose their digest
+			if got[0] == "stable/a@1.0.0" {
+				assert.Equal(t, digest, loaded.Manifest.Requires[0].Digest)
+			} else {
+				assert.Empty(t, loaded.Manifest.Requires[0].Digest)
+			}
+
+			// and were vendored
+			lock, err := charts.LoadLock()
+			require.NoError(t, err)
+			var locked []string
+			for _, l := range lock.Charts {
+				locked = append(locked, Requirement{Chart: l.Chart, Version: *semverOrZero(l.Version)}.String())
+			}
+			assert.Equal(t, c.want, locked)
+		})
+	}
+}
+
+func semverOrZero(s string) *semver.Version {
+	if s == "" {
+		return &semver.Version{}
+	}
+	return semver.MustParse(s)
+}
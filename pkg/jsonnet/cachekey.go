@@ -0,0 +1,139 @@
+package jsonnet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	jsonnet "github.com/google/go-jsonnet"
+)
+
+// CacheVersion is part of every cache key, so that evaluations are never
+// reused by a different version of Tanka. Package tanka sets it to its
+// version.
+var CacheVersion string
+
+// cacheKey returns the key the evaluation of data (found at path) is cached
+// at. It changes whenever anything the evaluation depends on changes: the
+// contents of all files it imports (transitively), the Helm charts and
+// Kustomizations next to them, the ext and top level arguments and the
+// version of Tanka.
+//
+// Paths are relative to root, so that projects checked out at different
+// locations share the same keys.
+func cacheKey(vm *jsonnet.VM, root, path, data string, opts Opts) (string, error) {
+	node, err := jsonnet.SnippetToAST(path, data)
+	if err != nil {
+		return "", err
+	}
+	imports := make(map[string]bool)
+	if err := importRecursive(imports, vm, node, path); err != nil {
+		return "", err
+	}
+
+	files := make([]string, 0, len(imports))
+	for file := range imports {
+		files = append(files, file)
+	}
+	inputs, err := NativeInputs(root, files)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, inputs...)
+	sort.Strings(files)
+
+	h := sha256.New()
+	writeField(h, "version", CacheVersion)
+	writeField(h, "path", relTo(root, path))
+	writeField(h, "data", data)
+	for _, k := range opts.ExtCode.keys() {
+		writeField(h, "ext", k, opts.ExtCode[k])
+	}
+	for _, k := range opts.TLACode.keys() {
+		writeField(h, "tla", k, opts.TLACode[k])
+	}
+	for _, file := range files {
+		sum, err := fileHash(file)
+		if err != nil {
+			return "", err
+		}
+		writeField(h, "file", relTo(root, file), sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeField writes a length-prefixed field to h, so that different
+// sequences of values never result in the same hash
+func writeField(h hash.Hash, name string, values ...string) {
+	fmt.Fprintf(h, "%s:%d\n", name, len(values))
+	for _, v := range values {
+		fmt.Fprintf(h, "%d:%s\n", len(v), v)
+	}
+}
+
+func relTo(root, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (i InjectedCode) keys() []string {
+	keys := make([]string, 0, len(i))
+	for k := range i {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fileHashes memoizes the contents hash of files. Entries are only reused
+// while the size and modification time of the file stay the same.
+var fileHashes sync.Map
+
+type fileHashEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func fileHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if got, ok := fileHashes.Load(path); ok {
+		e := got.(fileHashEntry)
+		if e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+			return e.sum, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	fileHashes.Store(path, fileHashEntry{size: info.Size(), modTime: info.ModTime(), sum: sum})
+	return sum, nil
+}
@@ -0,0 +1,94 @@
+package jsonnet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+)
+
+func TestCacheKey(t *testing.T) {
+	files := map[string]string{
+		"jsonnetfile.json":              "{}",
+		"environments/a/main.jsonnet":   "import 'lib.libsonnet'",
+		"environments/a/lib.libsonnet":  "{ a: importstr 'data.txt' }",
+		"environments/a/data.txt":       "data",
+		"environments/a/chartfile.yaml": "version: 1\nrepositories: []\nrequires: []\n",
+		"environments/b/main.jsonnet":   "{}",
+	}
+
+	project := func(t *testing.T) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		return dir
+	}
+
+	key := func(t *testing.T, dir string, opts Opts) string {
+		path := filepath.Join(dir, "environments/a/main.jsonnet")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		importPaths, _, root, err := jpath.Resolve(path, false)
+		require.NoError(t, err)
+		opts.ImportPaths = importPaths
+
+		k, err := cacheKey(MakeVM(opts), root, path, string(data), opts)
+		require.NoError(t, err)
+		return k
+	}
+
+	dir := project(t)
+	base := key(t, dir, Opts{})
+
+	// stable, also across checkouts at different locations
+	assert.Equal(t, base, key(t, dir, Opts{}))
+	assert.Equal(t, base, key(t, project(t), Opts{}))
+
+	cases := []struct {
+		name   string
+		modify func(t *testing.T, dir string) Opts
+	}{
+		{name: "ext", modify: func(*testing.T, string) Opts { return Opts{ExtCode: InjectedCode{"foo": "1"}} }},
+		{name: "tla", modify: func(*testing.T, string) Opts { return Opts{TLACode: InjectedCode{"foo": "1"}} }},
+		{name: "import", modify: func(t *testing.T, dir string) Opts {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "environments/a/lib.libsonnet"), []byte("{ a: importstr 'data.txt', b: 1 }"), 0644))
+			return Opts{}
+		}},
+		{name: "importstr", modify: func(t *testing.T, dir string) Opts {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "environments/a/data.txt"), []byte("changed"), 0644))
+			return Opts{}
+		}},
+		{name: "chartfile", modify: func(t *testing.T, dir string) Opts {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "environments/a/chartfile.yaml"), []byte("version: 1\nrepositories: []\nrequires: []\ndirectory: vendored\n"), 0644))
+			return Opts{}
+		}},
+		{name: "version", modify: func(t *testing.T, _ string) Opts {
+			CacheVersion = "v0.0.0-test"
+			t.Cleanup(func() { CacheVersion = "" })
+			return Opts{}
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := project(t)
+			opts := c.modify(t, dir)
+			assert.NotEqual(t, base, key(t, dir, opts))
+		})
+	}
+
+	// files that are not imported don't matter
+	t.Run("unrelated", func(t *testing.T) {
+		dir := project(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "environments/b/main.jsonnet"), []byte("{ b: 1 }"), 0644))
+		assert.Equal(t, base, key(t, dir, Opts{}))
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/tanka/pkg/jsonnet/jpath"
 	"github.com/grafana/tanka/pkg/jsonnet/native"
+	"github.com/grafana/tanka/pkg/rendercache"
 )
 
 // Modifier allows to set optional parameters on the Jsonnet VM.
@@ -34,9 +35,22 @@ type Opts struct {
 	TLACode     InjectedCode
 	ImportPaths []string
 	EvalScript  string
-	CachePath   string
+	// CachePath is the directory or http(s):// URL of the evaluation cache
+	// (see NewEvalCache). Empty disables caching. Renders of helmTemplate and
+	// kustomizeBuild are stored there as well, for all paths
+	CachePath string
 
 	CachePathRegexes []*regexp.Regexp
+
+	// CacheMaxSize is the size in bytes the cache at CachePath is limited to.
+	// 0 uses DefaultEvalCacheMaxSize, negative values disable the limit
+	CacheMaxSize int64
+
+	// VMPool reuses VMs between evaluations, if set
+	VMPool *VMPool
+
+	// Profile records the time spent evaluating, if set
+	Profile *Profile
 }
 
 // PathIsCached determines if a given path is matched by any of the configured cached path regexes
@@ -70,6 +84,10 @@ func (o Opts) Clone() Opts {
 
 		CachePath:        o.CachePath,
 		CachePathRegexes: o.CachePathRegexes,
+		CacheMaxSize:     o.CacheMaxSize,
+
+		VMPool:  o.VMPool,
+		Profile: o.Profile,
 	}
 }
 
@@ -78,8 +96,12 @@ func (o Opts) Clone() Opts {
 // - extCode and tlaCode applied
 // - native functions registered
 func MakeVM(opts Opts) *jsonnet.VM {
+	return makeVM(opts, NewExtendedImporter(opts.ImportPaths))
+}
+
+func makeVM(opts Opts, importer jsonnet.Importer) *jsonnet.VM {
 	vm := jsonnet.MakeVM()
-	vm.Importer(NewExtendedImporter(opts.ImportPaths))
+	vm.Importer(importer)
 
 	for k, v := range opts.ExtCode {
 		vm.ExtCode(k, v)
@@ -88,8 +110,19 @@ func MakeVM(opts Opts) *jsonnet.VM {
 		vm.TLACode(k, v)
 	}
 
-	for _, nf := range native.Funcs() {
-		vm.NativeFunction(nf)
+	var store rendercache.Store
+	if cache := newEvalCache(opts); cache != nil {
+		store = cache
+	}
+	renders := rendercache.New(store)
+	renders.Version = CacheVersion
+	funcs := native.Funcs(renders)
+	if opts.Profile != nil {
+		opts.Profile.instrument(vm, importer, funcs)
+	} else {
+		for _, nf := range funcs {
+			vm.NativeFunction(nf)
+		}
 	}
 
 	if opts.MaxStack > 0 {
@@ -125,32 +158,58 @@ func Evaluate(path, data string, opts Opts) (string, error) {
 
 type evalFunc func(vm *jsonnet.VM) (string, error)
 
+// newEvalCache returns the cache at opts.CachePath, or nil if it is not set
+func newEvalCache(opts Opts) EvalCache {
+	if opts.CachePath == "" {
+		return nil
+	}
+
+	cache := NewEvalCache(opts.CachePath)
+	if fc, ok := cache.(*FileEvalCache); ok && opts.CacheMaxSize != 0 {
+		fc.MaxSize = opts.CacheMaxSize
+	}
+	return cache
+}
+
 func evaluateSnippet(evalFunc evalFunc, path, data string, opts Opts) (string, error) {
-	var cache *FileEvalCache
-	if opts.CachePath != "" && opts.PathIsCached(path) {
-		cache = NewFileEvalCache(opts.CachePath)
+	var cache EvalCache
+	if opts.PathIsCached(path) {
+		cache = newEvalCache(opts)
 	}
 
 	// Create VM
-	jpath, _, _, err := jpath.Resolve(path, false)
+	jpath, _, root, err := jpath.Resolve(path, false)
 	if err != nil {
 		return "", errors.Wrap(err, "resolving import paths")
 	}
 	opts.ImportPaths = jpath
-	vm := MakeVM(opts)
+
+	// pooled VMs may not be instrumented for profiling
+	var vm *jsonnet.VM
+	if opts.VMPool != nil && opts.Profile == nil {
+		var release func()
+		vm, release = opts.VMPool.get(opts)
+		defer release()
+	} else {
+		vm = MakeVM(opts)
+	}
 
 	var hash string
 	if cache != nil {
-		if hash, err = getSnippetHash(vm, path, data); err != nil {
+		if hash, err = cacheKey(vm, root, path, data, opts); err != nil {
 			return "", err
 		}
-		if v, err := cache.Get(hash); err != nil {
+		if v, err := LookupEvalCache(cache, hash); err != nil {
 			return "", err
 		} else if v != "" {
 			return v, nil
 		}
 	}
 
+	if opts.Profile != nil {
+		defer opts.Profile.timed(opts.Profile.vmID(vm), ProfileEvaluate, path, nil)()
+	}
+
 	content, err := evalFunc(vm)
 	if err != nil {
 		return "", err
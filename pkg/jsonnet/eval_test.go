@@ -77,9 +77,10 @@ func TestEvaluateFileWithCaching(t *testing.T) {
 	assert.Equal(t, importTreeResult, result)
 
 	// Check that we have two entries in the cache
-	readCache, err := os.ReadDir(cachePath)
+	cache := NewFileEvalCache(cachePath)
+	entries, err := cache.Entries()
 	require.NoError(t, err)
-	assert.Len(t, readCache, 2)
+	assert.Len(t, entries, 2)
 
 	// Evaluate two files again, same result
 	result, err = EvaluateFile("testdata/thisFile/main.jsonnet", Opts{CachePath: cachePath})
@@ -90,15 +91,17 @@ func TestEvaluateFileWithCaching(t *testing.T) {
 	assert.Equal(t, importTreeResult, result)
 
 	// Modify the cache items
-	for _, entry := range readCache {
-		require.NoError(t, os.WriteFile(filepath.Join(cachePath, entry.Name()), []byte(entry.Name()), 0666))
+	modified, err := encodeEntry("modified")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NoError(t, os.WriteFile(entry.Path, modified, 0666))
 	}
 
 	// Evaluate two files again, modified cache is returned instead of the actual result
 	result, err = EvaluateFile("testdata/thisFile/main.jsonnet", Opts{CachePath: cachePath})
 	assert.NoError(t, err)
-	assert.Equal(t, "BYfdlr1ZOVwiOfbd89JYTcK-eRQh05bi8ky3k1vVW5o=.json", result)
+	assert.Equal(t, "modified", result)
 	result, err = EvaluateFile("testdata/importTree/main.jsonnet", Opts{CachePath: cachePath})
 	assert.NoError(t, err)
-	assert.Equal(t, "R_3hy-dRfOwXN-fezQ50ZF4dnrFcBcbQ9LztR_XWzJA=.json", result)
+	assert.Equal(t, "modified", result)
 }
@@ -1,48 +1,423 @@
 package jsonnet
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// FileEvalCache is an evaluation cache that stores its data on the local filesystem
+// EvalCache stores the results of evaluations. Keys change whenever anything
+// an evaluation depends on changes, so entries never need to be invalidated.
+type EvalCache interface {
+	// Get returns the entry at key, or "" if there is none
+	Get(key string) (string, error)
+	// Store sets the entry at key to content
+	Store(key, content string) error
+}
+
+// NewEvalCache returns the cache at path: a HTTPEvalCache for http:// and
+// https:// URLs, a FileEvalCache otherwise
+func NewEvalCache(path string) EvalCache {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return NewHTTPEvalCache(path)
+	}
+	return NewFileEvalCache(path)
+}
+
+// ErrCorruptCacheEntry means an entry could not be read back as it was stored
+type ErrCorruptCacheEntry struct {
+	Key string
+	Err error
+}
+
+func (e ErrCorruptCacheEntry) Error() string {
+	return fmt.Sprintf("cache entry '%s' is corrupt: %s", e.Key, e.Err)
+}
+
+// encodeEntry compresses content for storing it in a cache
+func encodeEntry(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry decompresses an entry created by encodeEntry. gzip includes a
+// checksum of the content, so corrupted entries fail to decode.
+func decodeEntry(key string, data []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrCorruptCacheEntry{Key: key, Err: err}
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", ErrCorruptCacheEntry{Key: key, Err: err}
+	}
+	return string(content), nil
+}
+
+// DefaultEvalCacheMaxSize is the size in bytes FileEvalCaches are limited to,
+// unless configured otherwise
+const DefaultEvalCacheMaxSize int64 = 1 << 30
+
+// FileEvalCache is an evaluation cache that stores its data on the local
+// filesystem. Each entry is a compressed file named after its key, in a
+// subdirectory named after the first two characters of it.
+//
+// The modification time of entries is updated whenever they are read. Once the
+// cache grows beyond MaxSize, the least recently used entries are removed.
 type FileEvalCache struct {
 	Directory string
+
+	// MaxSize is the size in bytes the cache is pruned to after storing an
+	// entry. Values <= 0 disable the limit
+	MaxSize int64
 }
 
+// NewFileEvalCache returns a FileEvalCache at cachePath, limited to
+// DefaultEvalCacheMaxSize
 func NewFileEvalCache(cachePath string) *FileEvalCache {
 	return &FileEvalCache{
 		Directory: cachePath,
+		MaxSize:   DefaultEvalCacheMaxSize,
 	}
 }
 
+const evalCacheExt = ".json.gz"
+
+// legacyEvalCacheExt is the extension of uncompressed entries of previous
+// versions. These are never read, but pruned like all others
+const legacyEvalCacheExt = ".json"
+
 func (c *FileEvalCache) cachePath(hash string) (string, error) {
-	return filepath.Abs(filepath.Join(c.Directory, hash+".json"))
+	shard := "_"
+	if len(hash) > 2 {
+		shard = hash[:2]
+	}
+	return filepath.Abs(filepath.Join(c.Directory, shard, hash+evalCacheExt))
 }
 
+// Get returns the entry at hash. If it does not exist, "" is returned.
 func (c *FileEvalCache) Get(hash string) (string, error) {
 	cachePath, err := c.cachePath(hash)
 	if err != nil {
 		return "", err
 	}
 
-	if bytes, err := os.ReadFile(cachePath); err == nil {
-		return string(bytes), err
-	} else if !os.IsNotExist(err) {
+	data, err := os.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
 		return "", err
 	}
-	return "", nil
+
+	content, err := decodeEntry(hash, data)
+	if err != nil {
+		// evaluate again, which replaces the entry
+		log.Printf("Warning: %s, ignoring it", err)
+		return "", nil
+	}
+
+	// mark as recently used. Failing to do so only affects pruning
+	now := time.Now()
+	_ = os.Chtimes(cachePath, now, now)
+
+	return content, nil
 }
 
+// Store sets the entry at hash to content
 func (c *FileEvalCache) Store(hash, content string) error {
-	if err := os.MkdirAll(c.Directory, os.ModePerm); err != nil {
+	cachePath, err := c.cachePath(hash)
+	if err != nil {
 		return err
 	}
 
-	cachePath, err := c.cachePath(hash)
+	data, err := encodeEntry(content)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so concurrent readers never see partial
+	// entries
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return c.limit(int64(len(data)))
+}
+
+// evalCacheSizes tracks the size of the caches used by this process, so that
+// Store does not need to walk the cache each time. Keyed by absolute directory.
+var evalCacheSizes sync.Map
+
+type evalCacheSize struct {
+	mu    sync.Mutex
+	known bool
+	size  int64
+}
+
+// limit prunes the cache if storing added bytes made it exceed MaxSize
+func (c *FileEvalCache) limit(added int64) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	dir, err := filepath.Abs(c.Directory)
+	if err != nil {
+		return err
+	}
+	got, _ := evalCacheSizes.LoadOrStore(dir, &evalCacheSize{})
+	s := got.(*evalCacheSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.known {
+		usage, err := c.Usage()
+		if err != nil {
+			return err
+		}
+		s.known, s.size = true, usage.Size
+	} else {
+		s.size += added
+	}
+
+	if s.size <= c.MaxSize {
+		return nil
+	}
+
+	// the cache may be used by other processes as well, so prune based on its
+	// actual contents
+	if _, err := c.Prune(c.MaxSize, 0); err != nil {
+		return err
+	}
+	usage, err := c.Usage()
 	if err != nil {
 		return err
 	}
+	s.size = usage.Size
+	return nil
+}
+
+// EvalCacheEntry is a single entry of a FileEvalCache
+type EvalCacheEntry struct {
+	Path string
+	Size int64
+	// Used is when the entry was last stored or read
+	Used time.Time
+}
+
+// Entries returns all entries of the cache, least recently used first
+func (c *FileEvalCache) Entries() ([]EvalCacheEntry, error) {
+	var entries []EvalCacheEntry
+	err := filepath.WalkDir(c.Directory, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == c.Directory {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if !strings.HasSuffix(path, evalCacheExt) && filepath.Ext(path) != legacyEvalCacheExt {
+			return nil
+		}
+
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			// removed concurrently
+			return nil
+		} else if err != nil {
+			return err
+		}
+		entries = append(entries, EvalCacheEntry{Path: path, Size: info.Size(), Used: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Used.Before(entries[j].Used) })
+	return entries, nil
+}
+
+// EvalCacheUsage summarizes a set of cache entries
+type EvalCacheUsage struct {
+	Entries int
+	Size    int64
+
+	// Oldest and Newest are the times the least and most recently used
+	// entries were used
+	Oldest, Newest time.Time
+}
+
+func (u *EvalCacheUsage) add(e EvalCacheEntry) {
+	if u.Entries == 0 || e.Used.Before(u.Oldest) {
+		u.Oldest = e.Used
+	}
+	if e.Used.After(u.Newest) {
+		u.Newest = e.Used
+	}
+	u.Entries++
+	u.Size += e.Size
+}
+
+// Usage returns the number and size of all entries of the cache
+func (c *FileEvalCache) Usage() (EvalCacheUsage, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return EvalCacheUsage{}, err
+	}
+
+	var usage EvalCacheUsage
+	for _, e := range entries {
+		usage.add(e)
+	}
+	return usage, nil
+}
+
+// Prune removes the least recently used entries until the cache is at most
+// maxSize bytes large, and all entries not used within maxAge. Zero values
+// disable either limit. It returns what was removed.
+func (c *FileEvalCache) Prune(maxSize int64, maxAge time.Duration) (EvalCacheUsage, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return EvalCacheUsage{}, err
+	}
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+
+	var removed EvalCacheUsage
+	for _, e := range entries {
+		tooBig := maxSize > 0 && size > maxSize
+		tooOld := maxAge > 0 && time.Since(e.Used) > maxAge
+		if !tooBig && !tooOld {
+			// entries are ordered by use, so all following ones are newer
+			break
+		}
+
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		size -= e.Size
+		removed.add(e)
+	}
+
+	return removed, nil
+}
+
+// Clear removes all entries of the cache. Other files in its directory are
+// kept.
+func (c *FileEvalCache) Clear() (EvalCacheUsage, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return EvalCacheUsage{}, err
+	}
+
+	var removed EvalCacheUsage
+	for _, e := range entries {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed.add(e)
+	}
+
+	// remove emptied shards. Fails for those holding other files, which is
+	// intended
+	dirs, err := os.ReadDir(c.Directory)
+	if err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+	for _, d := range dirs {
+		if d.IsDir() && (len(d.Name()) == 2 || d.Name() == "_") {
+			_ = os.Remove(filepath.Join(c.Directory, d.Name()))
+		}
+	}
+
+	return removed, nil
+}
+
+var evalCacheStats struct {
+	hits, misses int64
+}
+
+func countLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&evalCacheStats.hits, 1)
+	} else {
+		atomic.AddInt64(&evalCacheStats.misses, 1)
+	}
+}
+
+// LookupEvalCache returns the entry of an evaluation at key, like cache.Get,
+// and counts it in the EvalCacheStats. Other entries, like renders of
+// helmTemplate, are read using Get, so they are not counted.
+func LookupEvalCache(cache EvalCache, key string) (string, error) {
+	v, err := cache.Get(key)
+	if err != nil {
+		return "", err
+	}
+	countLookup(v != "")
+	return v, nil
+}
+
+// EvalCacheStats counts the evaluations looked up using LookupEvalCache
+type EvalCacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// ReadEvalCacheStats returns the number of cache lookups so far
+func ReadEvalCacheStats() EvalCacheStats {
+	return EvalCacheStats{
+		Hits:   atomic.LoadInt64(&evalCacheStats.hits),
+		Misses: atomic.LoadInt64(&evalCacheStats.misses),
+	}
+}
 
-	return os.WriteFile(cachePath, []byte(content), 0644)
+// Since returns the lookups that happened after prev was read
+func (s EvalCacheStats) Since(prev EvalCacheStats) EvalCacheStats {
+	return EvalCacheStats{Hits: s.Hits - prev.Hits, Misses: s.Misses - prev.Misses}
 }
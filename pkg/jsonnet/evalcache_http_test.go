@@ -0,0 +1,106 @@
+package jsonnet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobServer is a stand-in for a remote cache, storing PUT bodies in memory
+type blobServer struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+	fail  bool
+}
+
+func (s *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		b, ok := s.blobs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.blobs[r.URL.Path] = b
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPEvalCache(t *testing.T) {
+	blobs := &blobServer{blobs: make(map[string][]byte)}
+	srv := httptest.NewServer(blobs)
+	defer srv.Close()
+
+	c := NewEvalCache(srv.URL + "/tanka/")
+	require.IsType(t, &HTTPEvalCache{}, c)
+
+	get := func(key string) string {
+		got, err := c.Get(key)
+		require.NoError(t, err)
+		return got
+	}
+
+	assert.Equal(t, "", get("key"))
+
+	require.NoError(t, c.Store("key", "content"))
+	require.NoError(t, c.Store("other", "content"))
+	assert.Equal(t, "content", get("key"))
+
+	// entries are content-addressed, so equal ones are stored once
+	var cas []string
+	for path := range blobs.blobs {
+		if strings.HasPrefix(path, "/tanka/cas/") {
+			cas = append(cas, path)
+		}
+	}
+	require.Len(t, cas, 1)
+	assert.Equal(t, "/tanka/cas/"+string(blobs.blobs["/tanka/ac/key"]), cas[0])
+
+	// tampered entries are misses
+	blobs.blobs[cas[0]] = []byte("tampered")
+	assert.Equal(t, "", get("key"))
+	blobs.blobs["/tanka/ac/key"] = []byte("../../etc/passwd")
+	assert.Equal(t, "", get("key"))
+
+	// an unavailable cache does not fail evaluations
+	blobs.fail = true
+	assert.Equal(t, "", get("other"))
+	assert.NoError(t, c.Store("other", "content"))
+}
+
+func TestHTTPEvalCacheEvaluate(t *testing.T) {
+	blobs := &blobServer{blobs: make(map[string][]byte)}
+	srv := httptest.NewServer(blobs)
+	defer srv.Close()
+
+	opts := Opts{CachePath: srv.URL}
+	before := ReadEvalCacheStats()
+	for i := 0; i < 2; i++ {
+		result, err := EvaluateFile("testdata/importTree/main.jsonnet", opts)
+		require.NoError(t, err)
+		assert.Equal(t, importTreeResult, result)
+	}
+	assert.Equal(t, EvalCacheStats{Hits: 1, Misses: 1}, ReadEvalCacheStats().Since(before))
+}
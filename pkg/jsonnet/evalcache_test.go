@@ -0,0 +1,161 @@
+package jsonnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/rendercache"
+)
+
+// storeAged stores equal entries, used one hour apart in the given order
+// (first is least recently used). It returns the size of each entry.
+func storeAged(t *testing.T, c *FileEvalCache, keys ...string) int64 {
+	var size int64
+	start := time.Now().Add(-time.Duration(len(keys)) * time.Hour)
+	for i, key := range keys {
+		require.NoError(t, c.Store(key, strings.Repeat("x", 10)))
+
+		path, err := c.cachePath(key)
+		require.NoError(t, err)
+		used := start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, used, used))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		size = info.Size()
+	}
+	return size
+}
+
+func entryKeys(t *testing.T, c *FileEvalCache) []string {
+	entries, err := c.Entries()
+	require.NoError(t, err)
+
+	keys := []string{}
+	for _, e := range entries {
+		keys = append(keys, strings.TrimSuffix(filepath.Base(e.Path), evalCacheExt))
+	}
+	return keys
+}
+
+func TestFileEvalCache(t *testing.T) {
+	c := NewFileEvalCache(t.TempDir())
+	c.MaxSize = 0
+
+	before := ReadEvalCacheStats()
+	got, err := LookupEvalCache(c, "abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+
+	require.NoError(t, c.Store("abcdef", "content"))
+	got, err = LookupEvalCache(c, "abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "content", got)
+
+	assert.Equal(t, EvalCacheStats{Hits: 1, Misses: 1}, ReadEvalCacheStats().Since(before))
+
+	// entries are sharded by the start of their key
+	path := filepath.Join(c.Directory, "ab", "abcdef.json.gz")
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+
+	// corrupt entries are misses
+	require.NoError(t, os.WriteFile(path, []byte("corrupt"), 0644))
+	got, err = LookupEvalCache(c, "abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+	assert.Equal(t, EvalCacheStats{Hits: 1, Misses: 2}, ReadEvalCacheStats().Since(before))
+
+	// other lookups, like renders of helmTemplate, are not counted
+	_, err = c.Get("other")
+	require.NoError(t, err)
+	_, err = rendercache.New(c).Render("render", func() (manifest.List, error) {
+		return manifest.List{{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "config"}}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, EvalCacheStats{Hits: 1, Misses: 2}, ReadEvalCacheStats().Since(before))
+}
+
+func TestDecodeEntry(t *testing.T) {
+	data, err := encodeEntry("content")
+	require.NoError(t, err)
+
+	got, err := decodeEntry("key", data)
+	require.NoError(t, err)
+	assert.Equal(t, "content", got)
+
+	// flip a bit of the compressed content
+	data[len(data)/2] ^= 1
+	_, err = decodeEntry("key", data)
+	assert.IsType(t, ErrCorruptCacheEntry{}, err)
+
+	_, err = decodeEntry("key", []byte("{}"))
+	assert.IsType(t, ErrCorruptCacheEntry{}, err)
+}
+
+func TestFileEvalCachePrune(t *testing.T) {
+	cases := []struct {
+		name string
+		// maxEntries is maxSize in multiples of the entry size
+		maxEntries float64
+		maxAge     time.Duration
+		want       []string
+	}{
+		{name: "size", maxEntries: 2.5, want: []string{"cc", "dd"}},
+		{name: "age", maxAge: 150 * time.Minute, want: []string{"cc", "dd"}},
+		{name: "both", maxEntries: 3.5, maxAge: 90 * time.Minute, want: []string{"dd"}},
+		{name: "none", want: []string{"aa", "bb", "cc", "dd"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cache := NewFileEvalCache(t.TempDir())
+			cache.MaxSize = 0
+			size := storeAged(t, cache, "aa", "bb", "cc", "dd")
+
+			_, err := cache.Prune(int64(c.maxEntries*float64(size)), c.maxAge)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, entryKeys(t, cache))
+		})
+	}
+}
+
+func TestFileEvalCacheLRU(t *testing.T) {
+	c := NewFileEvalCache(t.TempDir())
+	c.MaxSize = 0
+	size := storeAged(t, c, "aa", "bb", "cc")
+
+	// reading marks as recently used
+	_, err := c.Get("aa")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bb", "cc", "aa"}, entryKeys(t, c))
+
+	// storing beyond MaxSize removes the least recently used
+	c.MaxSize = 3 * size
+	require.NoError(t, c.Store("dd", strings.Repeat("x", 10)))
+	assert.Equal(t, []string{"cc", "aa", "dd"}, entryKeys(t, c))
+}
+
+func TestFileEvalCacheClear(t *testing.T) {
+	c := NewFileEvalCache(t.TempDir())
+	c.MaxSize = 0
+	size := storeAged(t, c, "aa", "bb")
+	require.NoError(t, os.WriteFile(filepath.Join(c.Directory, "other"), nil, 0644))
+
+	removed, err := c.Clear()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed.Entries)
+	assert.Equal(t, 2*size, removed.Size)
+
+	files, err := os.ReadDir(c.Directory)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "other", files[0].Name())
+}
@@ -19,6 +19,8 @@ const locationInternal = "<internal>"
 type ExtendedImporter struct {
 	loaders    []importLoader    // for loading jsonnet from somewhere. First one that returns non-nil is used
 	processors []importProcessor // for post-processing (e.g. yaml -> json)
+
+	onImport func(foundAt string) // called for each imported file, if set
 }
 
 // importLoader are executed before the actual importing. If they return
@@ -62,6 +64,10 @@ func (i *ExtendedImporter) Import(importedFrom, importedPath string) (contents j
 		}
 	}
 
+	if i.onImport != nil {
+		i.onImport(foundAt)
+	}
+
 	// check if needs postprocessing
 	for _, processor := range i.processors {
 		c, err := processor(contents.String(), foundAt)
@@ -0,0 +1,127 @@
+package jsonnet
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/tanka/pkg/helm"
+	"github.com/grafana/tanka/pkg/kustomize"
+)
+
+// NativeInputs returns the absolute paths of the files native functions may
+// read when called from any of files: the Helm charts (chartfile.yaml and
+// vendored charts) and Kustomizations next to them. Kustomizations are not
+// looked up in the vendor directory of root. Paths of files themselves are not
+// returned.
+func NativeInputs(root string, files []string) ([]string, error) {
+	set := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		dirs[filepath.Dir(f)] = true
+	}
+
+	vendor := filepath.Join(root, "vendor") + string(filepath.Separator)
+	for dir := range dirs {
+		inputs, err := helmInputs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		// vendored libraries don't hold Kustomizations
+		if !strings.HasPrefix(dir+string(filepath.Separator), vendor) {
+			k, err := kustomizeInputs(dir)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, k...)
+		}
+
+		for _, f := range inputs {
+			set[f] = true
+		}
+	}
+
+	for _, f := range files {
+		delete(set, f)
+	}
+
+	inputs := make([]string, 0, len(set))
+	for f := range set {
+		inputs = append(inputs, f)
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+// helmInputs returns the chartfile.yaml in dir and the charts it vendors
+func helmInputs(dir string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(dir, helm.Filename)); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	charts, err := helm.LoadChartfile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := WalkFiles(charts.ChartDir())
+	if err != nil {
+		return nil, err
+	}
+	return append(files, charts.ManifestFile()), nil
+}
+
+// kustomizeInputs returns all files of Kustomizations found below dir. Vendor
+// and hidden directories are skipped.
+func kustomizeInputs(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+
+		for _, name := range kustomize.KustomizationFiles {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				k, err := WalkFiles(path)
+				if err != nil {
+					return err
+				}
+				files = append(files, k...)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// WalkFiles returns all files below dir. It does not fail if dir does not
+// exist
+func WalkFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
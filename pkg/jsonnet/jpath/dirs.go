@@ -37,7 +37,7 @@ func FindRoot(path string) (dir string, err error) {
 	}
 
 	// try flake.nix first
-	root, err := FindParentFile("flake.nix", start, stop)
+	root, err := FindParentFile(FlakeFile, start, stop)
 	if err == nil {
 		return root, nil
 	}
@@ -67,10 +67,11 @@ func FindBase(path string, root string) (string, error) {
 		return "", err
 	}
 
-	// First, check for a flake.nix (for Nix support)
-	base, err := FindParentFile("flake.nix", dir, root)
-	if err == nil {
-		return base, nil
+	// First, check for the entrypoints of other languages, e.g. a flake.nix
+	for _, name := range entrypoints {
+		if base, err := FindParentFile(name, dir, root); err == nil {
+			return base, nil
+		}
 	}
 
 	filename, err := Filename(path)
@@ -78,7 +79,7 @@ func FindBase(path string, root string) (string, error) {
 		return "", err
 	}
 
-	base, err = FindParentFile(filename, dir, root)
+	base, err := FindParentFile(filename, dir, root)
 
 	if _, ok := err.(ErrorFileNotFound); ok {
 		return "", ErrorNoBase{filename: filename}
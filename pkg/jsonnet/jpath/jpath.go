@@ -7,6 +7,21 @@ import (
 
 const DEFAULT_ENTRYPOINT = "main.jsonnet"
 
+// FlakeFile marks an environment defined in a Nix flake
+const FlakeFile = "flake.nix"
+
+// entrypoints are files that mark the base directory of environments not
+// written in Jsonnet. They take precedence over the Jsonnet entrypoint
+var entrypoints = []string{FlakeFile}
+
+// RegisterEntrypoint registers filename as the entrypoint of environments
+// written in another language than Jsonnet, so that directories holding it are
+// recognized as an environment base directory. Must be called before any path
+// is resolved, e.g. from init()
+func RegisterEntrypoint(filename string) {
+	entrypoints = append(entrypoints, filename)
+}
+
 // Resolve the given path and resolves the jPath around it. This means it:
 // - figures out the project root (the one with .jsonnetfile, vendor/ and lib/)
 // - figures out the environments base directory (usually the main.jsonnet)
@@ -74,5 +89,21 @@ func Entrypoint(path string) (string, error) {
 		return "", err
 	}
 
-	return filepath.Join(base, filename), nil
+	// Environments written in other languages (e.g. Nix) have no Jsonnet
+	// entrypoint, their own one is evaluated instead
+	entrypoint := filepath.Join(base, filename)
+	if _, err := os.Stat(entrypoint); os.IsNotExist(err) {
+		for _, name := range entrypoints {
+			if other := filepath.Join(base, name); fileExists(other) {
+				return other, nil
+			}
+		}
+	}
+
+	return entrypoint, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
@@ -11,13 +11,15 @@ import (
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/tanka/pkg/helm"
 	"github.com/grafana/tanka/pkg/kustomize"
+	"github.com/grafana/tanka/pkg/rendercache"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v3"
 )
 
 // Funcs returns a slice of native Go functions that shall be available
-// from Jsonnet using `std.nativeFunc`
-func Funcs() []*jsonnet.NativeFunction {
+// from Jsonnet using `std.nativeFunc`. helmTemplate and kustomizeBuild memoize
+// their renders in cache, which may be nil to always render.
+func Funcs(cache *rendercache.Cache) []*jsonnet.NativeFunction {
 	return []*jsonnet.NativeFunction{
 		// Parse serialized data into dicts
 		parseJSON(),
@@ -32,8 +34,8 @@ func Funcs() []*jsonnet.NativeFunction {
 		regexMatch(),
 		regexSubst(),
 
-		helm.NativeFunc(helm.ExecHelm{}),
-		kustomize.NativeFunc(kustomize.ExecKustomize{}),
+		helm.NativeFunc(helm.Default(), cache),
+		kustomize.NativeFunc(kustomize.ExecKustomize{}, cache),
 	}
 }
 
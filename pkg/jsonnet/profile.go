@@ -0,0 +1,269 @@
+package jsonnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	jsonnet "github.com/google/go-jsonnet"
+)
+
+// Kinds of ProfileEvents
+const (
+	ProfileEvaluate = "evaluate"
+	ProfileRead     = "read"
+	ProfileNative   = "native"
+)
+
+// identifyingArgs are the number of leading arguments of native functions that
+// tell their invocations apart in a profile. Others are only recorded by name.
+var identifyingArgs = map[string]int{
+	"helmTemplate":   2, // name, chart
+	"kustomizeBuild": 1, // path
+}
+
+// Profile records where time is spent while evaluating Jsonnet: in whole
+// evaluations, reading imported files and calling native functions (such as
+// helmTemplate). Parsing and evaluating imported files is only part of the
+// whole evaluation, as go-jsonnet evaluates lazily. It is safe for concurrent
+// use.
+//
+// Set Opts.Profile to use it.
+type Profile struct {
+	mu     sync.Mutex
+	start  time.Time
+	vms    map[*jsonnet.VM]int
+	events []ProfileEvent
+}
+
+// ProfileEvent is a single timed operation
+type ProfileEvent struct {
+	Kind string
+	// Name is the file for evaluations and reads, the function name for
+	// native calls
+	Name string
+	// Args identify calls of some native functions, e.g. the chart of
+	// helmTemplate
+	Args []string
+
+	Start    time.Time
+	Duration time.Duration
+
+	// VM the event happened in. Each VM evaluates sequentially, so events of
+	// the same VM don't overlap (except evaluations, which contain the others)
+	VM int
+}
+
+// Label is the Name of e, including its Args
+func (e ProfileEvent) Label() string {
+	if len(e.Args) == 0 {
+		return e.Name
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(e.Args, ", "))
+}
+
+// NewProfile returns an empty Profile
+func NewProfile() *Profile {
+	return &Profile{start: time.Now(), vms: make(map[*jsonnet.VM]int)}
+}
+
+// Events returns all recorded events, ordered by their start
+func (p *Profile) Events() []ProfileEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := append([]ProfileEvent(nil), p.events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+func (p *Profile) record(e ProfileEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+}
+
+// timed records an event of kind and name that starts now. The returned
+// function ends it
+func (p *Profile) timed(vm int, kind, name string, args []string) func() {
+	start := time.Now()
+	return func() {
+		p.record(ProfileEvent{Kind: kind, Name: name, Args: args, Start: start, Duration: time.Since(start), VM: vm})
+	}
+}
+
+// vmID returns the number of vm, assigning the next one to unknown VMs
+func (p *Profile) vmID(vm *jsonnet.VM) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, ok := p.vms[vm]
+	if !ok {
+		id = len(p.vms) + 1
+		p.vms[vm] = id
+	}
+	return id
+}
+
+// instrument makes vm record reading imports and native function calls to p. It
+// must be called after all native functions were registered
+func (p *Profile) instrument(vm *jsonnet.VM, importer jsonnet.Importer, funcs []*jsonnet.NativeFunction) {
+	id := p.vmID(vm)
+	vm.Importer(profilingImporter{importer: importer, profile: p, vm: id})
+
+	for _, nf := range funcs {
+		wrapped := *nf
+		name, fn := nf.Name, nf.Func
+		wrapped.Func = func(args []interface{}) (interface{}, error) {
+			defer p.timed(id, ProfileNative, name, nativeArgs(name, args))()
+			return fn(args)
+		}
+		vm.NativeFunction(&wrapped)
+	}
+}
+
+func nativeArgs(name string, args []interface{}) []string {
+	n := identifyingArgs[name]
+	if n > len(args) {
+		n = len(args)
+	}
+
+	out := make([]string, 0, n)
+	for _, a := range args[:n] {
+		out = append(out, fmt.Sprint(a))
+	}
+	return out
+}
+
+// profilingImporter records the time spent reading each imported file. go-jsonnet
+// parses and evaluates it afterwards, outside of the importer.
+type profilingImporter struct {
+	importer jsonnet.Importer
+	profile  *Profile
+	vm       int
+}
+
+func (i profilingImporter) Import(importedFrom, importedPath string) (contents jsonnet.Contents, foundAt string, err error) {
+	start := time.Now()
+	contents, foundAt, err = i.importer.Import(importedFrom, importedPath)
+
+	name := foundAt
+	if name == "" {
+		name = importedPath
+	}
+	i.profile.record(ProfileEvent{Kind: ProfileRead, Name: name, Start: start, Duration: time.Since(start), VM: i.vm})
+	return contents, foundAt, err
+}
+
+// ProfileEntry is the total of all events of the same kind and label
+type ProfileEntry struct {
+	Kind  string
+	Label string
+	Calls int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Top returns the n entries with the highest total time, highest first. If n
+// is 0, all entries are returned.
+func (p *Profile) Top(n int) []ProfileEntry {
+	byLabel := make(map[string]*ProfileEntry)
+	var entries []*ProfileEntry
+	for _, e := range p.Events() {
+		key := e.Kind + "\x00" + e.Label()
+		entry, ok := byLabel[key]
+		if !ok {
+			entry = &ProfileEntry{Kind: e.Kind, Label: e.Label()}
+			byLabel[key] = entry
+			entries = append(entries, entry)
+		}
+		entry.Calls++
+		entry.Total += e.Duration
+		if e.Duration > entry.Max {
+			entry.Max = e.Duration
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Total > entries[j].Total })
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	out := make([]ProfileEntry, len(entries))
+	for i, e := range entries {
+		out[i] = *e
+	}
+	return out
+}
+
+// WriteTable writes the top n entries (see Top) as a table to w
+func (p *Profile) WriteTable(w io.Writer, n int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tTOTAL\tCALLS\tMAX\tNAME")
+	for _, e := range p.Top(n) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", e.Kind, e.Total.Round(time.Microsecond), e.Calls, e.Max.Round(time.Microsecond), e.Label)
+	}
+	return tw.Flush()
+}
+
+// traceEvent is a complete event ("ph": "X") of the Chrome trace event format
+type traceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteTrace writes the events in the Chrome trace event format to w, to be
+// viewed using chrome://tracing or https://ui.perfetto.dev. Each VM is shown
+// as a separate thread.
+func (p *Profile) WriteTrace(w io.Writer) error {
+	events := p.Events()
+	trace := struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+		Unit        string       `json:"displayTimeUnit"`
+	}{TraceEvents: make([]traceEvent, 0, len(events)), Unit: "ms"}
+
+	for _, e := range events {
+		te := traceEvent{
+			Name:      e.Label(),
+			Category:  e.Kind,
+			Phase:     "X",
+			Timestamp: e.Start.Sub(p.start).Microseconds(),
+			Duration:  e.Duration.Microseconds(),
+			PID:       1,
+			TID:       e.VM,
+		}
+		if e.Kind != ProfileNative {
+			te.Args = map[string]string{"file": e.Name}
+		}
+		trace.TraceEvents = append(trace.TraceEvents, te)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(trace)
+}
+
+// WriteTraceFile writes the trace (see WriteTrace) to the file at path
+func (p *Profile) WriteTraceFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.WriteTrace(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
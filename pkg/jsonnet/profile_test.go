@@ -0,0 +1,78 @@
+package jsonnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("jsonnetfile.json", "{}")
+	write("main.jsonnet", `
+local lib = import 'lib.libsonnet';
+{
+  a: lib.a,
+  b: std.native('parseJson')('{"b": 2}').b,
+  c: std.native('parseJson')('{"c": 3}').c,
+}`)
+	write("lib.libsonnet", "{ a: 1 }")
+
+	main := filepath.Join(dir, "main.jsonnet")
+	profile := NewProfile()
+	out, err := EvaluateFile(main, Opts{Profile: profile, VMPool: NewVMPool()})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": 1, "b": 2, "c": 3}`, out)
+
+	calls := make(map[string]int)
+	for _, e := range profile.Top(0) {
+		calls[e.Kind+" "+e.Label] = e.Calls
+	}
+	assert.Equal(t, map[string]int{
+		"evaluate " + main: 1,
+		"read " + main:     1,
+		"read " + filepath.Join(dir, "lib.libsonnet"): 1,
+		"native parseJson": 2,
+	}, calls)
+	assert.Len(t, profile.Top(1), 1)
+
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	var buf bytes.Buffer
+	require.NoError(t, profile.WriteTrace(&buf))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	require.Len(t, trace.TraceEvents, 5)
+	for _, e := range trace.TraceEvents {
+		assert.Equal(t, "X", e.Phase)
+		assert.Equal(t, 1, e.TID)
+	}
+}
+
+func TestNativeArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   string
+		args []interface{}
+		want []string
+	}{
+		{name: "helmTemplate", fn: "helmTemplate", args: []interface{}{"grafana", "./charts/grafana", map[string]interface{}{}}, want: []string{"grafana", "./charts/grafana"}},
+		{name: "kustomizeBuild", fn: "kustomizeBuild", args: []interface{}{"./kustomize", map[string]interface{}{}}, want: []string{"./kustomize"}},
+		{name: "missing", fn: "helmTemplate", args: []interface{}{"grafana"}, want: []string{"grafana"}},
+		{name: "other", fn: "parseYaml", args: []interface{}{"a: b"}, want: []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, nativeArgs(c.fn, c.args))
+		})
+	}
+}
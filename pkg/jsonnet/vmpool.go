@@ -0,0 +1,97 @@
+package jsonnet
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	jsonnet "github.com/google/go-jsonnet"
+)
+
+// VMPool keeps Jsonnet VMs for reuse. A VM caches the files it imports, both
+// parsed and evaluated, so evaluating again using the same VM only reads the
+// files it has not seen before. Whenever files change, Reset must be called.
+//
+// Set Opts.VMPool to use it.
+type VMPool struct {
+	mu    sync.Mutex
+	vms   map[string]*pooledVM
+	files map[string]bool
+}
+
+type pooledVM struct {
+	mu sync.Mutex
+	vm *jsonnet.VM
+}
+
+// NewVMPool returns an empty VMPool
+func NewVMPool() *VMPool {
+	return &VMPool{
+		vms:   make(map[string]*pooledVM),
+		files: make(map[string]bool),
+	}
+}
+
+// get returns the VM for opts, creating it if needed. VMs are not safe for
+// concurrent use, so it is locked until release is called.
+func (p *VMPool) get(opts Opts) (vm *jsonnet.VM, release func()) {
+	key := vmKey(opts)
+
+	p.mu.Lock()
+	pooled, ok := p.vms[key]
+	if !ok {
+		importer := NewExtendedImporter(opts.ImportPaths)
+		importer.onImport = p.record
+		pooled = &pooledVM{vm: makeVM(opts, importer)}
+		p.vms[key] = pooled
+	}
+	p.mu.Unlock()
+
+	pooled.mu.Lock()
+	return pooled.vm, pooled.mu.Unlock
+}
+
+func (p *VMPool) record(foundAt string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[foundAt] = true
+}
+
+// Files returns the files imported by the VMs of the pool, sorted
+func (p *VMPool) Files() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	files := make([]string, 0, len(p.files))
+	for f := range p.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Reset drops all VMs, so that files are read again
+func (p *VMPool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.vms = make(map[string]*pooledVM)
+	p.files = make(map[string]bool)
+}
+
+// vmKey returns a key that is equal for all opts that result in the same VM
+func vmKey(opts Opts) string {
+	key, err := json.Marshal(struct {
+		MaxStack     int
+		ExtCode      InjectedCode
+		TLACode      InjectedCode
+		ImportPaths  []string
+		CachePath    string
+		CacheMaxSize int64
+	}{opts.MaxStack, opts.ExtCode, opts.TLACode, opts.ImportPaths, opts.CachePath, opts.CacheMaxSize})
+	if err != nil {
+		// only strings and ints, can't happen
+		panic(err)
+	}
+	return string(key)
+}
@@ -0,0 +1,44 @@
+package jsonnet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMPool(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("jsonnetfile.json", "{}")
+	write("main.jsonnet", "import 'lib.libsonnet'")
+	write("lib.libsonnet", "{ a: 1 }")
+
+	main := filepath.Join(dir, "main.jsonnet")
+	opts := Opts{VMPool: NewVMPool()}
+	eval := func() string {
+		out, err := EvaluateFile(main, opts)
+		require.NoError(t, err)
+		return out
+	}
+
+	assert.JSONEq(t, `{"a": 1}`, eval())
+	assert.Equal(t, []string{filepath.Join(dir, "lib.libsonnet"), main}, opts.VMPool.Files())
+
+	// imports are cached by the VM
+	write("lib.libsonnet", "{ a: 2 }")
+	assert.JSONEq(t, `{"a": 1}`, eval())
+
+	// different ext code results in a different VM
+	opts.ExtCode = InjectedCode{"foo": "'bar'"}
+	assert.JSONEq(t, `{"a": 2}`, eval())
+	opts.ExtCode = nil
+
+	opts.VMPool.Reset()
+	assert.Empty(t, opts.VMPool.Files())
+	assert.JSONEq(t, `{"a": 2}`, eval())
+}
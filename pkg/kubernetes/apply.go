@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -13,9 +14,41 @@ import (
 // ApplyOpts allow set additional parameters for the apply operation
 type ApplyOpts client.ApplyOpts
 
-// Apply receives a state object generated using `Reconcile()` and may apply it to the target system
+// Apply receives a state object generated using `Reconcile()` and may apply it to the target system.
+// Objects are applied in phases (see applyPhases). Between phases, Apply waits
+// for CustomResourceDefinitions and APIServices to become ready, so that
+// objects using them are accepted. Helm hooks are applied before and after all
+// other objects (see applyHooks).
 func (k *Kubernetes) Apply(state manifest.List, opts ApplyOpts) error {
-	return k.ctl.Apply(state, client.ApplyOpts(opts))
+	phases, skipped, err := applyPhases(state)
+	if err != nil {
+		return err
+	}
+	for _, m := range skipped {
+		log.Printf("Skipping %s: Helm hook `%s` is not applied on install or upgrade", objectspec(m), m.Metadata().Annotations()[AnnotationHelmHook])
+	}
+
+	for i, p := range phases {
+		if isHookPhase(p.name) {
+			if err := k.applyHooks(p, opts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := k.ctl.Apply(p.state, client.ApplyOpts(opts)); err != nil {
+			return err
+		}
+
+		// nothing was created in dry-run mode, so there is nothing to wait for
+		if i == len(phases)-1 || opts.DryRun != "" {
+			continue
+		}
+		if err := k.waitPhase(p, phases[i+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // AnnoationLastApplied is the last-applied-configuration annotation used by kubectl
@@ -0,0 +1,348 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// FieldManager is the name Tanka uses for server-side apply operations
+const FieldManager = "tanka"
+
+// GoClient uses client-go to operate on a Kubernetes cluster. Unlike Kubectl,
+// it does not require any external binaries.
+type GoClient struct {
+	info Info
+
+	dynamic   dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	mapper    meta.RESTMapper
+
+	// resources caches the result of Resources()
+	resources Resources
+}
+
+// NewGoClient returns a GoClient for the first context in $KUBECONFIG that uses
+// the given apiServer endpoint.
+func NewGoClient(endpoint string) (*GoClient, error) {
+	return newGoClient(func(cfg *clientcmdapi.Config) (string, error) {
+		return goContextFromEndpoint(cfg, endpoint)
+	})
+}
+
+// NewGoClientFromNames returns a GoClient for the first context in $KUBECONFIG
+// that matches one of names.
+func NewGoClientFromNames(names []string) (*GoClient, error) {
+	return newGoClient(func(cfg *clientcmdapi.Config) (string, error) {
+		for _, name := range names {
+			ctx, err := goContextFromName(cfg, name)
+			if _, ok := err.(ErrorNoContext); ok {
+				continue
+			} else if err != nil {
+				return "", err
+			}
+			return ctx, nil
+		}
+		return "", ErrorNoContext(fmt.Sprintf("%v", names))
+	})
+}
+
+func newGoClient(findContext func(*clientcmdapi.Config) (string, error)) (*GoClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading $KUBECONFIG")
+	}
+
+	contextName, err := findContext(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding usable context")
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*raw, contextName, &clientcmd.ConfigOverrides{}, rules).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating client config")
+	}
+
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disco))
+
+	g := &GoClient{
+		info:      Info{Kubeconfig: goConfig(raw, contextName)},
+		dynamic:   dyn,
+		discovery: disco,
+		mapper:    mapper,
+	}
+
+	g.info.ServerVersion, err = g.version()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining versions")
+	}
+
+	return g, nil
+}
+
+// goContextFromEndpoint returns the name of the first context (alphabetically)
+// whose cluster server matches endpoint
+func goContextFromEndpoint(cfg *clientcmdapi.Config, endpoint string) (string, error) {
+	exp, err := regexp.Compile(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	cluster := ""
+	for _, name := range sortedClusters(cfg.Clusters) {
+		if exp.MatchString(cfg.Clusters[name].Server) {
+			cluster = name
+			break
+		}
+	}
+	if cluster == "" {
+		return "", ErrorNoCluster(endpoint)
+	}
+
+	for _, name := range sortedContexts(cfg.Contexts) {
+		if cfg.Contexts[name].Cluster == cluster {
+			return name, nil
+		}
+	}
+	return "", ErrorNoContext(cluster)
+}
+
+// goContextFromName returns the name of the first context (alphabetically)
+// matching the regular expression contextName
+func goContextFromName(cfg *clientcmdapi.Config, contextName string) (string, error) {
+	exp, err := regexp.Compile(contextName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range sortedContexts(cfg.Contexts) {
+		if !exp.MatchString(name) {
+			continue
+		}
+		if _, ok := cfg.Clusters[cfg.Contexts[name].Cluster]; !ok {
+			return "", ErrorNoCluster(contextName)
+		}
+		return name, nil
+	}
+	return "", ErrorNoContext(contextName)
+}
+
+// goConfig converts the chosen context of a client-go config into the Config
+// type used by Info
+func goConfig(raw *clientcmdapi.Config, contextName string) Config {
+	var c Config
+	ctx := raw.Contexts[contextName]
+
+	c.Context.Name = contextName
+	c.Context.Context.Cluster = ctx.Cluster
+	c.Context.Context.User = ctx.AuthInfo
+	c.Context.Context.Namespace = ctx.Namespace
+
+	c.Cluster.Name = ctx.Cluster
+	if cluster, ok := raw.Clusters[ctx.Cluster]; ok {
+		c.Cluster.Cluster.Server = cluster.Server
+	}
+
+	return c
+}
+
+func sortedContexts(m map[string]*clientcmdapi.Context) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedClusters(m map[string]*clientcmdapi.Cluster) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// version returns the version of the Kubernetes api server
+func (g *GoClient) version() (*semver.Version, error) {
+	v, err := g.discovery.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := semver.NewVersion(v.GitVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "server version")
+	}
+	return server, nil
+}
+
+// Info returns known informational data about the client and its environment.
+// ClientVersion is always nil, as no kubectl binary is involved.
+func (g *GoClient) Info() Info {
+	return g.info
+}
+
+// Close runs final cleanup
+func (g *GoClient) Close() error {
+	return nil
+}
+
+// Namespaces of the cluster
+func (g *GoClient) Namespaces() (map[string]bool, error) {
+	list, err := g.dynamic.Resource(namespacesGVR).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]bool)
+	for _, item := range list.Items {
+		namespaces[item.GetName()] = true
+	}
+	return namespaces, nil
+}
+
+// Namespace finds a single namespace in the cluster
+func (g *GoClient) Namespace(namespace string) (manifest.Manifest, error) {
+	ns, err := g.dynamic.Resource(namespacesGVR).Get(context.Background(), namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNamespaceNotFound{Namespace: namespace}
+	} else if err != nil {
+		return nil, err
+	}
+	return manifest.Manifest(ns.Object), nil
+}
+
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// Resources returns all API resources known to the server
+func (g *GoClient) Resources() (Resources, error) {
+	if g.resources != nil {
+		return g.resources, nil
+	}
+
+	lists, err := discovery.ServerPreferredResources(g.discovery)
+	// some groups failing (e.g. unavailable aggregated APIs) is not fatal,
+	// kubectl api-resources only warns about these as well
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	var res Resources
+	for _, list := range lists {
+		for _, r := range list.APIResources {
+			// skip subresources
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			res = append(res, Resource{
+				APIVersion: list.GroupVersion,
+				Kind:       r.Kind,
+				Name:       r.Name,
+				Namespaced: r.Namespaced,
+				Shortnames: strings.Join(r.ShortNames, ","),
+				Verbs:      "[" + strings.Join(r.Verbs, " ") + "]",
+			})
+		}
+	}
+
+	g.resources = res
+	return res, nil
+}
+
+// resolveKind finds the resource for kind, which may be a Kind (`Deployment`),
+// a resource name (`deployments`), a fully qualified resource name
+// (`deployments.apps`) or a shortname (`deploy`)
+func (g *GoClient) resolveKind(kind string) (*Resource, schema.GroupVersionResource, error) {
+	resources, err := g.Resources()
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+
+	for _, r := range resources {
+		if r.FQN() != kind && r.Name != kind && !strings.EqualFold(r.Kind, kind) && !contains(strings.Split(r.Shortnames, ","), kind) {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(r.APIVersion)
+		if err != nil {
+			return nil, schema.GroupVersionResource{}, err
+		}
+		r := r
+		return &r, gv.WithResource(r.Name), nil
+	}
+
+	return nil, schema.GroupVersionResource{}, ErrorUnknownResource{
+		errOut: fmt.Sprintf("the server doesn't have a resource type %q", kind),
+	}
+}
+
+// resourceFor returns a client for the resource described by m, already scoped
+// to its namespace if required
+func (g *GoClient) resourceFor(m manifest.Manifest) (dynamic.ResourceInterface, error) {
+	gv, err := schema.ParseGroupVersion(m.APIVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := g.mapper.RESTMapping(gv.WithKind(m.Kind()).GroupKind(), gv.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, ErrorUnknownResource{errOut: err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := g.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return res, nil
+	}
+	return res.Namespace(g.namespaceOrDefault(m.Metadata().Namespace())), nil
+}
+
+// namespaceOrDefault returns ns, or the default namespace of the context if ns
+// is empty
+func (g *GoClient) namespaceOrDefault(ns string) string {
+	if ns != "" {
+		return ns
+	}
+	if ns := g.info.Kubeconfig.Context.Context.Namespace; ns != "" {
+		return ns
+	}
+	return metav1.NamespaceDefault
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// ErrorApplyStrategyUnsupported occurs when the client is unable to apply using
+// the requested strategy
+type ErrorApplyStrategyUnsupported struct {
+	Requested string
+}
+
+func (e ErrorApplyStrategyUnsupported) Error() string {
+	return fmt.Sprintf("apply strategy `%s` is not supported by the client-go client. Use `server` instead", e.Requested)
+}
+
+// Apply applies the given manifests to the cluster using server-side apply.
+// Client-side apply is not supported, because it is implemented by kubectl
+// and not by the API server.
+func (g *GoClient) Apply(data manifest.List, opts ApplyOpts) error {
+	if opts.ApplyStrategy != "server" {
+		return ErrorApplyStrategyUnsupported{Requested: opts.ApplyStrategy}
+	}
+
+	for _, m := range data {
+		suffix := "serverside-applied"
+		switch opts.DryRun {
+		case "client":
+			fmt.Printf("%s %s (dry run)\n", g.objectName(m), suffix)
+			continue
+		case "server":
+			suffix += " (server dry run)"
+		}
+
+		if _, err := g.apply(m, opts.Force, opts.DryRun == "server"); err != nil {
+			return fmt.Errorf("applying %s: %w", m.KindName(), err)
+		}
+		fmt.Printf("%s %s\n", g.objectName(m), suffix)
+	}
+
+	return nil
+}
+
+// apply runs a server-side apply of m and returns the resulting object
+func (g *GoClient) apply(m manifest.Manifest, force, dryRun bool) (manifest.Manifest, error) {
+	ri, err := g.resourceFor(m)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+	}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	obj, err := ri.Patch(context.Background(), m.Metadata().Name(), types.ApplyPatchType, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Manifest(obj.Object), nil
+}
+
+// Delete deletes the given Kubernetes resource from the cluster
+func (g *GoClient) Delete(namespace, kind, name string, opts DeleteOpts) error {
+	res, gvr, err := g.resolveKind(kind)
+	if err != nil {
+		return err
+	}
+
+	objName := fmt.Sprintf("%s %q", groupResource(gvr), name)
+	if opts.DryRun == "client" {
+		fmt.Printf("%s deleted (dry run)\n", objName)
+		return nil
+	}
+
+	var ri dynamic.ResourceInterface = g.dynamic.Resource(gvr)
+	if res.Namespaced {
+		ri = g.dynamic.Resource(gvr).Namespace(g.namespaceOrDefault(namespace))
+	}
+
+	delOpts := metav1.DeleteOptions{}
+	if opts.DryRun == "server" {
+		delOpts.DryRun = []string{metav1.DryRunAll}
+	}
+	if opts.Force {
+		grace := int64(0)
+		delOpts.GracePeriodSeconds = &grace
+	}
+
+	err = ri.Delete(context.Background(), name, delOpts)
+	if apierrors.IsNotFound(err) {
+		print("Delete failed: " + err.Error() + "\n")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if opts.DryRun == "server" {
+		fmt.Printf("%s deleted (server dry run)\n", objName)
+	} else {
+		fmt.Printf("%s deleted\n", objName)
+	}
+	return nil
+}
+
+// DiffServerSide takes the desired state and computes the differences
+// server-side by running a dry-run server-side apply, returning them in
+// `diff(1)` format
+func (g *GoClient) DiffServerSide(data manifest.List) (*string, error) {
+	return g.DiffServerSideOpts(data, util.DiffOpts{Context: util.DefaultDiffContext})
+}
+
+// DiffServerSideOpts is like DiffServerSide, but allows to specify how the
+// diff is formatted
+func (g *GoClient) DiffServerSideOpts(data manifest.List, opts util.DiffOpts) (*string, error) {
+	s := ""
+	for _, m := range data {
+		live, err := g.GetByState(manifest.List{m}, GetByStateOpts{IgnoreNotFound: true})
+		if _, ok := err.(ErrorNothingReturned); ok {
+			live = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		merged, err := g.apply(m, true, true)
+		if err != nil {
+			return nil, fmt.Errorf("computing merged state of %s: %w", m.KindName(), err)
+		}
+
+		is := ""
+		if len(live) > 0 {
+			is = diffable(live[0]).String()
+		}
+		should := diffable(merged).String()
+
+		d, err := util.DiffStrOpts(util.DiffName(m), is, should, opts)
+		if err != nil {
+			return nil, err
+		}
+		s += d
+	}
+
+	if s == "" {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// DiffClientSide computes the differences of the given state to the cluster.
+// As client-side apply is not supported, this is the same as DiffServerSide.
+func (g *GoClient) DiffClientSide(data manifest.List) (*string, error) {
+	return g.DiffServerSide(data)
+}
+
+// ValidateServerSide computes the differences of the given state to the
+// cluster. As DiffServerSide already validates every object server-side, this
+// is the same as DiffServerSide.
+func (g *GoClient) ValidateServerSide(data manifest.List) (*string, error) {
+	return g.DiffServerSide(data)
+}
+
+// diffable strips fields that change on every request from m, just like
+// `kubectl diff` does
+func diffable(m manifest.Manifest) manifest.Manifest {
+	meta := m.Metadata()
+	delete(meta, "managedFields")
+	delete(meta, "resourceVersion")
+	return m
+}
+
+// objectName returns the name of m in the `kind.group/name` format kubectl
+// uses for its output
+func (g *GoClient) objectName(m manifest.Manifest) string {
+	gv, err := schema.ParseGroupVersion(m.APIVersion())
+	if err != nil || gv.Group == "" {
+		return strings.ToLower(m.Kind()) + "/" + m.Metadata().Name()
+	}
+	return strings.ToLower(m.Kind()) + "." + gv.Group + "/" + m.Metadata().Name()
+}
+
+func groupResource(gvr schema.GroupVersionResource) string {
+	return strings.TrimSuffix(gvr.Resource+"."+gvr.Group, ".")
+}
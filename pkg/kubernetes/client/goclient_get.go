@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// Get retrieves a single Kubernetes object from the cluster
+func (g *GoClient) Get(namespace, kind, name string) (manifest.Manifest, error) {
+	res, gvr, err := g.resolveKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var ri dynamic.ResourceInterface = g.dynamic.Resource(gvr)
+	if res.Namespaced {
+		ri = g.dynamic.Resource(gvr).Namespace(g.namespaceOrDefault(namespace))
+	}
+
+	obj, err := ri.Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrorNotFound{err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return manifest.Manifest(obj.Object), nil
+}
+
+// GetByLabels retrieves all objects matched by the given labels from the cluster.
+// kind may be a comma separated list of kinds. Set namespace to empty string
+// for all namespaces
+func (g *GoClient) GetByLabels(namespace, kind string, lbls map[string]string) (manifest.List, error) {
+	selector := labels.SelectorFromSet(lbls).String()
+
+	var list manifest.List
+	for _, k := range strings.Split(kind, ",") {
+		res, gvr, err := g.resolveKind(k)
+		if err != nil {
+			return nil, err
+		}
+
+		var ri dynamic.ResourceInterface = g.dynamic.Resource(gvr)
+		if res.Namespaced && namespace != "" {
+			ri = g.dynamic.Resource(gvr).Namespace(namespace)
+		}
+
+		items, err := ri.List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items.Items {
+			list = append(list, manifest.Manifest(item.Object))
+		}
+	}
+
+	return list, nil
+}
+
+// GetByState returns the full object, including runtime fields for each
+// resource in the state
+func (g *GoClient) GetByState(data manifest.List, opts GetByStateOpts) (manifest.List, error) {
+	var list manifest.List
+	for _, m := range data {
+		ri, err := g.resourceFor(m)
+		if err != nil {
+			return nil, err
+		}
+
+		obj, err := ri.Get(context.Background(), m.Metadata().Name(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if opts.IgnoreNotFound {
+				continue
+			}
+			return nil, ErrorNotFound{err.Error()}
+		} else if err != nil {
+			return nil, err
+		}
+
+		list = append(list, manifest.Manifest(obj.Object))
+	}
+
+	// mirror `kubectl get --ignore-not-found` returning nothing at all
+	if len(list) == 0 {
+		return nil, ErrorNothingReturned{}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func newFakeGoClient(objects ...runtime.Object) *GoClient {
+	disco := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	disco.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false, Verbs: []string{"get", "list"}},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, ShortNames: []string{"cm"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Verbs: []string{"get", "list"}},
+				{Name: "deployments/status", Kind: "Deployment", Namespaced: true},
+			},
+		},
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	dyn := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "namespaces"}:                 "NamespaceList",
+		{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+	}, objects...)
+
+	return &GoClient{
+		dynamic:   dyn,
+		discovery: disco,
+		mapper:    mapper,
+	}
+}
+
+func obj(apiVersion, kind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+func TestGoClientResources(t *testing.T) {
+	g := newFakeGoClient()
+
+	res, err := g.Resources()
+	require.NoError(t, err)
+
+	assert.Equal(t, Resources{
+		{APIVersion: "v1", Kind: "Namespace", Name: "namespaces", Verbs: "[get list]"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true, Shortnames: "cm", Verbs: "[get list]"},
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "deployments", Namespaced: true, Shortnames: "deploy", Verbs: "[get list]"},
+	}, res)
+}
+
+func TestGoClientResolveKind(t *testing.T) {
+	g := newFakeGoClient()
+
+	for _, kind := range []string{"Deployment", "deployments", "deployments.apps", "deploy"} {
+		_, gvr, err := g.resolveKind(kind)
+		require.NoError(t, err, kind)
+		assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, gvr, kind)
+	}
+
+	_, _, err := g.resolveKind("Foo")
+	assert.IsType(t, ErrorUnknownResource{}, err)
+}
+
+func TestGoClientGet(t *testing.T) {
+	g := newFakeGoClient(
+		obj("v1", "ConfigMap", "default", "config", nil),
+	)
+
+	m, err := g.Get("", "ConfigMap", "config")
+	require.NoError(t, err)
+	assert.Equal(t, "config", m.Metadata().Name())
+
+	_, err = g.Get("default", "cm", "missing")
+	assert.IsType(t, ErrorNotFound{}, err)
+}
+
+func TestGoClientGetByState(t *testing.T) {
+	g := newFakeGoClient(
+		obj("v1", "ConfigMap", "default", "config", nil),
+		obj("apps/v1", "Deployment", "monitoring", "grafana", nil),
+	)
+
+	state := manifest.List{
+		m("v1", "ConfigMap", "config", "default"),
+		m("apps/v1", "Deployment", "grafana", "monitoring"),
+		m("apps/v1", "Deployment", "loki", "monitoring"),
+	}
+
+	_, err := g.GetByState(state, GetByStateOpts{})
+	assert.IsType(t, ErrorNotFound{}, err)
+
+	live, err := g.GetByState(state, GetByStateOpts{IgnoreNotFound: true})
+	require.NoError(t, err)
+	require.Len(t, live, 2)
+	assert.Equal(t, "config", live[0].Metadata().Name())
+	assert.Equal(t, "grafana", live[1].Metadata().Name())
+
+	_, err = g.GetByState(state[2:], GetByStateOpts{IgnoreNotFound: true})
+	assert.IsType(t, ErrorNothingReturned{}, err)
+}
+
+func TestGoClientGetByLabels(t *testing.T) {
+	env := map[string]string{"tanka.dev/environment": "abc"}
+	g := newFakeGoClient(
+		obj("v1", "ConfigMap", "default", "config", env),
+		obj("v1", "ConfigMap", "default", "other", nil),
+		obj("apps/v1", "Deployment", "monitoring", "grafana", env),
+	)
+
+	list, err := g.GetByLabels("", "configmaps,deployments.apps", env)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, m := range list {
+		names = append(names, m.KindName())
+	}
+	assert.ElementsMatch(t, []string{"ConfigMap/config", "Deployment/grafana"}, names)
+}
+
+func TestGoClientNamespaces(t *testing.T) {
+	g := newFakeGoClient(
+		obj("v1", "Namespace", "", "default", nil),
+		obj("v1", "Namespace", "", "monitoring", nil),
+	)
+
+	namespaces, err := g.Namespaces()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"default": true, "monitoring": true}, namespaces)
+
+	_, err = g.Namespace("missing")
+	assert.Equal(t, ErrNamespaceNotFound{Namespace: "missing"}, err)
+}
+
+func TestGoContextFromKubeconfig(t *testing.T) {
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters["dev"] = &clientcmdapi.Cluster{Server: "https://dev.example.com:6443"}
+	cfg.Clusters["prod"] = &clientcmdapi.Cluster{Server: "https://prod.example.com:6443"}
+	cfg.Contexts["dev-admin"] = &clientcmdapi.Context{Cluster: "dev", Namespace: "tools"}
+	cfg.Contexts["prod-admin"] = &clientcmdapi.Context{Cluster: "prod"}
+
+	name, err := goContextFromEndpoint(cfg, "https://prod.example.com:6443")
+	require.NoError(t, err)
+	assert.Equal(t, "prod-admin", name)
+
+	_, err = goContextFromEndpoint(cfg, "https://staging.example.com")
+	assert.Equal(t, ErrorNoCluster("https://staging.example.com"), err)
+
+	name, err = goContextFromName(cfg, "dev-.*")
+	require.NoError(t, err)
+	assert.Equal(t, "dev-admin", name)
+
+	c := goConfig(cfg, name)
+	assert.Equal(t, "dev", c.Cluster.Name)
+	assert.Equal(t, "https://dev.example.com:6443", c.Cluster.Cluster.Server)
+	assert.Equal(t, "tools", c.Context.Context.Namespace)
+}
+
+func m(apiVersion, kind, name, namespace string) manifest.Manifest {
+	return manifest.Manifest{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}
+}
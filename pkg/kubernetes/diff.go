@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
@@ -14,56 +15,43 @@ import (
 // Diff takes the desired state and returns the differences from the cluster
 func (k *Kubernetes) Diff(state manifest.List, opts DiffOpts) (*string, error) {
 	// prevent https://github.com/kubernetes/kubernetes/issues/89762 until fixed
-	if k.ctl.Info().ClientVersion.Equal(semver.MustParse("1.18.0")) {
+	if v := k.ctl.Info().ClientVersion; v != nil && v.Equal(semver.MustParse("1.18.0")) {
 		return nil, fmt.Errorf(`You seem to be using kubectl 1.18.0, which contains an unfixed issue
 that makes 'kubectl diff' modify resources in your cluster.
 Please upgrade kubectl to at least version 1.18.1.`)
 	}
 
-	// required for separating
-	namespaces, err := k.ctl.Namespaces()
+	state, err := withoutTransientHooks(state)
 	if err != nil {
-		resourceNamespaces := state.Namespaces()
-		namespaces = map[string]bool{}
-		for _, namespace := range resourceNamespaces {
-			_, err = k.ctl.Namespace(namespace)
-			if err != nil {
-				if errors.As(err, &client.ErrNamespaceNotFound{}) {
-					continue
-				}
-				return nil, errors.Wrap(err, "retrieving namespaces")
-			}
-			namespaces[namespace] = true
-		}
+		return nil, err
 	}
-	resources, err := k.ctl.Resources()
+
+	live, soon, err := k.separate(state)
 	if err != nil {
-		return nil, errors.Wrap(err, "listing known api-resources")
+		return nil, err
 	}
 
-	// separate resources in groups
-	//
-	// soon: resources that have unmet dependencies that will be met during
-	// apply. These will be diffed statically, because checking with the cluster
-	// would cause an error
-	//
-	// live: all other resources
-	live, soon := separate(state, k.Env.Spec.Namespace, separateOpts{
-		namespaces: namespaces,
-		resources:  resources,
-	})
+	live, soon, ignored, err := k.ignoreFields(live, soon)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ignored {
+		log.Printf("Ignoring changes to %s of %s (spec.diffIgnore)", f.Path, f.Object)
+	}
+
+	diffOpts := util.DiffOpts{Context: opts.Context}
 
 	// differ for live resources
-	liveDiff, err := k.differ(opts.Strategy)
+	liveDiff, err := k.differ(opts.Strategy, diffOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	// reports all resources as created
-	staticDiffAllCreated := StaticDiffer(true)
+	staticDiffAllCreated := staticDiffer(true, diffOpts)
 
 	// reports all resources as deleted
-	staticDiffAllDeleted := StaticDiffer(false)
+	staticDiffAllDeleted := staticDiffer(false, diffOpts)
 
 	// include orphaned resources in the diff if it was requested by the user
 	orphaned := manifest.List{}
@@ -96,6 +84,44 @@ Please upgrade kubectl to at least version 1.18.1.`)
 	return d, nil
 }
 
+// separate splits state into resources that can be checked with the cluster
+// (live) and those with unmet dependencies that will be met during apply (soon)
+func (k *Kubernetes) separate(state manifest.List) (live, soon manifest.List, err error) {
+	// required for separating
+	namespaces, err := k.ctl.Namespaces()
+	if err != nil {
+		resourceNamespaces := state.Namespaces()
+		namespaces = map[string]bool{}
+		for _, namespace := range resourceNamespaces {
+			_, err = k.ctl.Namespace(namespace)
+			if err != nil {
+				if errors.As(err, &client.ErrNamespaceNotFound{}) {
+					continue
+				}
+				return nil, nil, errors.Wrap(err, "retrieving namespaces")
+			}
+			namespaces[namespace] = true
+		}
+	}
+	resources, err := k.ctl.Resources()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing known api-resources")
+	}
+
+	// separate resources in groups
+	//
+	// soon: resources that have unmet dependencies that will be met during
+	// apply. These will be diffed statically, because checking with the cluster
+	// would cause an error
+	//
+	// live: all other resources
+	live, soon = separate(state, k.Env.Spec.Namespace, separateOpts{
+		namespaces: namespaces,
+		resources:  resources,
+	})
+	return live, soon, nil
+}
+
 type separateOpts struct {
 	namespaces map[string]bool
 	resources  client.Resources
@@ -140,7 +166,7 @@ func separate(state manifest.List, defaultNs string, opts separateOpts) (live ma
 // not exist.
 type ErrorDiffStrategyUnknown struct {
 	Requested string
-	differs   map[string]Differ
+	differs   map[string]differFunc
 }
 
 func (e ErrorDiffStrategyUnknown) Error() string {
@@ -151,7 +177,7 @@ func (e ErrorDiffStrategyUnknown) Error() string {
 	return fmt.Sprintf("diff strategy `%s` does not exist. Pick one of: %v", e.Requested, strats)
 }
 
-func (k *Kubernetes) differ(override string) (Differ, error) {
+func (k *Kubernetes) differ(override string, opts util.DiffOpts) (Differ, error) {
 	strategy := k.Env.Spec.DiffStrategy
 	if override != "" {
 		strategy = override
@@ -165,12 +191,16 @@ func (k *Kubernetes) differ(override string) (Differ, error) {
 		}
 	}
 
-	return d, nil
+	return d(opts), nil
 }
 
 // StaticDiffer returns a differ that reports all resources as either created or
 // deleted.
 func StaticDiffer(create bool) Differ {
+	return staticDiffer(create, util.DiffOpts{Context: util.DefaultDiffContext})
+}
+
+func staticDiffer(create bool, opts util.DiffOpts) Differ {
 	return func(state manifest.List) (*string, error) {
 		s := ""
 		for _, m := range state {
@@ -179,7 +209,7 @@ func StaticDiffer(create bool) Differ {
 				is, should = should, is
 			}
 
-			d, err := util.DiffStr(util.DiffName(m), is, should)
+			d, err := util.DiffStrOpts(util.DiffName(m), is, should, opts)
 			if err != nil {
 				return nil, err
 			}
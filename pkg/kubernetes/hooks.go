@@ -0,0 +1,208 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// Annotations of Helm hooks (https://helm.sh/docs/topics/charts_hooks/)
+const (
+	AnnotationHelmHook             = "helm.sh/hook"
+	AnnotationHelmHookWeight       = "helm.sh/hook-weight"
+	AnnotationHelmHookDeletePolicy = "helm.sh/hook-delete-policy"
+)
+
+// Helm hook events Tanka applies. Tanka does not distinguish installs from
+// upgrades, so both are applied on every apply.
+const (
+	HookPreInstall  = "pre-install"
+	HookPreUpgrade  = "pre-upgrade"
+	HookPostInstall = "post-install"
+	HookPostUpgrade = "post-upgrade"
+)
+
+// Helm hook delete policies
+const (
+	HookBeforeHookCreation = "before-hook-creation"
+	HookSucceeded          = "hook-succeeded"
+	HookFailed             = "hook-failed"
+)
+
+// hookWaitTimeout is the maximum time to wait for a hook to complete, like
+// the default of `helm install --timeout`
+var hookWaitTimeout = 5 * time.Minute
+
+// hook is the Helm hook configuration of an object
+type hook struct {
+	events   map[string]bool
+	weight   int
+	policies map[string]bool
+}
+
+// helmHook returns the hook configuration of m, if it is a Helm hook
+func helmHook(m manifest.Manifest) (*hook, error) {
+	// Metadata().Annotations() would add an empty map to m
+	annotations, _ := m.Metadata()["annotations"].(map[string]interface{})
+	events, ok := annotations[AnnotationHelmHook].(string)
+	if !ok {
+		return nil, nil
+	}
+
+	h := &hook{events: splitList(events), policies: splitList("")}
+	if w, ok := annotations[AnnotationHelmHookWeight].(string); ok && w != "" {
+		weight, err := strconv.Atoi(strings.TrimSpace(w))
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid %s `%s`: must be an integer", objectspec(m), AnnotationHelmHookWeight, w)
+		}
+		h.weight = weight
+	}
+
+	if p, ok := annotations[AnnotationHelmHookDeletePolicy].(string); ok {
+		h.policies = splitList(p)
+	}
+	// Helm deletes previous hooks by default
+	if len(h.policies) == 0 {
+		h.policies[HookBeforeHookCreation] = true
+	}
+	return h, nil
+}
+
+// phase returns the apply phase of the hook, or "" if it is not applied at
+// all, like delete, rollback and test hooks
+func (h hook) phase() string {
+	switch {
+	case h.events[HookPreInstall] || h.events[HookPreUpgrade]:
+		return PhasePreHooks
+	case h.events[HookPostInstall] || h.events[HookPostUpgrade]:
+		return PhasePostHooks
+	}
+	return ""
+}
+
+func splitList(s string) map[string]bool {
+	out := make(map[string]bool)
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out[e] = true
+		}
+	}
+	return out
+}
+
+// isHookPhase reports whether objects of the phase are Helm hooks
+func isHookPhase(name string) bool {
+	return name == PhasePreHooks || name == PhasePostHooks
+}
+
+// applyHooks applies the Helm hooks of p by ascending weight. Objects of the
+// same weight are applied together, and waited for to complete before the
+// next weight. Delete policies are honored, except in dry-run mode.
+func (k *Kubernetes) applyHooks(p phase, opts ApplyOpts) error {
+	byWeight := make(map[int]manifest.List)
+	var weights []int
+	for _, m := range p.state {
+		h, err := helmHook(m)
+		if err != nil {
+			return err
+		}
+		if _, ok := byWeight[h.weight]; !ok {
+			weights = append(weights, h.weight)
+		}
+		byWeight[h.weight] = append(byWeight[h.weight], m)
+	}
+	sort.Ints(weights)
+
+	for _, w := range weights {
+		hooks := byWeight[w]
+		if opts.DryRun != "" {
+			if err := k.ctl.Apply(hooks, client.ApplyOpts(opts)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := k.deleteHooks(hooks, HookBeforeHookCreation, opts); err != nil {
+			return err
+		}
+		if err := k.ctl.Apply(hooks, client.ApplyOpts(opts)); err != nil {
+			return err
+		}
+
+		if err := k.Wait(hooks, WaitOpts{Timeout: hookWaitTimeout}); err != nil {
+			if delErr := k.deleteHooks(hooks, HookFailed, opts); delErr != nil {
+				return fmt.Errorf("%s\n\nDeleting the failed hooks failed as well: %s", err, delErr)
+			}
+			return fmt.Errorf("phase `%s`: %w", p.name, err)
+		}
+		if err := k.deleteHooks(hooks, HookSucceeded, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteHooks deletes those hooks that exist in the cluster and have the given
+// delete policy
+func (k *Kubernetes) deleteHooks(hooks manifest.List, policy string, opts ApplyOpts) error {
+	var matching manifest.List
+	for _, m := range hooks {
+		h, err := helmHook(m)
+		if err != nil {
+			return err
+		}
+		if h.policies[policy] {
+			matching = append(matching, m)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+
+	live, err := k.ctl.GetByState(matching, client.GetByStateOpts{IgnoreNotFound: true})
+	if _, ok := err.(client.ErrorNothingReturned); ok {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keys := make(map[string]bool)
+	for _, m := range matching {
+		keys[objectKey(m)] = true
+	}
+	for _, m := range live {
+		if !keys[objectKey(m)] {
+			continue
+		}
+		fmt.Printf("Deleting %s (%s: %s)\n", objectspec(m), AnnotationHelmHookDeletePolicy, policy)
+		// plain deletes: options like Force are meant for applying, and would
+		// skip graceful deletion
+		if err := k.ctl.Delete(m.Metadata().Namespace(), m.Kind(), m.Metadata().Name(), client.DeleteOpts{DryRun: opts.DryRun}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutTransientHooks drops Helm hooks from state that never persist in the
+// cluster, because they are not applied at all or deleted once they succeeded.
+// Diffing these would always report them as created.
+func withoutTransientHooks(state manifest.List) (manifest.List, error) {
+	out := make(manifest.List, 0, len(state))
+	for _, m := range state {
+		h, err := helmHook(m)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil && (h.phase() == "" || h.policies[HookSucceeded]) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
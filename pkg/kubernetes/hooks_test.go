@@ -0,0 +1,235 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// hookClient records applies and deletes in the order they happened
+type hookClient struct {
+	rollbackClient
+	events     []string
+	deleteOpts []client.DeleteOpts
+}
+
+func (h *hookClient) Apply(data manifest.List, opts client.ApplyOpts) error {
+	for _, m := range data {
+		h.events = append(h.events, "apply "+m.KindName())
+	}
+	return nil
+}
+
+func (h *hookClient) Delete(namespace, kind, name string, opts client.DeleteOpts) error {
+	h.events = append(h.events, "delete "+kind+"/"+name)
+	h.deleteOpts = append(h.deleteOpts, opts)
+	return nil
+}
+
+func withHook(m manifest.Manifest, annotations map[string]interface{}) manifest.Manifest {
+	m.Metadata()["annotations"] = annotations
+	return m
+}
+
+func job(name string, conditionType string) manifest.Manifest {
+	j := m("batch/v1", "Job", name, "default")
+	j["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": conditionType, "status": "True", "message": "BackoffLimitExceeded"},
+		},
+	}
+	return j
+}
+
+func TestApplyPhasesHooks(t *testing.T) {
+	phases, skipped, err := applyPhases(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install,pre-upgrade"}),
+		withHook(m("batch/v1", "Job", "notify", "default"), map[string]interface{}{AnnotationHelmHook: "post-upgrade"}),
+		withHook(m("v1", "Pod", "test-connection", "default"), map[string]interface{}{AnnotationHelmHook: "test"}),
+		withHook(m("batch/v1", "Job", "cleanup", "default"), map[string]interface{}{AnnotationHelmHook: "pre-delete"}),
+		m("v1", "Namespace", "monitoring", ""),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		PhaseNamespaces: {"Namespace/monitoring"},
+		PhasePreHooks:   {"Job/migrate"},
+		PhaseDefault:    {"Deployment/grafana"},
+		PhasePostHooks:  {"Job/notify"},
+	}, phaseNames(phases))
+	assert.Equal(t, []string{PhaseNamespaces, PhasePreHooks, PhaseDefault, PhasePostHooks},
+		[]string{phases[0].name, phases[1].name, phases[2].name, phases[3].name})
+
+	var names []string
+	for _, m := range skipped {
+		names = append(names, m.KindName())
+	}
+	assert.Equal(t, []string{"Pod/test-connection", "Job/cleanup"}, names)
+
+	// hook phases can't be requested using the annotation
+	requested := withHook(m("v1", "ConfigMap", "config", "default"), map[string]interface{}{AnnotationApplyPhase: PhasePreHooks})
+	_, _, err = applyPhases(manifest.List{requested})
+	assert.Equal(t, ErrorApplyPhaseUnknown{Object: "ConfigMap/config", Requested: PhasePreHooks}, err)
+
+	invalid := withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{
+		AnnotationHelmHook:       "pre-install",
+		AnnotationHelmHookWeight: "first",
+	})
+	_, _, err = applyPhases(manifest.List{invalid})
+	assert.EqualError(t, err, "Job/migrate has invalid helm.sh/hook-weight `first`: must be an integer")
+}
+
+func TestApplyHooks(t *testing.T) {
+	cases := []struct {
+		name   string
+		state  manifest.List
+		live   manifest.List
+		opts   ApplyOpts
+		events []string
+		err    string
+	}{
+		{
+			name: "weights",
+			state: manifest.List{
+				withHook(m("v1", "ConfigMap", "second", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install", AnnotationHelmHookWeight: "5"}),
+				withHook(m("v1", "ConfigMap", "first", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install", AnnotationHelmHookWeight: "-5"}),
+				withHook(m("v1", "ConfigMap", "unweighted", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install"}),
+				m("apps/v1", "Deployment", "grafana", "default"),
+				withHook(m("v1", "ConfigMap", "after", "default"), map[string]interface{}{AnnotationHelmHook: "post-install", AnnotationHelmHookWeight: "-10"}),
+			},
+			events: []string{
+				"apply ConfigMap/first",
+				"apply ConfigMap/unweighted",
+				"apply ConfigMap/second",
+				"apply Deployment/grafana",
+				"apply ConfigMap/after",
+			},
+		},
+		{
+			name: "before-hook-creation",
+			state: manifest.List{
+				withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-upgrade"}),
+			},
+			live: manifest.List{job("migrate", "Complete")},
+			events: []string{
+				"delete Job/migrate",
+				"apply Job/migrate",
+			},
+		},
+		{
+			name: "hook-succeeded",
+			state: manifest.List{
+				withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-upgrade", AnnotationHelmHookDeletePolicy: "hook-succeeded,hook-failed"}),
+				m("apps/v1", "Deployment", "grafana", "default"),
+			},
+			live: manifest.List{job("migrate", "Complete")},
+			events: []string{
+				"apply Job/migrate",
+				"delete Job/migrate",
+				"apply Deployment/grafana",
+			},
+		},
+		{
+			name: "hook-failed",
+			state: manifest.List{
+				withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-upgrade", AnnotationHelmHookDeletePolicy: "hook-failed"}),
+				m("apps/v1", "Deployment", "grafana", "default"),
+			},
+			live: manifest.List{job("migrate", "Failed")},
+			events: []string{
+				"apply Job/migrate",
+				"delete Job/migrate",
+			},
+			err: "phase `pre-hooks`",
+		},
+		{
+			name: "dry-run",
+			state: manifest.List{
+				withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-upgrade", AnnotationHelmHookDeletePolicy: "before-hook-creation,hook-succeeded"}),
+			},
+			live: manifest.List{job("migrate", "Complete")},
+			opts: ApplyOpts{DryRun: "server"},
+			events: []string{
+				"apply Job/migrate",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hc := &hookClient{rollbackClient: rollbackClient{live: c.live}}
+			k := Kubernetes{ctl: hc}
+
+			err := k.Apply(c.state, c.opts)
+			if c.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, c.events, hc.events)
+		})
+	}
+}
+
+func TestDeleteHooksPlain(t *testing.T) {
+	hc := &hookClient{rollbackClient: rollbackClient{live: manifest.List{job("migrate", "Complete")}}}
+	k := Kubernetes{ctl: hc}
+
+	err := k.Apply(manifest.List{
+		withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-upgrade", AnnotationHelmHookDeletePolicy: "before-hook-creation,hook-succeeded"}),
+	}, ApplyOpts{Force: true, Validate: true, ApplyStrategy: "server"})
+	require.NoError(t, err)
+
+	// hooks are never force deleted, even if applying is forced
+	assert.Equal(t, []string{"delete Job/migrate", "apply Job/migrate", "delete Job/migrate"}, hc.events)
+	assert.Equal(t, []client.DeleteOpts{{}, {}}, hc.deleteOpts)
+}
+
+func TestWithoutTransientHooks(t *testing.T) {
+	state, err := withoutTransientHooks(manifest.List{
+		m("apps/v1", "Deployment", "grafana", "default"),
+		withHook(m("v1", "ConfigMap", "kept", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install"}),
+		withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install", AnnotationHelmHookDeletePolicy: "hook-succeeded"}),
+		withHook(m("v1", "Pod", "test-connection", "default"), map[string]interface{}{AnnotationHelmHook: "test"}),
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, m := range state {
+		names = append(names, m.KindName())
+	}
+	assert.Equal(t, []string{"Deployment/grafana", "ConfigMap/kept"}, names)
+}
+
+func TestDiffStructuredHooks(t *testing.T) {
+	k := Kubernetes{
+		Env: v1alpha1.Environment{Spec: v1alpha1.Spec{Namespace: "default"}},
+		ctl: &rollbackClient{},
+	}
+
+	diffs, err := k.DiffStructured(manifest.List{
+		withHook(m("v1", "ConfigMap", "kept", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install"}),
+		withHook(m("batch/v1", "Job", "migrate", "default"), map[string]interface{}{AnnotationHelmHook: "pre-install", AnnotationHelmHookDeletePolicy: "hook-succeeded"}),
+		withHook(m("v1", "Pod", "test-connection", "default"), map[string]interface{}{AnnotationHelmHook: "test"}),
+		withHook(m("batch/v1", "Job", "cleanup", "default"), map[string]interface{}{AnnotationHelmHook: "pre-delete"}),
+	}, DiffOpts{})
+	require.NoError(t, err)
+
+	require.Len(t, diffs, 1)
+	assert.Equal(t, "kept", diffs[0].Name)
+}
+
+func TestHelmHookReadOnly(t *testing.T) {
+	cm := m("v1", "ConfigMap", "config", "default")
+	h, err := helmHook(cm)
+	require.NoError(t, err)
+	assert.Nil(t, h)
+	assert.NotContains(t, cm.Metadata(), "annotations")
+}
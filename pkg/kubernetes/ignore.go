@@ -0,0 +1,335 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// IgnoredField is a field that differs from the cluster, but was excluded from
+// the diff by spec.diffIgnore
+type IgnoredField struct {
+	// Object in `kind/name` format
+	Object string `json:"object"`
+	// Path of the field as a JSON pointer
+	Path string `json:"path"`
+
+	// key is the objectKey of the object
+	key string
+}
+
+// ignoreRule is a parsed v1alpha1.DiffIgnoreRule
+type ignoreRule struct {
+	targets process.Matchers
+	fields  [][]string
+}
+
+func parseIgnoreRules(rules []v1alpha1.DiffIgnoreRule) ([]ignoreRule, error) {
+	out := make([]ignoreRule, 0, len(rules))
+	for _, r := range rules {
+		targets, err := process.StrExps(r.Targets...)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing spec.diffIgnore targets")
+		}
+
+		rule := ignoreRule{targets: targets}
+		for _, f := range r.Fields {
+			ptr, err := parsePointer(f)
+			if err != nil {
+				return nil, errors.Wrap(err, "parsing spec.diffIgnore fields")
+			}
+			rule.fields = append(rule.fields, ptr)
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// fieldsFor returns the fields to ignore for m
+func fieldsFor(rules []ignoreRule, m manifest.Manifest) [][]string {
+	var fields [][]string
+	for _, r := range rules {
+		if r.targets.MatchString(m.KindName()) && !r.targets.IgnoreString(m.KindName()) {
+			fields = append(fields, r.fields...)
+		}
+	}
+	return fields
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its reference tokens. A
+// token of `*` matches every key of an object or element of an array.
+func parsePointer(ptr string) ([]string, error) {
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("JSON pointer `%s` must start with `/`", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	escaped := make([]string, len(tokens))
+	for i, t := range tokens {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(t)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// ignoreFields returns copies of live and soon with all fields matched by
+// spec.diffIgnore set to their value in the cluster, or removed if the cluster
+// does not have them. This makes sure no diff strategy reports them.
+func (k *Kubernetes) ignoreFields(live, soon manifest.List) (manifest.List, manifest.List, []IgnoredField, error) {
+	if len(k.Env.Spec.DiffIgnore) == 0 {
+		return live, soon, nil, nil
+	}
+
+	rules, err := parseIgnoreRules(k.Env.Spec.DiffIgnore)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var query manifest.List
+	for _, m := range live {
+		if len(fieldsFor(rules, m)) > 0 {
+			query = append(query, m)
+		}
+	}
+
+	current := make(map[string]manifest.Manifest)
+	if len(query) > 0 {
+		list, err := k.ctl.GetByState(query, client.GetByStateOpts{IgnoreNotFound: true})
+		if _, ok := err.(client.ErrorNothingReturned); ok {
+			list = nil
+		} else if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "fetching live state for spec.diffIgnore")
+		}
+		for _, m := range list {
+			current[objectKey(m)] = m
+		}
+	}
+
+	var ignored []IgnoredField
+	apply := func(list manifest.List, withLive bool) manifest.List {
+		out := make(manifest.List, 0, len(list))
+		for _, m := range list {
+			fields := fieldsFor(rules, m)
+			if len(fields) == 0 {
+				out = append(out, m)
+				continue
+			}
+
+			var is manifest.Manifest
+			if withLive {
+				is = current[objectKey(withNamespace(m, k.defaultNamespace()))]
+				if is == nil {
+					is = current[objectKey(m)]
+				}
+			}
+
+			should := copyManifest(m)
+			for _, f := range fields {
+				for _, path := range ignoreField(is, should, f) {
+					ignored = append(ignored, IgnoredField{
+						Object: m.KindName(),
+						Path:   formatPointer(path),
+						key:    objectKey(m),
+					})
+				}
+			}
+			out = append(out, should)
+		}
+		return out
+	}
+
+	return apply(live, true), apply(soon, false), ignored, nil
+}
+
+// ignorePaths expands wildcards in ptr against both is and should, returning
+// all concrete paths that exist in at least one of them, in order
+func ignorePaths(is, should manifest.Manifest, ptr []string) [][]string {
+	seen := make(map[string]bool)
+	var out [][]string
+	for _, m := range []manifest.Manifest{is, should} {
+		if m == nil {
+			continue
+		}
+		for _, p := range expandPointer(map[string]interface{}(m), ptr, nil) {
+			if key := formatPointer(p); !seen[key] {
+				seen[key] = true
+				out = append(out, p)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return lessPath(out[i], out[j])
+	})
+	return out
+}
+
+// lessPath orders paths by their tokens, comparing array indices numerically
+func lessPath(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(b[i])
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return a[i] < b[i]
+	}
+	return len(a) < len(b)
+}
+
+func expandPointer(v interface{}, ptr, prefix []string) [][]string {
+	if len(ptr) == 0 {
+		return [][]string{append([]string(nil), prefix...)}
+	}
+
+	var out [][]string
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if ptr[0] == "*" {
+			for k, c := range x {
+				out = append(out, expandPointer(c, ptr[1:], append(prefix, k))...)
+			}
+		} else if c, ok := x[ptr[0]]; ok {
+			out = append(out, expandPointer(c, ptr[1:], append(prefix, ptr[0]))...)
+		}
+	case []interface{}:
+		for i, c := range x {
+			if ptr[0] == "*" || ptr[0] == strconv.Itoa(i) {
+				out = append(out, expandPointer(c, ptr[1:], append(prefix, strconv.Itoa(i)))...)
+			}
+		}
+	}
+	return out
+}
+
+// ignoreField sets all fields matched by ptr of should to their value in is, or
+// removes them if is lacks them. Returns the paths that differed.
+func ignoreField(is, should manifest.Manifest, ptr []string) [][]string {
+	var changed, removals [][]string
+	for _, path := range ignorePaths(is, should, ptr) {
+		var isVal interface{}
+		isOk := false
+		if is != nil {
+			isVal, isOk = lookup(map[string]interface{}(is), path)
+		}
+		shouldVal, shouldOk := lookup(map[string]interface{}(should), path)
+
+		if isOk == shouldOk && equalValues(isVal, shouldVal) {
+			continue
+		}
+		changed = append(changed, path)
+
+		if isOk {
+			set(map[string]interface{}(should), path, copyValue(isVal))
+		} else {
+			removals = append(removals, path)
+		}
+	}
+
+	// back to front, so removing array elements does not shift the remaining
+	// ones
+	for i := len(removals) - 1; i >= 0; i-- {
+		remove(map[string]interface{}(should), removals[i])
+	}
+	return changed
+}
+
+func lookup(v interface{}, path []string) (interface{}, bool) {
+	for _, p := range path {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			c, ok := x[p]
+			if !ok {
+				return nil, false
+			}
+			v = c
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			v = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// set sets path of m to v, creating missing objects along the way. Arrays are
+// extended by one element if required. Nothing happens if a parent has the
+// wrong type or an array is too short otherwise.
+func set(m map[string]interface{}, path []string, v interface{}) {
+	var cur interface{} = m
+	for i, p := range path {
+		last := i == len(path)-1
+		switch x := cur.(type) {
+		case map[string]interface{}:
+			if last {
+				x[p] = v
+				return
+			}
+			if _, ok := x[p]; !ok {
+				x[p] = map[string]interface{}{}
+			}
+			cur = x[p]
+		case []interface{}:
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n > len(x) || (n == len(x) && !last) {
+				return
+			}
+			if n == len(x) {
+				set(m, path[:i], append(x, v))
+				return
+			}
+			if last {
+				x[n] = v
+				return
+			}
+			cur = x[n]
+		default:
+			return
+		}
+	}
+}
+
+// remove deletes path from m. Array elements are removed from their array.
+func remove(m map[string]interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+
+	parentPath, key := path[:len(path)-1], path[len(path)-1]
+	parent, ok := lookup(m, parentPath)
+	if !ok {
+		return
+	}
+
+	switch x := parent.(type) {
+	case map[string]interface{}:
+		delete(x, key)
+	case []interface{}:
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 0 || n >= len(x) {
+			return
+		}
+		set(m, parentPath, append(x[:n:n], x[n+1:]...))
+	}
+}
@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestParsePointer(t *testing.T) {
+	ptr, err := parsePointer("/metadata/annotations/cert-manager.io~1inject-ca-from")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"metadata", "annotations", "cert-manager.io/inject-ca-from"}, ptr)
+	assert.Equal(t, "/metadata/annotations/cert-manager.io~1inject-ca-from", formatPointer(ptr))
+
+	_, err = parsePointer("spec/replicas")
+	assert.Error(t, err)
+}
+
+func TestIgnoreField(t *testing.T) {
+	containers := func(names ...string) []interface{} {
+		var list []interface{}
+		for _, n := range names {
+			list = append(list, map[string]interface{}{"name": n})
+		}
+		return list
+	}
+	deploy := func(replicas interface{}, containers []interface{}) manifest.Manifest {
+		d := m("apps/v1", "Deployment", "grafana", "default")
+		d["spec"] = map[string]interface{}{"replicas": replicas, "containers": containers}
+		if replicas == nil {
+			delete(d["spec"].(map[string]interface{}), "replicas")
+		}
+		return d
+	}
+
+	cases := []struct {
+		name    string
+		ptr     string
+		is      manifest.Manifest
+		should  manifest.Manifest
+		want    manifest.Manifest
+		changed []string
+	}{
+		{
+			name:    "copy-live",
+			ptr:     "/spec/replicas",
+			is:      deploy(5.0, containers("grafana")),
+			should:  deploy(1.0, containers("grafana")),
+			want:    deploy(5.0, containers("grafana")),
+			changed: []string{"/spec/replicas"},
+		},
+		{
+			name:    "remove",
+			ptr:     "/spec/replicas",
+			is:      deploy(nil, containers("grafana")),
+			should:  deploy(1.0, containers("grafana")),
+			want:    deploy(nil, containers("grafana")),
+			changed: []string{"/spec/replicas"},
+		},
+		{
+			name:   "equal",
+			ptr:    "/spec/replicas",
+			is:     deploy(int64(1), containers("grafana")),
+			should: deploy(1.0, containers("grafana")),
+			want:   deploy(1.0, containers("grafana")),
+		},
+		{
+			name:    "sidecar",
+			ptr:     "/spec/containers/*",
+			is:      deploy(1.0, containers("grafana", "istio-proxy", "vault-agent")),
+			should:  deploy(1.0, containers("grafana")),
+			want:    deploy(1.0, containers("grafana", "istio-proxy", "vault-agent")),
+			changed: []string{"/spec/containers/1", "/spec/containers/2"},
+		},
+		{
+			name:    "remove-elements",
+			ptr:     "/spec/containers/*",
+			is:      deploy(1.0, containers("grafana")),
+			should:  deploy(1.0, containers("grafana", "a", "b")),
+			want:    deploy(1.0, containers("grafana")),
+			changed: []string{"/spec/containers/1", "/spec/containers/2"},
+		},
+		{
+			name:    "no-live",
+			ptr:     "/spec/replicas",
+			should:  deploy(1.0, containers("grafana")),
+			want:    deploy(nil, containers("grafana")),
+			changed: []string{"/spec/replicas"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ptr, err := parsePointer(c.ptr)
+			require.NoError(t, err)
+
+			var changed []string
+			for _, p := range ignoreField(c.is, c.should, ptr) {
+				changed = append(changed, formatPointer(p))
+			}
+			assert.Equal(t, c.changed, changed)
+			assert.Equal(t, c.want, c.should)
+		})
+	}
+}
+
+func TestIgnoreFields(t *testing.T) {
+	live := m("apps/v1", "Deployment", "grafana", "default")
+	live["spec"] = map[string]interface{}{"replicas": 3.0}
+
+	desired := m("apps/v1", "Deployment", "grafana", "default")
+	desired["spec"] = map[string]interface{}{"replicas": 1.0}
+	other := m("apps/v1", "Deployment", "loki", "default")
+	other["spec"] = map[string]interface{}{"replicas": 1.0}
+
+	k := Kubernetes{
+		Env: v1alpha1.Environment{Spec: v1alpha1.Spec{
+			DiffIgnore: []v1alpha1.DiffIgnoreRule{{
+				Targets: []string{"deployment/.*", "!deployment/loki"},
+				Fields:  []string{"/spec/replicas"},
+			}},
+		}},
+		ctl: &rollbackClient{live: manifest.List{live}},
+	}
+
+	gotLive, _, ignored, err := k.ignoreFields(manifest.List{desired, other}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []IgnoredField{{Object: "Deployment/grafana", Path: "/spec/replicas", key: objectKey(desired)}}, ignored)
+	assert.Equal(t, 3.0, gotLive[0]["spec"].(map[string]interface{})["replicas"])
+	assert.Equal(t, 1.0, gotLive[1]["spec"].(map[string]interface{})["replicas"])
+	// input is not modified
+	assert.Equal(t, 1.0, desired["spec"].(map[string]interface{})["replicas"])
+}
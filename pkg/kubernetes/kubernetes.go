@@ -7,6 +7,7 @@ import (
 
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
 
@@ -14,27 +15,60 @@ import (
 type Kubernetes struct {
 	Env v1alpha1.Environment
 
-	// Client (kubectl)
+	// Client (kubectl or client-go)
 	ctl client.Client
 
 	// Diffing
-	differs map[string]Differ // List of diff strategies
+	differs map[string]differFunc // List of diff strategies
 }
 
 // Differ is responsible for comparing the given manifests to the cluster and
 // returning differences (if any) in `diff(1)` format.
 type Differ func(manifest.List) (*string, error)
 
+// differFunc returns a Differ that formats its output according to opts
+type differFunc func(opts util.DiffOpts) Differ
+
+// fixed returns a differFunc for differs that do not support any options,
+// e.g. because an external program creates the diff
+func fixed(d Differ) differFunc {
+	return func(util.DiffOpts) Differ { return d }
+}
+
+// optsDiffer is implemented by clients that compute server-side diffs on their
+// own and therefore support util.DiffOpts
+type optsDiffer interface {
+	DiffServerSideOpts(manifest.List, util.DiffOpts) (*string, error)
+}
+
+// diffClient is a client.Client that additionally supports the diff
+// strategies beyond server-side diffing
+type diffClient interface {
+	client.Client
+
+	DiffClientSide(manifest.List) (*string, error)
+	ValidateServerSide(manifest.List) (*string, error)
+}
+
+// Available values for spec.client
+const (
+	ClientKubectl  = "kubectl"
+	ClientClientGo = "client-go"
+)
+
+// ErrorClientUnknown occurs when a client is requested that does not exist
+type ErrorClientUnknown struct {
+	Requested string
+}
+
+func (e ErrorClientUnknown) Error() string {
+	return fmt.Sprintf("client `%s` does not exist. Pick one of: [%s, %s]", e.Requested, ClientKubectl, ClientClientGo)
+}
+
 // New creates a new Kubernetes with an initialized client
 func New(env v1alpha1.Environment) (*Kubernetes, error) {
 	// setup client
-	var ctl *client.Kubectl
-	var err error
-	if len(env.Spec.ContextNames) < 1 {
-		ctl, err = client.New(env.Spec.APIServer)
-	} else {
-		ctl, err = client.NewFromNames(env.Spec.ContextNames)
-	}
+	ctl, err := newClient(env.Spec)
 	if err != nil {
 		return nil, err
 	}
@@ -55,17 +89,53 @@ func New(env v1alpha1.Environment) (*Kubernetes, error) {
 	k := Kubernetes{
 		Env: env,
 		ctl: ctl,
-		differs: map[string]Differ{
-			"native":   ctl.DiffClientSide,
-			"validate": ctl.ValidateServerSide,
-			"server":   ctl.DiffServerSide,
-			"subset":   SubsetDiffer(ctl),
+		differs: map[string]differFunc{
+			"native":   fixed(ctl.DiffClientSide),
+			"validate": fixed(ctl.ValidateServerSide),
+			"server":   fixed(ctl.DiffServerSide),
+			"subset": func(opts util.DiffOpts) Differ {
+				return subsetDiffer(ctl, opts)
+			},
+			"semantic": func(opts util.DiffOpts) Differ {
+				return semanticDiffer(ctl, opts)
+			},
 		},
 	}
 
+	// client-go computes all diffs server-side
+	if d, ok := ctl.(optsDiffer); ok {
+		server := func(opts util.DiffOpts) Differ {
+			return func(state manifest.List) (*string, error) {
+				return d.DiffServerSideOpts(state, opts)
+			}
+		}
+		k.differs["native"] = server
+		k.differs["validate"] = server
+		k.differs["server"] = server
+	}
+
 	return &k, nil
 }
 
+// newClient returns the client requested by spec.client, connected to the
+// cluster set in the spec
+func newClient(spec v1alpha1.Spec) (diffClient, error) {
+	switch spec.Client {
+	case "", ClientKubectl:
+		if len(spec.ContextNames) < 1 {
+			return client.New(spec.APIServer)
+		}
+		return client.NewFromNames(spec.ContextNames)
+	case ClientClientGo:
+		if len(spec.ContextNames) < 1 {
+			return client.NewGoClient(spec.APIServer)
+		}
+		return client.NewGoClientFromNames(spec.ContextNames)
+	default:
+		return nil, ErrorClientUnknown{Requested: spec.Client}
+	}
+}
+
 // Close runs final cleanup
 func (k *Kubernetes) Close() error {
 	return k.ctl.Close()
@@ -73,13 +143,17 @@ func (k *Kubernetes) Close() error {
 
 // DiffOpts allow to specify additional parameters for diff operations
 type DiffOpts struct {
-	// Use `diffstat(1)` to create a histogram of the changes instead
+	// Create a histogram of the changes instead (see util.Diffstat)
 	Summarize bool
 	// Find orphaned resources and include them in the diff
 	WithPrune bool
 
 	// Set the diff-strategy. If unset, the value set in the spec is used
 	Strategy string
+	// Context is the number of unchanged lines shown around each change. Only
+	// supported by diff strategies that do not rely on `kubectl diff`. If 0,
+	// util.DefaultDiffContext is used. Use util.NoDiffContext to show none
+	Context int
 }
 
 // Info about the client, etc.
@@ -0,0 +1,184 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/process"
+)
+
+// AnnotationApplyPhase overrides the phase an object is applied in
+const AnnotationApplyPhase = process.MetadataPrefix + "/apply-phase"
+
+// Phases objects are applied in, in order. Each phase is applied separately,
+// so that objects of later phases can rely on those of earlier ones. Helm
+// hooks are applied in the pre-hooks and post-hooks phases (see applyHooks).
+const (
+	PhaseNamespaces  = "namespaces"
+	PhaseCRDs        = "crds"
+	PhaseWebhooks    = "webhooks"
+	PhaseAPIServices = "apiservices"
+	PhasePreHooks    = "pre-hooks"
+	PhaseDefault     = "default"
+	PhasePostHooks   = "post-hooks"
+)
+
+var phaseOrder = []string{PhaseNamespaces, PhaseCRDs, PhaseWebhooks, PhaseAPIServices, PhasePreHooks, PhaseDefault, PhasePostHooks}
+
+// kindPhases are the phases of kinds that are not applied in PhaseDefault
+var kindPhases = map[string]string{
+	"Namespace":                      PhaseNamespaces,
+	"CustomResourceDefinition":       PhaseCRDs,
+	"MutatingWebhookConfiguration":   PhaseWebhooks,
+	"ValidatingWebhookConfiguration": PhaseWebhooks,
+	"APIService":                     PhaseAPIServices,
+}
+
+// phaseWaitKinds are waited for to become ready before the next phase is
+// applied, as objects of later phases may not be accepted before
+var phaseWaitKinds = map[string]bool{
+	"CustomResourceDefinition": true,
+	"APIService":               true,
+}
+
+// phaseWaitTimeout is the maximum time to wait between two phases
+var phaseWaitTimeout = 2 * time.Minute
+
+// ErrorApplyPhaseUnknown occurs when an object requests a phase that does not
+// exist using AnnotationApplyPhase
+type ErrorApplyPhaseUnknown struct {
+	Object    string
+	Requested string
+}
+
+func (e ErrorApplyPhaseUnknown) Error() string {
+	var names []string
+	for _, p := range phaseOrder {
+		if !isHookPhase(p) {
+			names = append(names, p)
+		}
+	}
+	return fmt.Sprintf("%s requests apply phase `%s` using the %s annotation, which does not exist. Pick one of: [%s]",
+		e.Object, e.Requested, AnnotationApplyPhase, strings.Join(names, ", "))
+}
+
+// phase is a group of objects applied together
+type phase struct {
+	name  string
+	state manifest.List
+}
+
+// applyPhases splits state into phases, in the order they need to be applied.
+// Empty phases are omitted and the order of objects within a phase is kept.
+// Helm hooks that are not applied on install or upgrade, like test hooks, are
+// returned as skipped.
+func applyPhases(state manifest.List) (phases []phase, skipped manifest.List, err error) {
+	byPhase := make(map[string]manifest.List)
+	for _, m := range state {
+		h, err := helmHook(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		if h != nil {
+			if h.phase() == "" {
+				skipped = append(skipped, m)
+				continue
+			}
+			byPhase[h.phase()] = append(byPhase[h.phase()], m)
+			continue
+		}
+
+		name, ok := m.Metadata().Annotations()[AnnotationApplyPhase].(string)
+		if !ok {
+			name = kindPhases[m.Kind()]
+		}
+		if name == "" {
+			name = PhaseDefault
+		}
+
+		if !isPhase(name) || isHookPhase(name) {
+			return nil, nil, ErrorApplyPhaseUnknown{Object: objectspec(m), Requested: name}
+		}
+		byPhase[name] = append(byPhase[name], m)
+	}
+
+	for _, name := range phaseOrder {
+		if len(byPhase[name]) > 0 {
+			phases = append(phases, phase{name: name, state: byPhase[name]})
+		}
+	}
+	return phases, skipped, nil
+}
+
+func isPhase(name string) bool {
+	for _, p := range phaseOrder {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// waitPhase waits for the objects of p that later phases may depend on, such as
+// CustomResourceDefinitions to become Established. APIServices backed by a
+// Service of a later phase are not waited for, as they can't become available
+// before.
+func (k *Kubernetes) waitPhase(p phase, later []phase) error {
+	var wait manifest.List
+	for _, m := range p.state {
+		if !phaseWaitKinds[m.Kind()] {
+			continue
+		}
+		if svc := laterBackend(m, later); svc != nil {
+			log.Printf("Not waiting for %s: Its Service %s is applied in phase `%s`", objectspec(m), objectspec(svc.m), svc.phase)
+			continue
+		}
+		wait = append(wait, m)
+	}
+	if len(wait) == 0 {
+		return nil
+	}
+
+	if err := k.Wait(wait, WaitOpts{Timeout: phaseWaitTimeout}); err != nil {
+		return fmt.Errorf("phase `%s` did not become ready: %w", p.name, err)
+	}
+	return nil
+}
+
+type phaseObject struct {
+	m     manifest.Manifest
+	phase string
+}
+
+// laterBackend returns the Service backing the APIService m, if it is part of
+// one of the later phases
+func laterBackend(m manifest.Manifest, later []phase) *phaseObject {
+	if m.Kind() != "APIService" {
+		return nil
+	}
+	spec, _ := m["spec"].(map[string]interface{})
+	svc, _ := spec["service"].(map[string]interface{})
+	name, _ := svc["name"].(string)
+	namespace, _ := svc["namespace"].(string)
+	if name == "" {
+		// served by the kube-apiserver itself
+		return nil
+	}
+
+	for _, p := range later {
+		for _, o := range p.state {
+			if o.Kind() != "Service" || o.Metadata().Name() != name {
+				continue
+			}
+			// objects without a namespace are created in the default one
+			if ns := o.Metadata().Namespace(); ns != "" && ns != namespace {
+				continue
+			}
+			return &phaseObject{m: o, phase: p.name}
+		}
+	}
+	return nil
+}
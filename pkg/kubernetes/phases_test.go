@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func phaseNames(phases []phase) map[string][]string {
+	out := make(map[string][]string)
+	for _, p := range phases {
+		for _, m := range p.state {
+			out[p.name] = append(out[p.name], m.KindName())
+		}
+	}
+	return out
+}
+
+func TestApplyPhases(t *testing.T) {
+	early := m("v1", "ConfigMap", "early", "default")
+	early.Metadata()["annotations"] = map[string]interface{}{AnnotationApplyPhase: "crds"}
+
+	phases, skipped, err := applyPhases(manifest.List{
+		m("v1", "Namespace", "monitoring", ""),
+		m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", ""),
+		m("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "widgets", ""),
+		m("apiregistration.k8s.io/v1", "APIService", "v1.example.com", ""),
+		m("example.com/v1", "Widget", "widget", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		early,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+
+	var order []string
+	for _, p := range phases {
+		order = append(order, p.name)
+	}
+	assert.Equal(t, []string{PhaseNamespaces, PhaseCRDs, PhaseWebhooks, PhaseAPIServices, PhaseDefault}, order)
+	assert.Equal(t, map[string][]string{
+		PhaseNamespaces:  {"Namespace/monitoring"},
+		PhaseCRDs:        {"CustomResourceDefinition/widgets.example.com", "ConfigMap/early"},
+		PhaseWebhooks:    {"ValidatingWebhookConfiguration/widgets"},
+		PhaseAPIServices: {"APIService/v1.example.com"},
+		PhaseDefault:     {"Widget/widget", "Deployment/grafana"},
+	}, phaseNames(phases))
+
+	unknown := m("v1", "ConfigMap", "config", "default")
+	unknown.Metadata()["annotations"] = map[string]interface{}{AnnotationApplyPhase: "later"}
+	_, _, err = applyPhases(manifest.List{unknown})
+	assert.Equal(t, ErrorApplyPhaseUnknown{Object: "ConfigMap/config", Requested: "later"}, err)
+}
+
+// phaseClient records each call to Apply separately
+type phaseClient struct {
+	rollbackClient
+	calls [][]string
+}
+
+func (p *phaseClient) Apply(data manifest.List, opts client.ApplyOpts) error {
+	var names []string
+	for _, m := range data {
+		names = append(names, m.KindName())
+	}
+	p.calls = append(p.calls, names)
+	return nil
+}
+
+func TestApplyInPhases(t *testing.T) {
+	crd := m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", "")
+	established := m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", "")
+	established["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Established", "status": "True"},
+		},
+	}
+
+	c := &phaseClient{rollbackClient: rollbackClient{live: manifest.List{established}}}
+	k := Kubernetes{ctl: c}
+
+	err := k.Apply(manifest.List{crd, m("example.com/v1", "Widget", "widget", "default")}, ApplyOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"CustomResourceDefinition/widgets.example.com"},
+		{"Widget/widget"},
+	}, c.calls)
+}
+
+func TestApplyAPIServices(t *testing.T) {
+	apiService := func() manifest.Manifest {
+		a := m("apiregistration.k8s.io/v1", "APIService", "v1beta1.metrics.k8s.io", "")
+		a["spec"] = map[string]interface{}{
+			"service": map[string]interface{}{"name": "metrics-server", "namespace": "kube-system"},
+		}
+		return a
+	}
+	available := apiService()
+	available["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Available", "status": "True"},
+		},
+	}
+
+	// the backend is applied later, so the APIService is not waited for
+	c := &phaseClient{}
+	k := Kubernetes{ctl: c}
+	err := k.Apply(manifest.List{
+		apiService(),
+		m("v1", "Service", "metrics-server", "kube-system"),
+		m("apps/v1", "Deployment", "metrics-server", "kube-system"),
+	}, ApplyOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"APIService/v1beta1.metrics.k8s.io"},
+		{"Service/metrics-server", "Deployment/metrics-server"},
+	}, c.calls)
+
+	// otherwise it must become available first
+	svc := m("v1", "Service", "metrics-server", "kube-system")
+	svc.Metadata()["annotations"] = map[string]interface{}{AnnotationApplyPhase: PhaseAPIServices}
+	c = &phaseClient{rollbackClient: rollbackClient{live: manifest.List{available}}}
+	k = Kubernetes{ctl: c}
+	err = k.Apply(manifest.List{
+		apiService(),
+		svc,
+		m("example.com/v1", "Widget", "widget", "default"),
+	}, ApplyOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"APIService/v1beta1.metrics.k8s.io", "Service/metrics-server"},
+		{"Widget/widget"},
+	}, c.calls)
+}
+
+func TestCRDReady(t *testing.T) {
+	crd := m("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", "")
+	ready, _, err := crdReady(crd)
+	assert.False(t, ready)
+	assert.NoError(t, err)
+
+	crd["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "NamesAccepted", "status": "False", "message": "name conflict"},
+		},
+	}
+	_, _, err = crdReady(crd)
+	assert.EqualError(t, err, "name conflict")
+}
@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// ResourceVersions returns the resourceVersion of the live version of each
+// object in state, keyed by `group/kind/namespace/name` (the group is omitted
+// for the core API). Objects that don't exist yet have an empty one.
+func (k *Kubernetes) ResourceVersions(state manifest.List) (map[string]string, error) {
+	existing, created, err := k.existing(state)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(existing)+len(created))
+	for _, m := range created {
+		versions[versionKey(m)] = ""
+	}
+	for _, m := range existing {
+		rv, _ := m.Metadata()["resourceVersion"].(string)
+		versions[versionKey(m)] = rv
+	}
+	return versions, nil
+}
+
+func versionKey(m manifest.Manifest) string {
+	return strings.TrimPrefix(objectKey(m), "/")
+}
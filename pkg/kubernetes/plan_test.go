@@ -0,0 +1,28 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestResourceVersions(t *testing.T) {
+	live := m("apps/v1", "Deployment", "grafana", "default")
+	live.Metadata()["resourceVersion"] = "42"
+
+	k := Kubernetes{ctl: &rollbackClient{live: manifest.List{live}}}
+	k.Env.Spec.Namespace = "default"
+
+	versions, err := k.ResourceVersions(manifest.List{
+		m("apps/v1", "Deployment", "grafana", ""),
+		m("v1", "ConfigMap", "grafana", "default"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"apps/Deployment/default/grafana": "42",
+		"ConfigMap/default/grafana":       "",
+	}, versions)
+}
@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// Snapshot holds the state of the cluster before an apply, so that it can be
+// restored using Rollback
+type Snapshot struct {
+	// Live versions of all objects that existed before the apply
+	Live manifest.List
+	// Created holds all objects of the state that did not exist yet
+	Created manifest.List
+}
+
+// Snapshot captures the live versions of all objects in state. Objects that
+// cannot exist yet, because their namespace or kind is about to be created as
+// well, are recorded as created.
+func (k *Kubernetes) Snapshot(state manifest.List) (*Snapshot, error) {
+	existing, created, err := k.existing(state)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Snapshot{Created: created}
+	for _, m := range existing {
+		s.Live = append(s.Live, restorable(m))
+	}
+	return &s, nil
+}
+
+// existing splits state into the live versions of the objects that exist in
+// the cluster, and the desired ones of those that don't
+func (k *Kubernetes) existing(state manifest.List) (existing, created manifest.List, err error) {
+	namespaces, err := k.ctl.Namespaces()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing namespaces")
+	}
+	resources, err := k.ctl.Resources()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing known api-resources")
+	}
+
+	known := make(map[string]bool)
+	for _, r := range resources {
+		known[r.Kind] = true
+	}
+
+	live, soon := separate(state, k.Env.Spec.Namespace, separateOpts{
+		namespaces: namespaces,
+		resources:  resources,
+	})
+	created = append(created, soon...)
+
+	var query manifest.List
+	for _, m := range live {
+		if !known[m.Kind()] {
+			created = append(created, m)
+			continue
+		}
+		query = append(query, m)
+	}
+
+	if len(query) == 0 {
+		return nil, created, nil
+	}
+
+	existing, err = k.ctl.GetByState(query, client.GetByStateOpts{IgnoreNotFound: true})
+	if _, ok := err.(client.ErrorNothingReturned); ok {
+		existing = nil
+	} else if err != nil {
+		return nil, nil, errors.Wrap(err, "fetching live state")
+	}
+
+	found := make(map[string]bool)
+	for _, m := range existing {
+		found[objectKey(m)] = true
+	}
+	for _, m := range query {
+		if resources.Namespaced(m) {
+			m = withNamespace(m, k.defaultNamespace())
+		}
+		if !found[objectKey(m)] {
+			created = append(created, m)
+		}
+	}
+
+	return existing, created, nil
+}
+
+// Rollback restores the cluster to the given Snapshot: the previous versions of
+// all objects are applied again and objects created since are deleted.
+func (k *Kubernetes) Rollback(s *Snapshot, opts ApplyOpts) error {
+	fmt.Println("Rolling back ..")
+
+	if len(s.Live) > 0 {
+		// the snapshot is the source of truth now, take over fields if needed.
+		// For client-side apply, --force would delete and recreate objects
+		// that fail to patch, so it is left as requested
+		if opts.ApplyStrategy == "server" {
+			opts.Force = true
+		}
+		if err := k.Apply(s.Live, opts); err != nil {
+			return errors.Wrap(err, "restoring previous state")
+		}
+		for _, m := range s.Live {
+			fmt.Printf("restored %s\n", objectspec(m))
+		}
+	}
+
+	if len(s.Created) > 0 {
+		created := make(manifest.List, len(s.Created))
+		copy(created, s.Created)
+		if err := k.Delete(created, DeleteOpts{}); err != nil {
+			return errors.Wrap(err, "removing created objects")
+		}
+		for _, m := range s.Created {
+			fmt.Printf("removed %s\n", objectspec(m))
+		}
+	}
+
+	return nil
+}
+
+// restorable strips all fields set by the API server from m, so that it can be
+// applied again
+func restorable(m manifest.Manifest) manifest.Manifest {
+	meta := m.Metadata()
+	for _, k := range []string{"uid", "resourceVersion", "managedFields", "creationTimestamp", "generation", "selfLink"} {
+		delete(meta, k)
+	}
+	delete(m, "status")
+	return m
+}
+
+// withNamespace returns m with its namespace set to ns, if it has none. The
+// input is not modified.
+func withNamespace(m manifest.Manifest, ns string) manifest.Manifest {
+	if m.Metadata().Namespace() != "" {
+		return m
+	}
+
+	meta := make(map[string]interface{})
+	for k, v := range m.Metadata() {
+		meta[k] = v
+	}
+	meta["namespace"] = ns
+
+	out := make(manifest.Manifest)
+	for k, v := range m {
+		out[k] = v
+	}
+	out["metadata"] = meta
+	return out
+}
@@ -0,0 +1,126 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// rollbackClient serves live objects and records changes made to the cluster
+type rollbackClient struct {
+	client.Client
+	live manifest.List
+
+	applied    manifest.List
+	applyOpts  []client.ApplyOpts
+	deleted    []string
+	deleteOpts []client.DeleteOpts
+}
+
+func (r *rollbackClient) Namespaces() (map[string]bool, error) {
+	return map[string]bool{"default": true}, nil
+}
+
+func (r *rollbackClient) Resources() (client.Resources, error) {
+	return client.Resources{
+		{APIVersion: "v1", Kind: "Namespace", Name: "namespaces"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "deployments", Namespaced: true},
+	}, nil
+}
+
+func (r *rollbackClient) GetByState(manifest.List, client.GetByStateOpts) (manifest.List, error) {
+	return r.live, nil
+}
+
+func (r *rollbackClient) Apply(data manifest.List, opts client.ApplyOpts) error {
+	r.applied = append(r.applied, data...)
+	r.applyOpts = append(r.applyOpts, opts)
+	return nil
+}
+
+func (r *rollbackClient) Delete(namespace, kind, name string, opts client.DeleteOpts) error {
+	r.deleted = append(r.deleted, kind+"/"+name)
+	r.deleteOpts = append(r.deleteOpts, opts)
+	return nil
+}
+
+func TestSnapshotRollback(t *testing.T) {
+	state := manifest.List{
+		m("v1", "Namespace", "monitoring", ""),
+		m("v1", "ConfigMap", "config", ""),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("apps/v1", "Deployment", "loki", "monitoring"),
+		m("example.com/v1", "Widget", "widget", "default"),
+	}
+
+	live := m("v1", "ConfigMap", "config", "default")
+	live.Metadata()["uid"] = "1234"
+	live.Metadata()["resourceVersion"] = "42"
+	live.Metadata()["managedFields"] = []interface{}{}
+	live["status"] = map[string]interface{}{}
+	live["data"] = map[string]interface{}{"foo": "bar"}
+
+	c := &rollbackClient{live: manifest.List{live}}
+	k := Kubernetes{ctl: c}
+
+	snapshot, err := k.Snapshot(state)
+	require.NoError(t, err)
+
+	assert.Equal(t, manifest.List{{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config", "namespace": "default"},
+		"data":       map[string]interface{}{"foo": "bar"},
+	}}, snapshot.Live)
+
+	created := []string{}
+	for _, m := range snapshot.Created {
+		created = append(created, m.KindName())
+	}
+	assert.ElementsMatch(t, []string{"Namespace/monitoring", "Deployment/grafana", "Deployment/loki", "Widget/widget"}, created)
+
+	require.NoError(t, k.Rollback(snapshot, ApplyOpts{ApplyStrategy: "server"}))
+	assert.Equal(t, snapshot.Live, c.applied)
+	// deleted in reverse order
+	assert.Equal(t, []string{"Widget/widget", "Deployment/loki", "Deployment/grafana", "Namespace/monitoring"}, c.deleted)
+}
+
+func TestRollbackForce(t *testing.T) {
+	cases := []struct {
+		name string
+		opts ApplyOpts
+		want client.ApplyOpts
+	}{
+		{
+			name: "server-side takes over fields",
+			opts: ApplyOpts{ApplyStrategy: "server"},
+			want: client.ApplyOpts{ApplyStrategy: "server", Force: true},
+		},
+		{
+			name: "client-side does not recreate objects",
+			opts: ApplyOpts{},
+			want: client.ApplyOpts{},
+		},
+		{
+			name: "client-side force as requested",
+			opts: ApplyOpts{Force: true},
+			want: client.ApplyOpts{Force: true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rc := &rollbackClient{}
+			k := Kubernetes{ctl: rc}
+
+			snapshot := &Snapshot{Live: manifest.List{m("v1", "ConfigMap", "config", "default")}}
+			require.NoError(t, k.Rollback(snapshot, c.opts))
+			assert.Equal(t, []client.ApplyOpts{c.want}, rc.applyOpts)
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+)
+
+// ownManagers are the field managers used when applying with Tanka
+var ownManagers = map[string]bool{
+	client.FieldManager:         true,
+	"kubectl-client-side-apply": true,
+}
+
+// quantityParents are keys whose values are resource quantities (e.g.
+// `resources.limits.cpu`)
+var quantityParents = map[string]bool{
+	"limits":      true,
+	"requests":    true,
+	"hard":        true,
+	"capacity":    true,
+	"allocatable": true,
+}
+
+// SemanticDiffer returns a Differ that compares objects field by field. Unlike
+// the other strategies, it
+//
+//   - treats equal resource quantities (`1` and `1000m`), durations (`60s` and
+//     `1m`) and empty values as unchanged
+//   - ignores fields only other field managers own, according to `managedFields`
+//   - ignores fields added by the cluster that were never set by Tanka
+//
+// Changes are rendered per field, in a format compatible with `diff -u`.
+func SemanticDiffer(c client.Client) Differ {
+	return semanticDiffer(c, util.DiffOpts{Context: util.DefaultDiffContext})
+}
+
+func semanticDiffer(c client.Client, opts util.DiffOpts) Differ {
+	return func(state manifest.List) (*string, error) {
+		live, err := c.GetByState(state, client.GetByStateOpts{IgnoreNotFound: true})
+		if _, ok := err.(client.ErrorNothingReturned); ok {
+			live = nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "getting state from cluster")
+		}
+
+		byKey := make(map[string]manifest.Manifest)
+		for _, m := range live {
+			byKey[objectKey(m)] = m
+		}
+
+		s := ""
+		for _, m := range state {
+			is, ok := byKey[objectKey(m)]
+			if !ok {
+				// might lack the namespace, which the cluster defaults
+				for key, l := range byKey {
+					if objectKey(withNamespace(m, l.Metadata().Namespace())) == key {
+						is, ok = l, true
+						break
+					}
+				}
+			}
+
+			var d string
+			if ok {
+				d = semanticDiff(util.DiffName(m), is, m)
+			} else {
+				d, err = util.DiffStrOpts(util.DiffName(m), "", m.String(), opts)
+				if err != nil {
+					return nil, err
+				}
+			}
+			s += d
+		}
+
+		if s == "" {
+			return nil, nil
+		}
+		return &s, nil
+	}
+}
+
+// semanticDiff renders the semantic differences between the live and the
+// desired version of an object
+func semanticDiff(name string, live, desired manifest.Manifest) string {
+	is, should := semanticPair(live, desired)
+	changes := fieldChanges(is, should)
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "diff -u -N LIVE/%s MERGED/%s\n", name, name)
+	fmt.Fprintf(&buf, "--- LIVE/%s\n", name)
+	fmt.Fprintf(&buf, "+++ MERGED/%s\n", name)
+	for _, c := range changes {
+		fmt.Fprintf(&buf, "@@ %s @@\n", c.Path)
+		writeValue(&buf, "-", c.Old)
+		writeValue(&buf, "+", c.New)
+	}
+	return buf.String()
+}
+
+// writeValue writes v in yaml format, each line prefixed with prefix. Nothing
+// is written for nil values, as these denote a missing field
+func writeValue(buf *strings.Builder, prefix string, v interface{}) {
+	if v == nil {
+		return
+	}
+
+	y, err := yaml.Marshal(v)
+	if err != nil {
+		// only JSON data is passed, which always marshals
+		panic(errors.Wrap(err, "formatting value"))
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(y), "\n"), "\n") {
+		buf.WriteString(prefix + line + "\n")
+	}
+}
+
+// semanticPair prepares live and desired for comparison: Fields not relevant to
+// the diff are removed and semantically equal values are made identical.
+func semanticPair(live, desired manifest.Manifest) (is, should map[string]interface{}) {
+	ours, others := fieldSets(live)
+
+	live = copyManifest(live)
+	delete(live, "status")
+	meta := live.Metadata()
+	delete(meta, "managedFields")
+	delete(meta.Annotations(), AnnotationLastApplied)
+
+	// without managedFields, Tanka can't know which fields it set previously,
+	// so only those it sets now are compared (like SubsetDiffer)
+	i, s := semanticValues(nil, map[string]interface{}(live), map[string]interface{}(desired), ours, others)
+	is, _ = i.(map[string]interface{})
+	should, _ = s.(map[string]interface{})
+	return is, should
+}
+
+// semanticValues returns is and should ready for comparison. path are the keys
+// leading to the values, ours and others the fields owned at that path.
+func semanticValues(path []string, is, should interface{}, ours, others fieldSet) (interface{}, interface{}) {
+	switch s := should.(type) {
+	case map[string]interface{}:
+		i, ok := is.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		outIs, outShould := make(map[string]interface{}), make(map[string]interface{})
+		for k := range union(i, s) {
+			iv, inIs := i[k]
+			sv, inShould := s[k]
+			key := "f:" + k
+
+			switch {
+			// empty values are the same as missing ones
+			case isEmpty(iv) && isEmpty(sv):
+				continue
+			// added by the cluster or another manager
+			case inIs && !inShould && !ours.has(key):
+				continue
+			// owned exclusively by others, e.g. replicas set by an autoscaler
+			case inIs && inShould && isLeaf(sv) && others.has(key) && !ours.has(key):
+				continue
+			}
+
+			iv, sv = semanticValues(append(path, k), iv, sv, ours.child(key), others.child(key))
+			if inIs {
+				outIs[k] = iv
+			}
+			if inShould {
+				outShould[k] = sv
+			}
+		}
+		return outIs, outShould
+	case []interface{}:
+		i, ok := is.([]interface{})
+		if !ok {
+			break
+		}
+
+		outIs, outShould := make([]interface{}, len(i)), make([]interface{}, len(s))
+		copy(outIs, i)
+		copy(outShould, s)
+		for n := 0; n < len(i) && n < len(s); n++ {
+			key := ours.elementKey(n, i[n])
+			otherKey := others.elementKey(n, i[n])
+			outIs[n], outShould[n] = semanticValues(append(path, fmt.Sprint(n)), i[n], s[n], ours.child(key), others.child(otherKey))
+		}
+		return outIs, outShould
+	}
+
+	if semanticEqual(path, is, should) {
+		return should, should
+	}
+	return is, should
+}
+
+// semanticEqual compares two leaf values
+func semanticEqual(path []string, a, b interface{}) bool {
+	if equalValues(a, b) {
+		return true
+	}
+
+	// resource quantities, e.g. `cpu: 1` and `cpu: 1000m`
+	if len(path) >= 2 && (quantityParents[path[len(path)-2]] || path[len(path)-1] == "storage") {
+		qa, errA := resource.ParseQuantity(fmt.Sprint(a))
+		qb, errB := resource.ParseQuantity(fmt.Sprint(b))
+		if errA == nil && errB == nil {
+			return qa.Cmp(qb) == 0
+		}
+	}
+
+	// durations, e.g. `60s` and `1m`. Skip arbitrary user data, which may
+	// contain anything
+	if len(path) > 0 && (path[0] == "data" || path[0] == "stringData" || path[0] == "binaryData") {
+		return false
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		da, errA := time.ParseDuration(sa)
+		db, errB := time.ParseDuration(sb)
+		return errA == nil && errB == nil && da == db
+	}
+
+	return false
+}
+
+func isEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(x) == 0
+	case []interface{}:
+		return len(x) == 0
+	}
+	return false
+}
+
+func isLeaf(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// fieldSet is a decoded `fieldsV1` entry of managedFields
+type fieldSet map[string]interface{}
+
+// fieldSets merges the fields owned by Tanka (ours) and all other field
+// managers (others) of m. Both are nil if m has no managedFields.
+func fieldSets(m manifest.Manifest) (ours, others fieldSet) {
+	for _, raw := range m.Metadata().ManagedFields() {
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields, _ := entry["fieldsV1"].(map[string]interface{})
+		manager, _ := entry["manager"].(string)
+
+		if ownManagers[manager] {
+			ours = mergeFieldSets(ours, fields)
+		} else {
+			others = mergeFieldSets(others, fields)
+		}
+	}
+	return ours, others
+}
+
+func mergeFieldSets(a fieldSet, b map[string]interface{}) fieldSet {
+	if a == nil {
+		a = fieldSet{}
+	}
+	for k, v := range b {
+		bv, _ := v.(map[string]interface{})
+		av, _ := a[k].(fieldSet)
+		a[k] = mergeFieldSets(av, bv)
+	}
+	return a
+}
+
+func (f fieldSet) has(key string) bool {
+	_, ok := f[key]
+	return ok
+}
+
+func (f fieldSet) child(key string) fieldSet {
+	c, _ := f[key].(fieldSet)
+	return c
+}
+
+// elementKey returns the key of the list element v at index n. Lists are
+// either keyed by fields of their elements (`k:{"name":"foo"}`), by their
+// values (`v:"foo"`), or by index (`i:0`).
+func (f fieldSet) elementKey(n int, v interface{}) string {
+	for key := range f {
+		if !strings.HasPrefix(key, "k:") {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &fields); err != nil {
+			continue
+		}
+		if matchesFields(v, fields) {
+			return key
+		}
+	}
+
+	if raw, err := json.Marshal(v); err == nil && f.has("v:"+string(raw)) {
+		return "v:" + string(raw)
+	}
+	return fmt.Sprintf("i:%d", n)
+}
+
+func matchesFields(v interface{}, fields map[string]interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, want := range fields {
+		if !equalValues(m[k], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyManifest returns a deep copy of m
+func copyManifest(m manifest.Manifest) manifest.Manifest {
+	return manifest.Manifest(copyValue(map[string]interface{}(m)).(map[string]interface{}))
+}
+
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			out[k] = copyValue(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, v := range x {
+			out[i] = copyValue(v)
+		}
+		return out
+	}
+	return v
+}
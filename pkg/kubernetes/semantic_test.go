@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func semanticDeployment(replicas interface{}, cpu interface{}) manifest.Manifest {
+	return manifest.Manifest{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "grafana", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":      "grafana",
+							"image":     "grafana/grafana",
+							"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": cpu}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestSemanticDiff(t *testing.T) {
+	live := semanticDeployment(5.0, "1000m")
+	live.Metadata()["uid"] = "1234"
+	live.Metadata()["managedFields"] = []interface{}{
+		map[string]interface{}{
+			"manager": "tanka",
+			"fieldsV1": map[string]interface{}{
+				"f:metadata": map[string]interface{}{"f:labels": map[string]interface{}{"f:app": map[string]interface{}{}}},
+				"f:spec": map[string]interface{}{
+					"f:template": map[string]interface{}{"f:spec": map[string]interface{}{
+						"f:containers": map[string]interface{}{
+							`k:{"name":"grafana"}`: map[string]interface{}{
+								"f:image": map[string]interface{}{},
+							},
+						},
+					}},
+				},
+			},
+		},
+		map[string]interface{}{
+			"manager": "kube-controller-manager",
+			"fieldsV1": map[string]interface{}{
+				"f:spec": map[string]interface{}{"f:replicas": map[string]interface{}{}},
+			},
+		},
+	}
+	live.Metadata()["labels"] = map[string]interface{}{"app": "grafana"}
+	live["spec"].(map[string]interface{})["progressDeadlineSeconds"] = 600.0
+	live["status"] = map[string]interface{}{"replicas": 5.0}
+
+	// replicas owned by others, equal cpu, empty labels, defaulted fields:
+	// only the removed labels are left
+	desired := semanticDeployment(1.0, 1.0)
+	assert.Equal(t, `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ metadata.labels @@
+-app: grafana
+`, semanticDiff("x", live, desired))
+
+	desired.Metadata()["labels"] = map[string]interface{}{"app": "grafana"}
+	assert.Equal(t, "", semanticDiff("x", live, desired))
+
+	desired = semanticDeployment(1.0, "2")
+	desired.Metadata()["labels"] = map[string]interface{}{"app": "grafana"}
+	containers := desired["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	containers[0].(map[string]interface{})["image"] = "grafana/grafana:8.0.0"
+	assert.Equal(t, `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ spec.template.spec.containers[0].image @@
+-grafana/grafana
++grafana/grafana:8.0.0
+@@ spec.template.spec.containers[0].resources.limits.cpu @@
+-1000m
++"2"
+`, semanticDiff("x", live, desired))
+}
+
+func TestSemanticEqual(t *testing.T) {
+	cases := []struct {
+		path  []string
+		a, b  interface{}
+		equal bool
+	}{
+		{[]string{"resources", "limits", "cpu"}, 1.0, "1000m", true},
+		{[]string{"resources", "requests", "memory"}, "1Gi", "1024Mi", true},
+		{[]string{"resources", "requests", "memory"}, "1G", "1Gi", false},
+		{[]string{"spec", "interval"}, "60s", "1m", true},
+		{[]string{"data", "interval"}, "60s", "1m", false},
+		{[]string{"spec", "replicas"}, int64(1), 1.0, true},
+		{[]string{"spec", "image"}, "a", "b", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.equal, semanticEqual(c.path, c.a, c.b), c)
+	}
+}
+
+func TestSemanticDifferCreated(t *testing.T) {
+	d := SemanticDiffer(&rollbackClient{})
+	got, err := d(manifest.List{m("v1", "ConfigMap", "config", "default")})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Contains(t, *got, "+kind: ConfigMap\n")
+}
@@ -0,0 +1,260 @@
+package kubernetes
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// ChangeType describes what happens to an object on apply
+type ChangeType string
+
+// Possible values of ChangeType
+const (
+	ChangeCreate    ChangeType = "create"
+	ChangeUpdate    ChangeType = "update"
+	ChangeDelete    ChangeType = "delete"
+	ChangeUnchanged ChangeType = "unchanged"
+)
+
+// Groups objects are sorted into while diffing. See `separate` for details
+const (
+	GroupLive     = "live"
+	GroupSoon     = "soon"
+	GroupOrphaned = "orphaned"
+)
+
+// ObjectDiff is the machine readable difference of a single object
+type ObjectDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+
+	Change ChangeType    `json:"change"`
+	Group  string        `json:"group"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	// Ignored fields that differ, but were excluded by spec.diffIgnore
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// FieldChange is a single field that differs between the cluster and the
+// desired state. Old or New are nil if the field is absent on that side.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// DiffStructured returns the differences of state to the cluster as one
+// ObjectDiff per object. Fields populated by the cluster are not reported.
+//
+// With the subset strategy, only fields present in the desired state are
+// compared, like SubsetDiffer does. All other strategies compare like
+// SemanticDiffer, which also reports fields Tanka set previously, but that
+// were removed from the desired state since, according to `managedFields`.
+func (k *Kubernetes) DiffStructured(state manifest.List, opts DiffOpts) ([]ObjectDiff, error) {
+	strategy := k.Env.Spec.DiffStrategy
+	if opts.Strategy != "" {
+		strategy = opts.Strategy
+	}
+	if _, ok := k.differs[strategy]; !ok && strategy != "" {
+		return nil, ErrorDiffStrategyUnknown{Requested: strategy, differs: k.differs}
+	}
+
+	state, err := withoutTransientHooks(state)
+	if err != nil {
+		return nil, err
+	}
+
+	live, soon, err := k.separate(state)
+	if err != nil {
+		return nil, err
+	}
+
+	live, soon, ignored, err := k.ignoreFields(live, soon)
+	if err != nil {
+		return nil, err
+	}
+	ignoredByKey := make(map[string][]string)
+	for _, f := range ignored {
+		ignoredByKey[f.key] = append(ignoredByKey[f.key], f.Path)
+	}
+
+	resources, err := k.ctl.Resources()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing known api-resources")
+	}
+
+	current, err := k.ctl.GetByState(live, client.GetByStateOpts{IgnoreNotFound: true})
+	if _, ok := err.(client.ErrorNothingReturned); ok {
+		current = nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "fetching live state")
+	}
+
+	byKey := make(map[string]manifest.Manifest)
+	for _, m := range current {
+		byKey[objectKey(m)] = m
+	}
+
+	var diffs []ObjectDiff
+	for _, m := range live {
+		ignored := ignoredByKey[objectKey(m)]
+		if resources.Namespaced(m) {
+			m = withNamespace(m, k.defaultNamespace())
+		}
+
+		d := objectDiff(m, GroupLive, ChangeCreate)
+		d.Ignored = ignored
+		if is, ok := byKey[objectKey(m)]; ok {
+			if strategy == "subset" {
+				d.Fields = fieldChanges(subset(m, is), map[string]interface{}(m))
+			} else {
+				d.Fields = fieldChanges(semanticPair(is, m))
+			}
+			d.Change = ChangeUnchanged
+			if len(d.Fields) > 0 {
+				d.Change = ChangeUpdate
+			}
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, m := range soon {
+		d := objectDiff(withNamespace(m, k.defaultNamespace()), GroupSoon, ChangeCreate)
+		d.Ignored = ignoredByKey[objectKey(m)]
+		diffs = append(diffs, d)
+	}
+
+	if opts.WithPrune {
+		orphaned, err := k.Orphaned(state)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range orphaned {
+			diffs = append(diffs, objectDiff(m, GroupOrphaned, ChangeDelete))
+		}
+	}
+
+	return diffs, nil
+}
+
+func objectDiff(m manifest.Manifest, group string, change ChangeType) ObjectDiff {
+	return ObjectDiff{
+		APIVersion: m.APIVersion(),
+		Kind:       m.Kind(),
+		Namespace:  m.Metadata().Namespace(),
+		Name:       m.Metadata().Name(),
+		Change:     change,
+		Group:      group,
+	}
+}
+
+// defaultNamespace returns the namespace objects without one are created in
+func (k *Kubernetes) defaultNamespace() string {
+	if k.Env.Spec.Namespace != "" {
+		return k.Env.Spec.Namespace
+	}
+	return "default"
+}
+
+// fieldChanges returns all leaf fields that differ between is and should,
+// sorted by path
+func fieldChanges(is, should map[string]interface{}) []FieldChange {
+	changes := fieldChangesAt("", is, should)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func fieldChangesAt(path string, is, should interface{}) []FieldChange {
+	switch s := should.(type) {
+	case map[string]interface{}:
+		i, ok := is.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		var changes []FieldChange
+		for k := range union(i, s) {
+			changes = append(changes, fieldChangesAt(fieldPath(path, k), i[k], s[k])...)
+		}
+		return changes
+	case []interface{}:
+		i, ok := is.([]interface{})
+		if !ok {
+			break
+		}
+
+		var changes []FieldChange
+		for n := 0; n < len(i) || n < len(s); n++ {
+			var iv, sv interface{}
+			if n < len(i) {
+				iv = i[n]
+			}
+			if n < len(s) {
+				sv = s[n]
+			}
+			changes = append(changes, fieldChangesAt(fmt.Sprintf("%s[%d]", path, n), iv, sv)...)
+		}
+		return changes
+	}
+
+	if equalValues(is, should) {
+		return nil
+	}
+	return []FieldChange{{Path: path, Old: is, New: should}}
+}
+
+// fieldPath appends key to path. Keys that are no valid identifiers (e.g.
+// label names) are quoted.
+func fieldPath(path, key string) string {
+	if strings.ContainsAny(key, `./[]"`) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func union(a, b map[string]interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// equalValues compares two leaf values. Numbers are compared by value, as they
+// may be float64 or int64 depending on how they were decoded.
+func equalValues(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,114 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestFieldChanges(t *testing.T) {
+	is := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "grafana"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"ports":    []interface{}{80.0, 443.0},
+		},
+	}
+	should := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "loki"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 1.0,
+			"ports":    []interface{}{80.0},
+			"paused":   true,
+		},
+	}
+
+	assert.Equal(t, []FieldChange{
+		{Path: `metadata.labels["app.kubernetes.io/name"]`, Old: "grafana", New: "loki"},
+		{Path: "spec.paused", Old: nil, New: true},
+		{Path: "spec.ports[1]", Old: 443.0, New: nil},
+	}, fieldChanges(is, should))
+}
+
+func TestDiffStructured(t *testing.T) {
+	state := manifest.List{
+		m("v1", "Namespace", "monitoring", ""),
+		m("v1", "ConfigMap", "config", ""),
+		m("v1", "ConfigMap", "unchanged", "default"),
+		m("apps/v1", "Deployment", "grafana", "default"),
+		m("apps/v1", "Deployment", "loki", "monitoring"),
+	}
+	state[1]["data"] = map[string]interface{}{"foo": "baz"}
+
+	config := m("v1", "ConfigMap", "config", "default")
+	config["data"] = map[string]interface{}{"foo": "bar", "old": "removed from jsonnet"}
+	config.Metadata()["uid"] = "1234"
+	config.Metadata()["managedFields"] = []interface{}{
+		map[string]interface{}{
+			"manager": "tanka",
+			"fieldsV1": map[string]interface{}{
+				"f:data": map[string]interface{}{"f:foo": map[string]interface{}{}, "f:old": map[string]interface{}{}},
+			},
+		},
+	}
+
+	unchanged := m("v1", "ConfigMap", "unchanged", "default")
+	unchanged.Metadata()["resourceVersion"] = "42"
+
+	k := Kubernetes{
+		Env:     v1alpha1.Environment{Spec: v1alpha1.Spec{Namespace: "default", DiffStrategy: "server"}},
+		ctl:     &rollbackClient{live: manifest.List{config, unchanged}},
+		differs: map[string]differFunc{"server": nil, "subset": nil},
+	}
+
+	diffs, err := k.DiffStructured(state, DiffOpts{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []ObjectDiff{
+		{APIVersion: "v1", Kind: "Namespace", Name: "monitoring", Change: ChangeCreate, Group: GroupLive},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "config", Change: ChangeUpdate, Group: GroupLive, Fields: []FieldChange{
+			{Path: "data.foo", Old: "bar", New: "baz"},
+			{Path: "data.old", Old: "removed from jsonnet", New: nil},
+		}},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "unchanged", Change: ChangeUnchanged, Group: GroupLive},
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "grafana", Change: ChangeCreate, Group: GroupLive},
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "monitoring", Name: "loki", Change: ChangeCreate, Group: GroupSoon},
+	}, diffs)
+}
+
+func TestDiffStructuredStrategy(t *testing.T) {
+	live := m("v1", "ConfigMap", "config", "default")
+	live["data"] = map[string]interface{}{"foo": "bar", "old": "removed from jsonnet"}
+	live.Metadata()["managedFields"] = []interface{}{
+		map[string]interface{}{
+			"manager":  "tanka",
+			"fieldsV1": map[string]interface{}{"f:data": map[string]interface{}{"f:old": map[string]interface{}{}}},
+		},
+	}
+
+	desired := m("v1", "ConfigMap", "config", "default")
+	desired["data"] = map[string]interface{}{"foo": "bar"}
+
+	k := Kubernetes{
+		Env:     v1alpha1.Environment{Spec: v1alpha1.Spec{Namespace: "default"}},
+		ctl:     &rollbackClient{live: manifest.List{live}},
+		differs: map[string]differFunc{"subset": nil},
+	}
+
+	// subset only compares fields of the desired state
+	diffs, err := k.DiffStructured(manifest.List{desired}, DiffOpts{Strategy: "subset"})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, ChangeUnchanged, diffs[0].Change)
+
+	_, err = k.DiffStructured(manifest.List{desired}, DiffOpts{Strategy: "nope"})
+	assert.IsType(t, ErrorDiffStrategyUnknown{}, err)
+}
@@ -20,6 +20,10 @@ type difference struct {
 // miss information, but is all that's possible on cluster versions lower than
 // 1.13.
 func SubsetDiffer(c client.Client) Differ {
+	return subsetDiffer(c, util.DiffOpts{Context: util.DefaultDiffContext})
+}
+
+func subsetDiffer(c client.Client, opts util.DiffOpts) Differ {
 	return func(state manifest.List) (*string, error) {
 		docs := []difference{}
 
@@ -48,7 +52,7 @@ func SubsetDiffer(c client.Client) Differ {
 
 		var diffs string
 		for _, d := range docs {
-			diffStr, err := util.DiffStr(d.name, d.live, d.merged)
+			diffStr, err := util.DiffStrOpts(d.name, d.live, d.merged, opts)
 			if err != nil {
 				return nil, errors.Wrap(err, "invoking diff")
 			}
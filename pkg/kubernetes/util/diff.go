@@ -1,11 +1,8 @@
 package util
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -22,58 +19,379 @@ func DiffName(m manifest.Manifest) string {
 	), "/", "-", -1)
 }
 
-// DiffStr computes the differences between the strings `is` and `should` using the
-// UNIX `diff(1)` utility.
+// DefaultDiffContext is the number of unchanged lines shown around each change,
+// same as `diff -u`
+const DefaultDiffContext = 3
+
+// NoDiffContext can be used as DiffOpts.Context to show no unchanged lines
+const NoDiffContext = -1
+
+// DiffOpts allow to specify additional parameters for computing diffs
+type DiffOpts struct {
+	// Context is the number of unchanged lines shown around each change. If
+	// 0, DefaultDiffContext is used. Negative values show none, see
+	// NoDiffContext
+	Context int
+}
+
+// ContextLines returns the number of unchanged lines to show around each
+// change, resolving the zero value to DefaultDiffContext
+func (o DiffOpts) ContextLines() int {
+	switch {
+	case o.Context == 0:
+		return DefaultDiffContext
+	case o.Context < 0:
+		return 0
+	}
+	return o.Context
+}
+
+// DiffStr computes the differences between the strings `is` and `should` in the
+// unified format of `diff -u -N`
 func DiffStr(name, is, should string) (string, error) {
-	dir, err := os.MkdirTemp("", "diff")
-	if err != nil {
-		return "", err
+	return DiffStrOpts(name, is, should, DiffOpts{Context: DefaultDiffContext})
+}
+
+// DiffStrOpts is like DiffStr, but allows to specify additional options
+func DiffStrOpts(name, is, should string, opts DiffOpts) (string, error) {
+	if is == should {
+		return "", nil
+	}
+
+	live, merged := "LIVE/"+name, "MERGED/"+name
+	a, b := splitLines(is), splitLines(should)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "diff -u -N %s %s\n", live, merged)
+	fmt.Fprintf(&buf, "--- %s\n", live)
+	fmt.Fprintf(&buf, "+++ %s\n", merged)
+
+	for _, h := range hunks(myers(a, b), opts.ContextLines()) {
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))
+		for _, e := range h.edits {
+			line := ""
+			switch e.op {
+			case opEqual:
+				line = " " + a[e.a]
+			case opDelete:
+				line = "-" + a[e.a]
+			case opInsert:
+				line = "+" + b[e.b]
+			}
+
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			buf.WriteString(line)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// splitLines splits s into lines, keeping the line endings. The last line
+// lacks one if s does not end with a newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
 	}
-	defer os.RemoveAll(dir)
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
 
-	if err := os.WriteFile(filepath.Join(dir, "LIVE-"+name), []byte(is), os.ModePerm); err != nil {
-		return "", err
+// hunkRange formats a line range like `diff -u` does: The start line is
+// 1-based, the length is omitted if it is 1. Empty ranges refer to the line
+// before.
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
 	}
-	if err := os.WriteFile(filepath.Join(dir, "MERGED-"+name), []byte(should), os.ModePerm); err != nil {
-		return "", err
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+// edit is a single step of an edit script. a and b are the line indices into
+// the respective inputs. Only the one relevant to op is set.
+type edit struct {
+	op   op
+	a, b int
+}
+
+// myers computes the shortest edit script to transform a into b, using the
+// linear space variant of the algorithm described in "An O(ND) Difference
+// Algorithm and Its Variations" by Eugene W. Myers: The middle snake of the
+// edit path splits the inputs into two smaller problems, which are solved
+// recursively. Within each change, deletions come before insertions.
+func myers(a, b []string) []edit {
+	if len(a)+len(b) == 0 {
+		return nil
 	}
 
-	buf := bytes.Buffer{}
-	merged := filepath.Join(dir, "MERGED-"+name)
-	live := filepath.Join(dir, "LIVE-"+name)
-	cmd := exec.Command("diff", "-u", "-N", live, merged)
-	cmd.Stdout = &buf
-	err = cmd.Run()
+	s := myersState{a: a, b: b}
+	s.compare(0, len(a), 0, len(b))
+	return deletesFirst(s.edits)
+}
 
-	// the diff utility exits with `1` if there are differences. We need to not fail there.
-	if exitError, ok := err.(*exec.ExitError); ok && err != nil {
-		if exitError.ExitCode() != 1 {
-			return "", err
+type myersState struct {
+	a, b  []string
+	edits []edit
+}
+
+// compare appends the edits transforming a[aLo:aHi] into b[bLo:bHi]
+func (s *myersState) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && s.a[aLo] == s.b[bLo] {
+		s.edits = append(s.edits, edit{op: opEqual, a: aLo, b: bLo})
+		aLo++
+		bLo++
+	}
+
+	// the common suffix is appended last
+	suffix := 0
+	for aHi > aLo && bHi > bLo && s.a[aHi-1] == s.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	if x, y, ok := s.bisect(aLo, aHi, bLo, bHi); ok {
+		s.compare(aLo, x, bLo, y)
+		s.compare(x, aHi, y, bHi)
+	} else {
+		for x := aLo; x < aHi; x++ {
+			s.edits = append(s.edits, edit{op: opDelete, a: x})
+		}
+		for y := bLo; y < bHi; y++ {
+			s.edits = append(s.edits, edit{op: opInsert, b: y})
 		}
 	}
 
-	out := buf.String()
-	if out != "" {
-		out = fmt.Sprintf("diff -u -N %s %s\n%s", live, merged, out)
+	for i := 0; i < suffix; i++ {
+		s.edits = append(s.edits, edit{op: opEqual, a: aHi + i, b: bHi + i})
 	}
+}
 
-	return out, nil
+// bisect finds the middle snake of the shortest edit path transforming
+// a[aLo:aHi] into b[bLo:bHi], by searching forwards and backwards at the same
+// time until both searches overlap. It returns the point where they do, or
+// false if the inputs have nothing in common.
+//
+// Only the furthest reaching paths of the current step are kept, so memory is
+// linear in the length of the inputs.
+func (s *myersState) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	offset := maxD
+
+	// vf[k+offset] holds the furthest x on diagonal k of the forward search,
+	// vb the same for the backward search, counted from the end
+	vf, vb := make([]int, 2*maxD+2), make([]int, 2*maxD+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	// the searches overlap in the forward step if delta is odd, otherwise in
+	// the backward step
+	delta := n - m
+	front := delta%2 != 0
+
+	// diagonals that left the edit graph are skipped
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && s.a[aLo+x] == s.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[i] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				j := offset + delta - k
+				if j >= 0 && j < len(vb) && vb[j] != -1 && x >= n-vb[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && vb[i-1] < vb[i+1]) {
+				x = vb[i+1]
+			} else {
+				x = vb[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && s.a[aHi-1-x] == s.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[i] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				j := offset + delta - k
+				if j >= 0 && j < len(vf) && vf[j] != -1 && vf[j] >= n-x {
+					fx := vf[j]
+					return aLo + fx, bLo + fx - (delta - k), true
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
 }
 
-// Diffstat uses `diffstat(1)` utility to summarize a `diff(1)` output
-func Diffstat(d string) (*string, error) {
-	cmd := exec.Command("diffstat", "-C")
-	buf := bytes.Buffer{}
-	cmd.Stdout = &buf
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(d)
+// deletesFirst reorders each run of changes so that all deletions come before
+// the insertions, which is how `diff -u` presents them
+func deletesFirst(edits []edit) []edit {
+	out := make([]edit, 0, len(edits))
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			out = append(out, edits[i])
+			i++
+			continue
+		}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("invoking diffstat(1): %s", err.Error())
+		j := i
+		for j < len(edits) && edits[j].op != opEqual {
+			j++
+		}
+		for _, e := range edits[i:j] {
+			if e.op == opDelete {
+				out = append(out, e)
+			}
+		}
+		for _, e := range edits[i:j] {
+			if e.op == opInsert {
+				out = append(out, e)
+			}
+		}
+		i = j
 	}
+	return out
+}
+
+// hunk is a group of nearby changes, surrounded by context lines
+type hunk struct {
+	aStart, aLen int
+	bStart, bLen int
+	edits        []edit
+}
 
-	out := buf.String()
-	return &out, nil
+// hunks groups edits into hunks with the given number of context lines. Changes
+// closer than 2*context lines are merged into a single hunk.
+func hunks(edits []edit, context int) []hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	// positions of each edit in both inputs, needed for equal lines
+	ai, bi := make([]int, len(edits)), make([]int, len(edits))
+	a, b := 0, 0
+	for i, e := range edits {
+		ai[i], bi[i] = a, b
+		switch e.op {
+		case opEqual:
+			a++
+			b++
+		case opDelete:
+			a++
+		case opInsert:
+			b++
+		}
+	}
+
+	var out []hunk
+	lastEnd := 0
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+
+		// extend backwards by context
+		start := i
+		for start > 0 && i-start < context && edits[start-1].op == opEqual {
+			start--
+		}
+		if start < lastEnd {
+			start = lastEnd
+		}
+
+		// extend forward until there are more than 2*context equal lines
+		end := i
+		for end < len(edits) {
+			if edits[end].op != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == opEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+
+		h := hunk{aStart: ai[start], bStart: bi[start], edits: edits[start:end]}
+		for _, e := range h.edits {
+			if e.op != opInsert {
+				h.aLen++
+			}
+			if e.op != opDelete {
+				h.bLen++
+			}
+		}
+		out = append(out, h)
+		i, lastEnd = end, end
+	}
+
+	return out
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 // FilteredErr is a filtered Stderr. If one of the regular expressions match, the current input is discarded.
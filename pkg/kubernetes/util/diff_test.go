@@ -0,0 +1,235 @@
+package util
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStr(t *testing.T) {
+	cases := []struct {
+		name       string
+		is, should string
+		context    int
+		want       string
+	}{
+		{
+			name:   "equal",
+			is:     "a\nb\n",
+			should: "a\nb\n",
+			want:   "",
+		},
+		{
+			name:    "created",
+			is:      "",
+			should:  "a\nb\n",
+			context: 3,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			name:    "deleted",
+			is:      "a\n",
+			should:  "",
+			context: 3,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -1 +0,0 @@
+-a
+`,
+		},
+		{
+			name:    "changed",
+			is:      "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			should:  "1\n2\ntwo\n4\n5\n6\n7\n8\n9\n10\n11\neleven\n",
+			context: 1,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -2,3 +2,3 @@
+ 2
+-3
++two
+ 4
+@@ -11,2 +11,2 @@
+ 11
+-12
++eleven
+`,
+		},
+		{
+			name:    "merged-hunks",
+			is:      "1\n2\n3\n4\n5\n",
+			should:  "one\n2\n3\n4\nfive\n",
+			context: 2,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -1,5 +1,5 @@
+-1
++one
+ 2
+ 3
+ 4
+-5
++five
+`,
+		},
+		{
+			name:    "no-context",
+			is:      "1\n2\n3\n",
+			should:  "1\n3\n",
+			context: NoDiffContext,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -2 +1,0 @@
+-2
+`,
+		},
+		{
+			name:   "default-context",
+			is:     "1\n2\n3\n4\n5\n",
+			should: "1\n2\n3\n4\nfive\n",
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -2,4 +2,4 @@
+ 2
+ 3
+ 4
+-5
++five
+`,
+		},
+		{
+			name:    "no-newline",
+			is:      "a\nb",
+			should:  "a\nc\n",
+			context: 3,
+			want: `diff -u -N LIVE/x MERGED/x
+--- LIVE/x
++++ MERGED/x
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := DiffStrOpts("x", c.is, c.should, DiffOpts{Context: c.context})
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+// TestMyers checks that the edit script transforms a into b and is the
+// shortest one
+func TestMyers(t *testing.T) {
+	cases := [][2]string{
+		{"abcabba", "cbabac"},
+		{"", "abc"},
+		{"abc", ""},
+		{"abc", "abc"},
+		{"xaxbxc", "abc"},
+		{"a", "b"},
+		{"abcdefgh", "hgfedcba"},
+		{"aaabbbaaa", "abababab"},
+		{"thequickbrownfox", "aquickbrowndogjumps"},
+	}
+
+	for _, c := range cases {
+		a, b := strings.Split(c[0], ""), strings.Split(c[1], "")
+		if c[0] == "" {
+			a = nil
+		}
+		if c[1] == "" {
+			b = nil
+		}
+
+		var got []string
+		equal := 0
+		for _, e := range myers(a, b) {
+			switch e.op {
+			case opEqual:
+				assert.Equal(t, a[e.a], b[e.b])
+				got = append(got, a[e.a])
+				equal++
+			case opInsert:
+				got = append(got, b[e.b])
+			}
+		}
+		assert.Equal(t, b, got, c)
+		assert.Equal(t, lcs(a, b), equal, c)
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b, which
+// is the number of equal lines of the shortest edit script
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// TestMyersMemory checks that large rewrites do not need memory quadratic in
+// their size
+func TestMyersMemory(t *testing.T) {
+	a, b := make([]string, 5000), make([]string, 5000)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d\n", i)
+		b[i] = fmt.Sprintf("new %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := myers(a, b)
+	runtime.ReadMemStats(&after)
+
+	assert.Len(t, edits, 10000)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(10<<20))
+}
+
+func TestDiffstat(t *testing.T) {
+	color.NoColor = true
+
+	d, err := DiffStr("v1.ConfigMap.default.config", "a\nb\nc\n", "a\nB\nc\nd\n")
+	require.NoError(t, err)
+	d2, err := DiffStr("apps-v1.Deployment.default.grafana", "", "x\n")
+	require.NoError(t, err)
+
+	got, err := Diffstat(d + d2)
+	require.NoError(t, err)
+	assert.Equal(t, ` v1.ConfigMap.default.config        |    3 ++-
+ apps-v1.Deployment.default.grafana |    1 +
+ 2 files changed, 3 insertions(+), 1 deletion(-)
+`, *got)
+}
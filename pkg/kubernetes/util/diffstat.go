@@ -0,0 +1,104 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// diffstatWidth is the total width of the diffstat output, like `diffstat(1)`
+const diffstatWidth = 80
+
+type fileStat struct {
+	name           string
+	added, deleted int
+}
+
+// Diffstat summarizes unified diff output (diff -u -N) as a histogram, like
+// `diffstat -C` does
+func Diffstat(d string) (*string, error) {
+	var files []fileStat
+	inHeader := false
+
+	for _, line := range strings.Split(d, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "--- "):
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			name := strings.TrimPrefix(line, "+++ ")
+			// strip the timestamp appended by diff(1)
+			if i := strings.Index(name, "\t"); i >= 0 {
+				name = name[:i]
+			}
+			files = append(files, fileStat{name: path.Base(name)})
+			inHeader = false
+		case len(files) == 0:
+		case strings.HasPrefix(line, "+"):
+			files[len(files)-1].added++
+		case strings.HasPrefix(line, "-"):
+			files[len(files)-1].deleted++
+		}
+	}
+
+	nameWidth, maxChanges, added, deleted := 0, 0, 0, 0
+	for _, f := range files {
+		if len(f.name) > nameWidth {
+			nameWidth = len(f.name)
+		}
+		if f.added+f.deleted > maxChanges {
+			maxChanges = f.added + f.deleted
+		}
+		added += f.added
+		deleted += f.deleted
+	}
+
+	// scale the histogram down if it does not fit
+	graphWidth := diffstatWidth - nameWidth - 10
+	if graphWidth < 10 {
+		graphWidth = 10
+	}
+	scale := func(n int) int { return n }
+	if maxChanges > graphWidth {
+		scale = func(n int) int {
+			if n == 0 {
+				return 0
+			}
+			if s := n * graphWidth / maxChanges; s > 0 {
+				return s
+			}
+			return 1
+		}
+	}
+
+	green, red := color.New(color.FgGreen).SprintFunc(), color.New(color.FgRed).SprintFunc()
+
+	var buf strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&buf, " %-*s |%5d %s%s\n", nameWidth, f.name, f.added+f.deleted,
+			green(strings.Repeat("+", scale(f.added))),
+			red(strings.Repeat("-", scale(f.deleted))),
+		)
+	}
+
+	summary := fmt.Sprintf(" %d %s changed", len(files), plural(len(files), "file"))
+	if added > 0 {
+		summary += fmt.Sprintf(", %d %s(+)", added, plural(added, "insertion"))
+	}
+	if deleted > 0 {
+		summary += fmt.Sprintf(", %d %s(-)", deleted, plural(deleted, "deletion"))
+	}
+	buf.WriteString(summary + "\n")
+
+	out := buf.String()
+	return &out, nil
+}
+
+func plural(n int, s string) string {
+	if n == 1 {
+		return s
+	}
+	return s + "s"
+}
@@ -0,0 +1,345 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// ReadinessCheck inspects the live state of an object and reports whether it
+// is ready. status is a short, human readable description of the progress.
+// A non-nil error means the object failed and will not become ready on its own.
+type ReadinessCheck func(live manifest.Manifest) (ready bool, status string, err error)
+
+var (
+	readinessMu     sync.RWMutex
+	readinessChecks = map[string]ReadinessCheck{
+		"Deployment.apps":  deploymentReady,
+		"StatefulSet.apps": statefulSetReady,
+		"DaemonSet.apps":   daemonSetReady,
+		"Job.batch":        jobReady,
+
+		"CustomResourceDefinition.apiextensions.k8s.io": crdReady,
+		"APIService.apiregistration.k8s.io":             apiServiceReady,
+	}
+)
+
+// RegisterReadinessCheck registers check for all objects of the given
+// groupKind, which is of the form `Kind.group` (e.g. `Deployment.apps`, or just
+// `Pod` for the core group). Existing checks are replaced. This allows custom
+// resources to define their own notion of readiness.
+func RegisterReadinessCheck(groupKind string, check ReadinessCheck) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+	readinessChecks[groupKind] = check
+}
+
+// readinessCheckFor returns the ReadinessCheck registered for the kind of m, if
+// any
+func readinessCheckFor(m manifest.Manifest) (ReadinessCheck, bool) {
+	gv, err := schema.ParseGroupVersion(m.APIVersion())
+	if err != nil {
+		return nil, false
+	}
+
+	readinessMu.RLock()
+	defer readinessMu.RUnlock()
+	check, ok := readinessChecks[gv.WithKind(m.Kind()).GroupKind().String()]
+	return check, ok
+}
+
+// WaitOpts allow to specify additional parameters for wait operations
+type WaitOpts struct {
+	// Timeout after which waiting is aborted
+	Timeout time.Duration
+	// Interval between polling the cluster. Defaults to 2 seconds
+	Interval time.Duration
+}
+
+// ErrorWaitFailed occurs when objects failed or did not become ready in time
+type ErrorWaitFailed struct {
+	// Failed objects, including the reason
+	Failed []string
+	// NotReady objects that were still progressing at the timeout
+	NotReady []string
+}
+
+func (e ErrorWaitFailed) Error() string {
+	s := "waiting for objects to become ready:"
+	for _, f := range e.Failed {
+		s += fmt.Sprintf("\n - %s", f)
+	}
+	for _, name := range e.NotReady {
+		s += fmt.Sprintf("\n - %s not ready in time", name)
+	}
+	return s
+}
+
+// Wait blocks until every object of state that has a ReadinessCheck is ready,
+// has failed or the timeout is exceeded. Progress of each object is printed
+// as it changes.
+func (k *Kubernetes) Wait(state manifest.List, opts WaitOpts) error {
+	if opts.Interval == 0 {
+		opts.Interval = 2 * time.Second
+	}
+
+	pending := make(map[string]manifest.Manifest)
+	for _, m := range state {
+		if _, ok := readinessCheckFor(m); ok {
+			pending[objectKey(m)] = m
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var failed []string
+	lastStatus := make(map[string]string)
+	deadline := time.Now().Add(opts.Timeout)
+
+	for {
+		list := make(manifest.List, 0, len(pending))
+		for _, key := range sortedKeys(pending) {
+			list = append(list, pending[key])
+		}
+
+		live, err := k.ctl.GetByState(list, client.GetByStateOpts{IgnoreNotFound: true})
+		if _, ok := err.(client.ErrorNothingReturned); ok {
+			live = nil
+		} else if err != nil {
+			return err
+		}
+
+		byKey := make(map[string]manifest.Manifest)
+		for _, m := range live {
+			byKey[objectKey(m)] = m
+		}
+
+		for _, key := range sortedKeys(pending) {
+			m, ok := byKey[key]
+			if !ok {
+				continue
+			}
+
+			check, _ := readinessCheckFor(m)
+			ready, status, err := check(m)
+			switch {
+			case err != nil:
+				fmt.Printf("%s failed: %s\n", objectspec(m), err)
+				failed = append(failed, fmt.Sprintf("%s failed: %s", objectspec(m), err))
+				delete(pending, key)
+			case ready:
+				fmt.Printf("%s is ready\n", objectspec(m))
+				delete(pending, key)
+			case status != lastStatus[key]:
+				fmt.Printf("Waiting for %s: %s\n", objectspec(m), status)
+				lastStatus[key] = status
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		if time.Now().Add(opts.Interval).After(deadline) {
+			notReady := make([]string, 0, len(pending))
+			for _, key := range sortedKeys(pending) {
+				notReady = append(notReady, objectspec(pending[key]))
+			}
+			return ErrorWaitFailed{Failed: failed, NotReady: notReady}
+		}
+		time.Sleep(opts.Interval)
+	}
+
+	if len(failed) != 0 {
+		return ErrorWaitFailed{Failed: failed}
+	}
+	return nil
+}
+
+// objectKey uniquely identifies an object of the cluster
+func objectKey(m manifest.Manifest) string {
+	gv, _ := schema.ParseGroupVersion(m.APIVersion())
+	return strings.Join([]string{gv.Group, m.Kind(), m.Metadata().Namespace(), m.Metadata().Name()}, "/")
+}
+
+func sortedKeys(m map[string]manifest.Manifest) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// intField returns the integer at path of m, or def if it is not set. Numbers
+// may be float64 (encoding/json) or int64 (client-go)
+func intField(m manifest.Manifest, def int64, path ...string) int64 {
+	v, ok, _ := unstructured.NestedFieldNoCopy(m, path...)
+	if !ok {
+		return def
+	}
+
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return def
+}
+
+func stringField(m manifest.Manifest, path ...string) string {
+	v, _, _ := unstructured.NestedFieldNoCopy(m, path...)
+	s, _ := v.(string)
+	return s
+}
+
+// condition returns the status.conditions entry of the given type
+func condition(m manifest.Manifest, condType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedFieldNoCopy(m, "status", "conditions")
+	list, _ := conditions.([]interface{})
+	for _, c := range list {
+		c, ok := c.(map[string]interface{})
+		if ok && c["type"] == condType {
+			return c
+		}
+	}
+	return nil
+}
+
+// observed reports whether the controller has seen the latest spec of m
+func observed(m manifest.Manifest) bool {
+	return intField(m, 0, "metadata", "generation") <= intField(m, 0, "status", "observedGeneration")
+}
+
+// deploymentReady follows the semantics of `kubectl rollout status`
+func deploymentReady(m manifest.Manifest) (bool, string, error) {
+	if !observed(m) {
+		return false, "waiting for rollout to be observed", nil
+	}
+
+	if c := condition(m, "Progressing"); c != nil && c["reason"] == "ProgressDeadlineExceeded" {
+		return false, "", fmt.Errorf("progress deadline exceeded")
+	}
+
+	replicas := intField(m, 1, "spec", "replicas")
+	updated := intField(m, 0, "status", "updatedReplicas")
+	current := intField(m, 0, "status", "replicas")
+	available := intField(m, 0, "status", "availableReplicas")
+
+	switch {
+	case updated < replicas:
+		return false, fmt.Sprintf("%d out of %d new replicas have been updated", updated, replicas), nil
+	case current > updated:
+		return false, fmt.Sprintf("%d old replicas are pending termination", current-updated), nil
+	case available < updated:
+		return false, fmt.Sprintf("%d of %d updated replicas are available", available, updated), nil
+	}
+	return true, "", nil
+}
+
+// statefulSetReady follows the semantics of `kubectl rollout status`
+func statefulSetReady(m manifest.Manifest) (bool, string, error) {
+	if stringField(m, "spec", "updateStrategy", "type") == "OnDelete" {
+		// rollout is driven by the user deleting pods, nothing to wait for
+		return true, "", nil
+	}
+
+	if !observed(m) {
+		return false, "waiting for rollout to be observed", nil
+	}
+
+	replicas := intField(m, 1, "spec", "replicas")
+	ready := intField(m, 0, "status", "readyReplicas")
+	if ready < replicas {
+		return false, fmt.Sprintf("%d of %d pods are ready", ready, replicas), nil
+	}
+
+	if partition := intField(m, -1, "spec", "updateStrategy", "rollingUpdate", "partition"); partition > 0 {
+		updated := intField(m, 0, "status", "updatedReplicas")
+		if updated < replicas-partition {
+			return false, fmt.Sprintf("%d of %d partitioned pods have been updated", updated, replicas-partition), nil
+		}
+		return true, "", nil
+	}
+
+	if update := stringField(m, "status", "updateRevision"); update != stringField(m, "status", "currentRevision") {
+		updated := intField(m, 0, "status", "updatedReplicas")
+		return false, fmt.Sprintf("%d of %d pods have been updated to revision %s", updated, replicas, update), nil
+	}
+	return true, "", nil
+}
+
+// daemonSetReady follows the semantics of `kubectl rollout status`
+func daemonSetReady(m manifest.Manifest) (bool, string, error) {
+	if stringField(m, "spec", "updateStrategy", "type") == "OnDelete" {
+		return true, "", nil
+	}
+
+	if !observed(m) {
+		return false, "waiting for rollout to be observed", nil
+	}
+
+	desired := intField(m, 0, "status", "desiredNumberScheduled")
+	updated := intField(m, 0, "status", "updatedNumberScheduled")
+	available := intField(m, 0, "status", "numberAvailable")
+
+	switch {
+	case updated < desired:
+		return false, fmt.Sprintf("%d out of %d new pods have been updated", updated, desired), nil
+	case available < desired:
+		return false, fmt.Sprintf("%d of %d updated pods are available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+// jobReady reports a Job as ready once it completed
+func jobReady(m manifest.Manifest) (bool, string, error) {
+	if c := condition(m, "Failed"); c != nil && c["status"] == "True" {
+		return false, "", fmt.Errorf("%v", c["message"])
+	}
+	if c := condition(m, "Complete"); c != nil && c["status"] == "True" {
+		return true, "", nil
+	}
+
+	active := intField(m, 0, "status", "active")
+	succeeded := intField(m, 0, "status", "succeeded")
+	completions := intField(m, 1, "spec", "completions")
+	return false, fmt.Sprintf("%d active, %d of %d completions succeeded", active, succeeded, completions), nil
+}
+
+// crdReady waits for a CustomResourceDefinition to be Established, meaning
+// its custom resources are accepted
+func crdReady(m manifest.Manifest) (bool, string, error) {
+	if c := condition(m, "NamesAccepted"); c != nil && c["status"] == "False" {
+		return false, "", fmt.Errorf("%v", c["message"])
+	}
+	if c := condition(m, "Established"); c != nil && c["status"] == "True" {
+		return true, "", nil
+	}
+	return false, "waiting to be established", nil
+}
+
+// apiServiceReady waits for an APIService to be Available. Unavailable ones
+// are not failed, as their backend may still be starting up
+func apiServiceReady(m manifest.Manifest) (bool, string, error) {
+	c := condition(m, "Available")
+	if c != nil && c["status"] == "True" {
+		return true, "", nil
+	}
+	if c != nil && c["message"] != nil {
+		return false, fmt.Sprintf("%v", c["message"]), nil
+	}
+	return false, "waiting to become available", nil
+}
@@ -0,0 +1,222 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/client"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestReadinessChecks(t *testing.T) {
+	cases := []struct {
+		name  string
+		check ReadinessCheck
+		live  manifest.Manifest
+
+		ready  bool
+		status string
+		err    bool
+	}{
+		{
+			name:  "deployment/not-observed",
+			check: deploymentReady,
+			live: manifest.Manifest{
+				"metadata": map[string]interface{}{"generation": 2.0},
+				"status":   map[string]interface{}{"observedGeneration": 1.0},
+			},
+			status: "waiting for rollout to be observed",
+		},
+		{
+			name:  "deployment/updating",
+			check: deploymentReady,
+			live: manifest.Manifest{
+				"spec":   map[string]interface{}{"replicas": 3.0},
+				"status": map[string]interface{}{"replicas": 3.0, "updatedReplicas": 1.0},
+			},
+			status: "1 out of 3 new replicas have been updated",
+		},
+		{
+			name:  "deployment/terminating",
+			check: deploymentReady,
+			live: manifest.Manifest{
+				"spec":   map[string]interface{}{"replicas": 2.0},
+				"status": map[string]interface{}{"replicas": 3.0, "updatedReplicas": 2.0},
+			},
+			status: "1 old replicas are pending termination",
+		},
+		{
+			name:  "deployment/ready",
+			check: deploymentReady,
+			live: manifest.Manifest{
+				"spec":   map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{"replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)},
+			},
+			ready: true,
+		},
+		{
+			name:  "deployment/deadline",
+			check: deploymentReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"conditions": []interface{}{
+					map[string]interface{}{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"},
+				}},
+			},
+			err: true,
+		},
+		{
+			name:  "statefulset/pods",
+			check: statefulSetReady,
+			live: manifest.Manifest{
+				"spec":   map[string]interface{}{"replicas": 3.0},
+				"status": map[string]interface{}{"readyReplicas": 2.0},
+			},
+			status: "2 of 3 pods are ready",
+		},
+		{
+			name:  "statefulset/revision",
+			check: statefulSetReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"readyReplicas": 1.0, "currentRevision": "a", "updateRevision": "b"},
+			},
+			status: "0 of 1 pods have been updated to revision b",
+		},
+		{
+			name:  "statefulset/ondelete",
+			check: statefulSetReady,
+			live: manifest.Manifest{
+				"spec": map[string]interface{}{"updateStrategy": map[string]interface{}{"type": "OnDelete"}},
+			},
+			ready: true,
+		},
+		{
+			name:  "daemonset/available",
+			check: daemonSetReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"desiredNumberScheduled": 3.0, "updatedNumberScheduled": 3.0, "numberAvailable": 1.0},
+			},
+			status: "1 of 3 updated pods are available",
+		},
+		{
+			name:  "daemonset/ready",
+			check: daemonSetReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"desiredNumberScheduled": 3.0, "updatedNumberScheduled": 3.0, "numberAvailable": 3.0},
+			},
+			ready: true,
+		},
+		{
+			name:  "job/running",
+			check: jobReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"active": 1.0},
+			},
+			status: "1 active, 0 of 1 completions succeeded",
+		},
+		{
+			name:  "job/complete",
+			check: jobReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"conditions": []interface{}{
+					map[string]interface{}{"type": "Complete", "status": "True"},
+				}},
+			},
+			ready: true,
+		},
+		{
+			name:  "job/failed",
+			check: jobReady,
+			live: manifest.Manifest{
+				"status": map[string]interface{}{"conditions": []interface{}{
+					map[string]interface{}{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"},
+				}},
+			},
+			err: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ready, status, err := c.check(c.live)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.ready, ready)
+			assert.Equal(t, c.status, status)
+		})
+	}
+}
+
+func TestRegisterReadinessCheck(t *testing.T) {
+	crd := manifest.Manifest{"apiVersion": "example.com/v1", "kind": "Widget"}
+
+	_, ok := readinessCheckFor(crd)
+	assert.False(t, ok)
+
+	RegisterReadinessCheck("Widget.example.com", func(manifest.Manifest) (bool, string, error) {
+		return true, "", nil
+	})
+	defer func() {
+		readinessMu.Lock()
+		delete(readinessChecks, "Widget.example.com")
+		readinessMu.Unlock()
+	}()
+
+	_, ok = readinessCheckFor(crd)
+	assert.True(t, ok)
+}
+
+// waitClient returns the next entry of states on every call to GetByState
+type waitClient struct {
+	client.Client
+	states []manifest.List
+}
+
+func (w *waitClient) GetByState(manifest.List, client.GetByStateOpts) (manifest.List, error) {
+	state := w.states[0]
+	if len(w.states) > 1 {
+		w.states = w.states[1:]
+	}
+	return state, nil
+}
+
+func deployment(replicas, available float64) manifest.Manifest {
+	return manifest.Manifest{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "grafana", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": replicas},
+		"status": map[string]interface{}{
+			"replicas":          replicas,
+			"updatedReplicas":   replicas,
+			"availableReplicas": available,
+		},
+	}
+}
+
+func TestWait(t *testing.T) {
+	state := manifest.List{
+		deployment(2, 0),
+		// no readiness check, must be ignored
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "config"}},
+	}
+
+	k := Kubernetes{ctl: &waitClient{states: []manifest.List{
+		{deployment(2, 0)},
+		{deployment(2, 1)},
+		{deployment(2, 2)},
+	}}}
+	err := k.Wait(state, WaitOpts{Timeout: time.Second, Interval: time.Millisecond})
+	assert.NoError(t, err)
+
+	k = Kubernetes{ctl: &waitClient{states: []manifest.List{
+		{deployment(2, 1)},
+	}}}
+	err = k.Wait(state, WaitOpts{Timeout: 10 * time.Millisecond, Interval: time.Millisecond})
+	assert.Equal(t, ErrorWaitFailed{NotReady: []string{"Deployment/grafana"}}, err)
+}
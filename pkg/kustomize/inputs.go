@@ -0,0 +1,133 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// KustomizationFiles are the names Kustomize looks for in a directory
+var KustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// remoteFields hold references that may point to remote Kustomizations
+var remoteFields = map[string]bool{"resources": true, "bases": true, "components": true}
+
+// Inputs returns the local files and directories building the Kustomization
+// at dir may read: dir itself and everything it references outside of it,
+// recursively. ok is false if it references remote resources, which can't be
+// tracked.
+func Inputs(dir string) (inputs []string, ok bool, err error) {
+	set := make(map[string]bool)
+	ok, err = collectInputs(filepath.Clean(dir), set)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	// drop inputs contained in others
+	var all []string
+	for p := range set {
+		all = append(all, p)
+	}
+	sort.Strings(all)
+	for _, p := range all {
+		if !containedIn(p, inputs) {
+			inputs = append(inputs, p)
+		}
+	}
+	return inputs, true, nil
+}
+
+func collectInputs(dir string, set map[string]bool) (bool, error) {
+	if set[dir] {
+		return true, nil
+	}
+	set[dir] = true
+
+	var data []byte
+	for _, name := range KustomizationFiles {
+		d, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		data = d
+		break
+	}
+	if data == nil {
+		return true, nil
+	}
+
+	var k map[string]interface{}
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return false, err
+	}
+
+	for field, v := range k {
+		for _, ref := range references(v) {
+			if remoteFields[field] && isRemote(ref) {
+				return false, nil
+			}
+
+			// generators use key=path
+			if i := strings.Index(ref, "="); i >= 0 && !remoteFields[field] {
+				ref = ref[i+1:]
+			}
+
+			path := filepath.Join(dir, ref)
+			info, err := os.Stat(path)
+			if err != nil {
+				// not a path
+				continue
+			}
+			if !info.IsDir() {
+				set[path] = true
+				continue
+			}
+			if ok, err := collectInputs(path, set); err != nil || !ok {
+				return ok, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// references returns all strings in v that may be paths
+func references(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v == "" || strings.Contains(v, "\n") {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			out = append(out, references(e)...)
+		}
+		return out
+	case map[string]interface{}:
+		var out []string
+		for _, e := range v {
+			out = append(out, references(e)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func isRemote(ref string) bool {
+	return strings.Contains(ref, "://") || strings.HasPrefix(ref, "git@") || strings.HasPrefix(ref, "github.com/")
+}
+
+func containedIn(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(path, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
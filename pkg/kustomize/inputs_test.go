@@ -0,0 +1,75 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	write("base/kustomization.yaml", "resources:\n  - deployment.yaml\n")
+	write("base/deployment.yaml", "kind: Deployment\n")
+	write("shared/labels.yaml", "kind: Patch\n")
+	write("config/app.properties", "a=b\n")
+	write("env/kustomization.yaml", `resources:
+  - ../base
+  - service.yaml
+patchesStrategicMerge:
+  - ../shared/labels.yaml
+configMapGenerator:
+  - name: app
+    files:
+      - app.properties=../config/app.properties
+namePrefix: env-
+`)
+	write("env/service.yaml", "kind: Service\n")
+	write("remote/kustomization.yaml", "resources:\n  - ../base\n  - https://github.com/example/repo//deploy?ref=v1\n")
+	write("nested/kustomization.yaml", "resources:\n  - ../remote\n")
+
+	cases := []struct {
+		name   string
+		dir    string
+		want   []string
+		wantOk bool
+	}{
+		{
+			name:   "local",
+			dir:    "env",
+			want:   []string{"base", "config/app.properties", "env", "shared/labels.yaml"},
+			wantOk: true,
+		},
+		{
+			name:   "self-contained",
+			dir:    "base",
+			want:   []string{"base"},
+			wantOk: true,
+		},
+		{name: "remote", dir: "remote"},
+		{name: "remote-nested", dir: "nested"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inputs, ok, err := Inputs(filepath.Join(dir, c.dir))
+			require.NoError(t, err)
+			assert.Equal(t, c.wantOk, ok)
+
+			var got []string
+			for _, in := range inputs {
+				rel, err := filepath.Rel(dir, in)
+				require.NoError(t, err)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/rendercache"
 )
 
 // JsonnetOpts are additional properties the consumer of the native func might
@@ -26,7 +27,12 @@ type JsonnetOpts struct {
 // present on the local filesystem, at a relative location to the file that
 // calls `kustomize.build()` / `std.native('kustomizeBuild')`. This guarantees
 // hermeticity
-func NativeFunc(k Kustomize) *jsonnet.NativeFunction {
+//
+// Builds are memoized in cache, keyed on the contents of the Kustomization and
+// the local files it references (see Inputs). Builds persisted to a Store are
+// also keyed on the version of k (see ExecKustomize.Version). Kustomizations
+// with remote resources are always built. cache may be nil to always build.
+func NativeFunc(k Kustomize, cache *rendercache.Cache) *jsonnet.NativeFunction {
 	return &jsonnet.NativeFunction{
 		Name: "kustomizeBuild",
 		// Similar to `kustomize build {path}` where {path} is a local path
@@ -51,7 +57,30 @@ func NativeFunc(k Kustomize) *jsonnet.NativeFunction {
 			}
 
 			// render resources
-			list, err := k.Build(actual_path)
+			var key string
+			if cache != nil {
+				inputs, ok, err := Inputs(actual_path)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					var args []interface{}
+					if v, isVersioned := k.(versioner); isVersioned && cache.Persistent() {
+						version, err := v.Version()
+						if err != nil {
+							return nil, err
+						}
+						args = append(args, version)
+					}
+
+					if key, err = rendercache.Key(fmt.Sprintf("kustomizeBuild/%T", k), inputs, args...); err != nil {
+						return nil, err
+					}
+				}
+			}
+			list, err := cache.Render(key, func() (manifest.List, error) {
+				return k.Build(actual_path)
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -67,6 +96,12 @@ func NativeFunc(k Kustomize) *jsonnet.NativeFunction {
 	}
 }
 
+// versioner is implemented by Kustomize implementations that build using an
+// external binary, whose version changes what is built
+type versioner interface {
+	Version() (string, error)
+}
+
 func parseOpts(data interface{}) (*JsonnetOpts, error) {
 	c, err := json.Marshal(data)
 	if err != nil {
@@ -1,8 +1,12 @@
 package kustomize
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 )
@@ -17,6 +21,35 @@ type Kustomize interface {
 // command line utility
 type ExecKustomize struct{}
 
+// binaryVersions memoizes the output of `kustomize version` per binary
+var binaryVersions = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Version returns the version of the `kustomize` binary, as reported by
+// `kustomize version`
+func (e ExecKustomize) Version() (string, error) {
+	cmd := kustomizeCmd("version")
+
+	binaryVersions.Lock()
+	defer binaryVersions.Unlock()
+	if v, ok := binaryVersions.m[cmd.Path]; ok {
+		return v, nil
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("getting the version of kustomize: %w", err)
+	}
+
+	v := strings.TrimSpace(out.String())
+	binaryVersions.m[cmd.Path] = v
+	return v, nil
+}
+
 // cmd returns a prepared exec.Cmd to use the `kustomize` binary
 func (e ExecKustomize) cmd(action string, args ...string) *exec.Cmd {
 	argv := []string{action}
@@ -0,0 +1,29 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecKustomizeVersion(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "kustomize")
+	log := filepath.Join(dir, "calls")
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\necho \"$@\" >> "+log+"\necho v5.3.0\n"), 0755))
+	t.Setenv("TANKA_KUSTOMIZE_PATH", bin)
+
+	for i := 0; i < 2; i++ {
+		v, err := ExecKustomize{}.Version()
+		require.NoError(t, err)
+		assert.Equal(t, "v5.3.0", v)
+	}
+
+	// the version is memoized
+	calls, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "version\n", string(calls))
+}
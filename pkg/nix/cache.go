@@ -0,0 +1,146 @@
+package nix
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LockFile pins the inputs of a flake
+const LockFile = "flake.lock"
+
+// cacheKey returns the key the evaluation of attribute is cached at. It
+// changes whenever anything the evaluation depends on changes: the locked
+// inputs, the flake source, the contents of local overrides and the options of
+// the evaluation.
+//
+// ok is false if the evaluation can't be cached, because its inputs are not
+// pinned: the flake has no lock file, or an input is overridden by a remote
+// flake reference without a revision.
+func (f Flake) cacheKey(attribute string) (key string, ok bool, err error) {
+	h := sha256.New()
+
+	// without a lock file, nix resolves the inputs on every evaluation
+	lock, err := os.ReadFile(filepath.Join(f.path, LockFile))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	writeField(h, "lock", string(lock))
+
+	if err := hashTree(h, f.path); err != nil {
+		return "", false, err
+	}
+
+	writeField(h, "attribute", attribute)
+	writeField(h, "apply", f.options.Apply)
+	for _, name := range sortedKeys(f.options.Options) {
+		writeField(h, "option", name, f.options.Options[name])
+	}
+	for _, input := range sortedKeys(f.options.FlakeOverrides) {
+		ref := f.options.FlakeOverrides[input]
+		writeField(h, "override", input, ref)
+
+		if dir, local := localPath(ref); local {
+			if err := hashTree(h, dir); err != nil {
+				return "", false, err
+			}
+		} else if !pinned(ref) {
+			return "", false, nil
+		}
+	}
+
+	return base64.URLEncoding.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// localPath returns the directory a flake reference like `path:../x` or
+// `./x` points to
+func localPath(ref string) (string, bool) {
+	ref = strings.SplitN(ref, "?", 2)[0]
+	switch {
+	case strings.HasPrefix(ref, "path:"):
+		return strings.TrimPrefix(ref, "path:"), true
+	case strings.HasPrefix(ref, "/"), strings.HasPrefix(ref, "."):
+		return ref, true
+	}
+	return "", false
+}
+
+// revExp matches a full git commit hash
+var revExp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// pinned returns whether a remote flake reference always refers to the same
+// contents: it sets a revision or hash (`?rev=`, `?narHash=`), or ends in a
+// commit hash, like `github:org/repo/<commit>`
+func pinned(ref string) bool {
+	parts := strings.SplitN(ref, "?", 2)
+	if len(parts) == 2 {
+		query, err := url.ParseQuery(parts[1])
+		if err == nil && (query.Get("rev") != "" || query.Get("narHash") != "") {
+			return true
+		}
+	}
+
+	segments := strings.Split(parts[0], "/")
+	return revExp.MatchString(segments[len(segments)-1])
+}
+
+// hashTree writes the paths and contents of all files below dir to h, in
+// lexical order. Version control directories are skipped, symlinks are hashed
+// by their target.
+func hashTree(h hash.Hash, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			writeField(h, "symlink", filepath.ToSlash(rel), target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			writeField(h, "file", filepath.ToSlash(rel), fmt.Sprint(info.Size()))
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(h, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeField writes values to h, separated so that different values can't
+// result in the same hash
+func writeField(h hash.Hash, values ...string) {
+	for _, v := range values {
+		fmt.Fprintf(h, "%d:%s;", len(v), v)
+	}
+}
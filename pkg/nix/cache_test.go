@@ -0,0 +1,102 @@
+package nix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalCache(t *testing.T) {
+	dir := t.TempDir()
+	flake := filepath.Join(dir, "flake")
+	require.NoError(t, os.MkdirAll(flake, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(flake, "flake.nix"), []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(flake, LockFile), []byte(`{"version": 7}`), 0644))
+
+	// fake Nix that records each invocation
+	calls := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "nix")
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\necho x >> "+calls+"\necho '{}'\n"), 0700))
+	invocations := func() int {
+		data, err := os.ReadFile(calls)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		require.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+
+	opts := Opts{Binary: bin, CachePath: filepath.Join(dir, "cache")}
+	eval := func(opts Opts) {
+		out, err := EvalFlake(flake, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "{}\n", out)
+	}
+
+	eval(opts)
+	eval(opts)
+	assert.Equal(t, 1, invocations(), "unchanged flake should be cached")
+
+	eval(Opts{Binary: bin, CachePath: opts.CachePath, Attribute: "other"})
+	assert.Equal(t, 2, invocations(), "attribute is part of the key")
+
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "default.nix"), []byte("1"), 0644))
+	override := Opts{Binary: bin, CachePath: opts.CachePath, FlakeOverrides: map[string]string{"nixpkgs": "path:" + src}}
+	eval(override)
+	eval(override)
+	assert.Equal(t, 3, invocations(), "overrides are part of the key")
+
+	require.NoError(t, os.WriteFile(filepath.Join(src, "default.nix"), []byte("2"), 0644))
+	eval(override)
+	assert.Equal(t, 4, invocations(), "contents of local overrides are part of the key")
+
+	unpinned := Opts{Binary: bin, CachePath: opts.CachePath, FlakeOverrides: map[string]string{"nixpkgs": "github:NixOS/nixpkgs"}}
+	eval(unpinned)
+	eval(unpinned)
+	assert.Equal(t, 6, invocations(), "unpinned overrides are not cached")
+
+	pinnedRef := Opts{Binary: bin, CachePath: opts.CachePath, FlakeOverrides: map[string]string{"nixpkgs": "github:NixOS/nixpkgs/0123456789abcdef0123456789abcdef01234567"}}
+	eval(pinnedRef)
+	eval(pinnedRef)
+	assert.Equal(t, 7, invocations(), "pinned overrides are cached")
+
+	require.NoError(t, os.WriteFile(filepath.Join(flake, LockFile), []byte(`{"version": 7, "nodes": {}}`), 0644))
+	eval(opts)
+	assert.Equal(t, 8, invocations(), "locked inputs are part of the key")
+
+	require.NoError(t, os.WriteFile(filepath.Join(flake, "env.nix"), []byte("{}"), 0644))
+	eval(opts)
+	eval(opts)
+	assert.Equal(t, 9, invocations(), "flake source is part of the key")
+
+	impure := opts
+	impure.Impure = boolPtr(true)
+	eval(impure)
+	eval(impure)
+	assert.Equal(t, 11, invocations(), "impure evaluations are not cached")
+
+	require.NoError(t, os.Remove(filepath.Join(flake, LockFile)))
+	eval(opts)
+	eval(opts)
+	assert.Equal(t, 13, invocations(), "flakes without lock file are not cached")
+}
+
+func TestPinned(t *testing.T) {
+	cases := map[string]bool{
+		"github:NixOS/nixpkgs":                                                      false,
+		"github:NixOS/nixpkgs/nixos-unstable":                                       false,
+		"git+https://example.com/repo?ref=main":                                     false,
+		"github:NixOS/nixpkgs/0123456789abcdef0123456789abcdef01234567":             true,
+		"git+https://example.com/repo?rev=0123456789abcdef0123456789abcdef01234567": true,
+		"https://example.com/src.tar.gz?narHash=sha256-AAAA":                        true,
+	}
+	for ref, want := range cases {
+		assert.Equal(t, want, pinned(ref), ref)
+	}
+}
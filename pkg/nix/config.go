@@ -1,8 +1,80 @@
 package nix
 
+// Defaults used for unset Opts
+const (
+	DefaultBinary    = "nix"
+	DefaultAttribute = "kube.tanka"
+)
+
 type Opts struct {
+	// Binary of Nix to invoke. Defaults to DefaultBinary
 	Binary string
 
+	// Attribute of the flake to evaluate. Defaults to DefaultAttribute
+	Attribute string
+
+	// Options set using `--option <name> <value>`
+	Options map[string]string
+
+	// Impure allows the evaluation to access the environment (`--impure`).
+	// nil if unset, so that an explicit false takes precedence in Merge
+	Impure *bool
+
 	// Override paths for flakes
 	FlakeOverrides map[string]string
+
+	// Apply is a Nix function applied to the attribute before it is
+	// returned (`--apply`). Only the result is evaluated, so it can be used
+	// to select parts of the attribute
+	Apply string
+
+	// CachePath is a directory or http(s):// URL to cache evaluations in
+	// (see jsonnet.NewEvalCache). Evaluations are
+	// cached by the locked inputs and source of the flake, and are not cached
+	// if Impure is set, the flake has no lock file or an override is not
+	// pinned
+	CachePath string
+}
+
+// Merge returns o, with all unset fields taken from defaults. Entries of
+// Options and FlakeOverrides are merged, preferring those of o.
+func (o Opts) Merge(defaults Opts) Opts {
+	if o.Binary == "" {
+		o.Binary = defaults.Binary
+	}
+	if o.Attribute == "" {
+		o.Attribute = defaults.Attribute
+	}
+	if o.Apply == "" {
+		o.Apply = defaults.Apply
+	}
+	if o.CachePath == "" {
+		o.CachePath = defaults.CachePath
+	}
+	if o.Impure == nil {
+		o.Impure = defaults.Impure
+	}
+	o.Options = mergeMaps(defaults.Options, o.Options)
+	o.FlakeOverrides = mergeMaps(defaults.FlakeOverrides, o.FlakeOverrides)
+	return o
+}
+
+// IsImpure returns whether the evaluation is impure
+func (o Opts) IsImpure() bool {
+	return o.Impure != nil && *o.Impure
+}
+
+func mergeMaps(a, b map[string]string) map[string]string {
+	if len(a) == 0 {
+		return b
+	}
+
+	out := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
 }
@@ -1,6 +1,7 @@
 package nix
 
-func EvalFlake(path string, expr string, options Opts) (string, error) {
+// EvalFlake evaluates the attribute set in options of the flake at path
+func EvalFlake(path string, options Opts) (string, error) {
 	flake := NewFlake(path, options)
-	return flake.Eval(expr)
+	return flake.Eval(flake.options.Attribute)
 }
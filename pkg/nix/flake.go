@@ -3,7 +3,10 @@ package nix
 import (
 	"fmt"
 	"os/exec"
+	"sort"
 	"strings"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
 )
 
 // Wrapper around Nix commands for a flake
@@ -13,20 +16,35 @@ type Flake struct {
 }
 
 func NewFlake(path string, options Opts) Flake {
-	// temp hack
-	options.Binary = "nix"
-
 	return Flake{
-		path:    path,
-		options: options,
+		path: path,
+		options: options.Merge(Opts{
+			Binary:    DefaultBinary,
+			Attribute: DefaultAttribute,
+		}),
 	}
 }
 
-func (f Flake) invokeNix(args ...string) (string, error) {
+// args returns the flags shared by all invocations of Nix
+func (f Flake) args() []string {
+	var args []string
+	if f.options.IsImpure() {
+		args = append(args, "--impure")
+	}
+
+	for _, name := range sortedKeys(f.options.Options) {
+		args = append(args, "--option", name, f.options.Options[name])
+	}
+
 	// append our flake overrides to the args
-	for key, path := range f.options.FlakeOverrides {
-		args = append(args, []string{"--override-input", key, path}...)
+	for _, key := range sortedKeys(f.options.FlakeOverrides) {
+		args = append(args, "--override-input", key, f.options.FlakeOverrides[key])
 	}
+	return args
+}
+
+func (f Flake) invokeNix(args ...string) (string, error) {
+	args = append(args, f.args()...)
 
 	out, err := exec.Command(f.options.Binary, args...).Output()
 
@@ -42,10 +60,40 @@ func (f Flake) invokeNix(args ...string) (string, error) {
 	return string(out), nil
 }
 
-// Evaluates a Nix expression
+// Evaluates a Nix expression. If Opts.CachePath is set, results of pure
+// evaluations are cached there
 func (f Flake) Eval(key string) (string, error) {
+	if f.options.CachePath == "" || f.options.IsImpure() {
+		return f.eval(key)
+	}
+
+	hash, ok, err := f.cacheKey(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return f.eval(key)
+	}
+	cache := jsonnet.NewEvalCache(f.options.CachePath)
+	if v, err := jsonnet.LookupEvalCache(cache, hash); err != nil {
+		return "", err
+	} else if v != "" {
+		return v, nil
+	}
+
+	out, err := f.eval(key)
+	if err != nil {
+		return "", err
+	}
+	return out, cache.Store(hash, out)
+}
+
+func (f Flake) eval(key string) (string, error) {
 	uri := fmt.Sprintf("%s#%s", f.path, key)
 	args := []string{"eval", uri, "--json"}
+	if f.options.Apply != "" {
+		args = append(args, "--apply", f.options.Apply)
+	}
 	out, err := f.invokeNix(args...)
 	if err != nil {
 		return "", err
@@ -53,3 +101,12 @@ func (f Flake) Eval(key string) (string, error) {
 
 	return out, nil
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
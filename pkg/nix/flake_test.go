@@ -0,0 +1,124 @@
+package nix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlakeArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		opts Opts
+		want []string
+	}{
+		{
+			name: "defaults",
+			opts: Opts{},
+			want: nil,
+		},
+		{
+			name: "impure",
+			opts: Opts{Impure: boolPtr(true)},
+			want: []string{"--impure"},
+		},
+		{
+			name: "sorted",
+			opts: Opts{
+				Options:        map[string]string{"sandbox": "false", "allow-import-from-derivation": "true"},
+				FlakeOverrides: map[string]string{"nixpkgs": "/src/nixpkgs", "k8s": "/src/k8s"},
+			},
+			want: []string{
+				"--option", "allow-import-from-derivation", "true",
+				"--option", "sandbox", "false",
+				"--override-input", "k8s", "/src/k8s",
+				"--override-input", "nixpkgs", "/src/nixpkgs",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFlake("/flake", c.opts)
+			assert.Equal(t, c.want, f.args())
+		})
+	}
+}
+
+func TestNewFlakeDefaults(t *testing.T) {
+	f := NewFlake("/flake", Opts{})
+	assert.Equal(t, DefaultBinary, f.options.Binary)
+	assert.Equal(t, DefaultAttribute, f.options.Attribute)
+
+	f = NewFlake("/flake", Opts{Binary: "/run/nix", Attribute: "tanka.prod"})
+	assert.Equal(t, "/run/nix", f.options.Binary)
+	assert.Equal(t, "tanka.prod", f.options.Attribute)
+}
+
+func TestOptsMerge(t *testing.T) {
+	defaults := Opts{
+		Binary:         "nix-from-spec",
+		Attribute:      "spec.attr",
+		Options:        map[string]string{"sandbox": "true", "cores": "4"},
+		FlakeOverrides: map[string]string{"nixpkgs": "/spec"},
+	}
+	got := Opts{
+		Attribute: "cli.attr",
+		Impure:    boolPtr(true),
+		Options:   map[string]string{"sandbox": "false"},
+	}.Merge(defaults)
+
+	assert.Equal(t, Opts{
+		Binary:         "nix-from-spec",
+		Attribute:      "cli.attr",
+		Impure:         boolPtr(true),
+		Options:        map[string]string{"sandbox": "false", "cores": "4"},
+		FlakeOverrides: map[string]string{"nixpkgs": "/spec"},
+	}, got)
+
+	// an explicit false overrides impure defaults
+	got = Opts{Impure: boolPtr(false)}.Merge(Opts{Impure: boolPtr(true)})
+	assert.False(t, got.IsImpure())
+	got = Opts{}.Merge(Opts{Impure: boolPtr(true)})
+	assert.True(t, got.IsImpure())
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestFlakeEval(t *testing.T) {
+	// fake Nix that prints its arguments, one per line
+	bin := filepath.Join(t.TempDir(), "nix")
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\"\n"), 0700))
+
+	cases := []struct {
+		name string
+		opts Opts
+		want []string
+	}{
+		{
+			name: "attribute",
+			opts: Opts{Attribute: "tanka.prod"},
+			want: []string{"eval", "/flake#tanka.prod", "--json"},
+		},
+		{
+			name: "apply",
+			opts: Opts{Apply: "main: main.metadata", Impure: boolPtr(true)},
+			want: []string{"eval", "/flake#kube.tanka", "--json", "--apply", "main: main.metadata", "--impure"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.opts.Binary = bin
+			out, err := EvalFlake("/flake", c.opts)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, strings.Split(strings.TrimSpace(out), "\n"))
+		})
+	}
+}
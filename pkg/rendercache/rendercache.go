@@ -0,0 +1,211 @@
+// Package rendercache memoizes the manifests rendered by native functions like
+// helmTemplate and kustomizeBuild, so that the same chart with the same values
+// is rendered once, no matter how many environments use it.
+package rendercache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+// Store persists rendered manifests across processes. jsonnet.EvalCache
+// implements it. Get returns an empty string for missing keys.
+type Store interface {
+	Get(key string) (string, error)
+	Store(key, content string) error
+}
+
+// Cache memoizes rendered manifests by key. Renders are kept in memory for the
+// lifetime of the process, shared by all Caches, and in Store if set.
+type Cache struct {
+	Store Store
+
+	// Version is part of the keys in Store, so that renders stored by other
+	// versions of Tanka are never used
+	Version string
+}
+
+// New returns a Cache that persists to store. store may be nil to only keep
+// renders in memory
+func New(store Store) *Cache {
+	return &Cache{Store: store}
+}
+
+// Persistent returns whether renders outlive the process, because they are
+// kept in a Store. Keys of persistent renders must include the versions of
+// external tools rendering them.
+func (c *Cache) Persistent() bool {
+	return c != nil && c.Store != nil
+}
+
+// maxMemoryEntries bounds the renders kept in memory. Keys change with their
+// inputs, so the oldest ones are most likely stale
+const maxMemoryEntries = 256
+
+// render is a single memoized render. done is closed once data or err is set
+type render struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var memory = struct {
+	sync.Mutex
+	renders map[string]*render
+	order   []string
+}{renders: make(map[string]*render)}
+
+// Render returns the manifests memoized for key, calling fn if there are none
+// yet. Concurrent calls for the same key wait for a single call of fn. If c is
+// nil or key is empty, fn is always called.
+//
+// Results are always decoded from JSON, so that they are of the same types
+// whether they were memoized or not.
+func (c *Cache) Render(key string, fn func() (manifest.List, error)) (manifest.List, error) {
+	if c == nil || key == "" {
+		return fn()
+	}
+
+	memory.Lock()
+	r, ok := memory.renders[key]
+	if !ok {
+		r = &render{done: make(chan struct{})}
+		memory.renders[key] = r
+		memory.order = append(memory.order, key)
+		if len(memory.order) > maxMemoryEntries {
+			delete(memory.renders, memory.order[0])
+			memory.order = memory.order[1:]
+		}
+	}
+	memory.Unlock()
+
+	if ok {
+		<-r.done
+	} else {
+		r.data, r.err = c.load(key, fn)
+		if r.err != nil {
+			// don't memoize failures, they might be temporary
+			memory.Lock()
+			if memory.renders[key] == r {
+				delete(memory.renders, key)
+			}
+			memory.Unlock()
+		}
+		close(r.done)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	var list manifest.List
+	if err := json.Unmarshal(r.data, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// load returns the encoded render of key from the Store, or renders it using
+// fn and stores it
+func (c *Cache) load(key string, fn func() (manifest.List, error)) ([]byte, error) {
+	if c.Version != "" {
+		sum := sha256.Sum256([]byte(c.Version + "\n" + key))
+		key = hex.EncodeToString(sum[:])
+	}
+
+	if c.Store != nil {
+		data, err := c.Store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if data != "" {
+			return []byte(data), nil
+		}
+	}
+
+	list, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Store != nil {
+		if err := c.Store.Store(key, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Key returns the key of rendering using fn: a hash of fn, the relative paths
+// and contents of all files below each of paths, and the JSON of args. Paths
+// may also be single files. Where paths are located does not matter, so that
+// copies of the same chart share their renders.
+func Key(fn string, paths []string, args ...interface{}) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", fn)
+
+	for _, p := range paths {
+		if err := hashPath(h, p); err != nil {
+			return "", err
+		}
+	}
+
+	for _, a := range args {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n", data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPath writes the path relative to root and the content of every file
+// below root to h
+func hashPath(h io.Writer, root string) error {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(h, "%x %s\n", sum, filepath.ToSlash(rel))
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package rendercache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapStore is an in-memory Store
+type mapStore struct {
+	sync.Mutex
+	m map[string]string
+}
+
+func (s *mapStore) Get(key string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.m[key], nil
+}
+
+func (s *mapStore) Store(key, content string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.m[key] = content
+	return nil
+}
+
+// forget drops all renders kept in memory, like a new process would
+func forget() {
+	memory.Lock()
+	defer memory.Unlock()
+	memory.renders = make(map[string]*render)
+	memory.order = nil
+}
+
+func counting(calls *int32) func() (manifest.List, error) {
+	return func() (manifest.List, error) {
+		atomic.AddInt32(calls, 1)
+		return manifest.List{{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "config"},
+			"data":       map[string]interface{}{"replicas": 3},
+		}}, nil
+	}
+}
+
+func TestRenderConcurrent(t *testing.T) {
+	t.Cleanup(forget)
+	var calls int32
+	cache := New(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := cache.Render("concurrent", counting(&calls))
+			assert.NoError(t, err)
+			assert.Len(t, list, 1)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, calls)
+}
+
+func TestRenderStore(t *testing.T) {
+	t.Cleanup(forget)
+	var calls int32
+	store := &mapStore{m: make(map[string]string)}
+
+	first, err := New(store).Render("stored", counting(&calls))
+	require.NoError(t, err)
+	assert.Contains(t, store.m, "stored")
+
+	// a new process reads it from the store
+	forget()
+	second, err := New(store).Render("stored", counting(&calls))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, calls)
+
+	// results are of the same types, whether memoized or not
+	assert.Equal(t, first, second)
+	assert.Equal(t, float64(3), second[0]["data"].(map[string]interface{})["replicas"])
+}
+
+func TestRenderUncached(t *testing.T) {
+	t.Cleanup(forget)
+	var calls int32
+
+	var nilCache *Cache
+	_, err := nilCache.Render("uncached", counting(&calls))
+	require.NoError(t, err)
+	_, err = New(nil).Render("", counting(&calls))
+	require.NoError(t, err)
+	_, err = New(nil).Render("", counting(&calls))
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 3, calls)
+}
+
+func TestRenderError(t *testing.T) {
+	t.Cleanup(forget)
+	cache := New(nil)
+
+	_, err := cache.Render("failing", func() (manifest.List, error) {
+		return nil, errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+
+	// failures are not memoized
+	var calls int32
+	_, err = cache.Render("failing", counting(&calls))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, calls)
+}
+
+func TestKey(t *testing.T) {
+	write := func(dir, name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		write(dir, "Chart.yaml", "name: demo\n")
+		write(dir, "templates/cm.yaml", "kind: ConfigMap\n")
+	}
+
+	key := func(dir string, args ...interface{}) string {
+		k, err := Key("helmTemplate", []string{dir}, args...)
+		require.NoError(t, err)
+		return k
+	}
+
+	// copies share their key
+	assert.Equal(t, key(a, "name"), key(b, "name"))
+
+	// args and function matter
+	assert.NotEqual(t, key(a, "name"), key(a, "other"))
+	other, err := Key("kustomizeBuild", []string{a}, "name")
+	require.NoError(t, err)
+	assert.NotEqual(t, key(a, "name"), other)
+
+	// so do contents and paths
+	before := key(b, "name")
+	write(b, "templates/cm.yaml", "kind: Secret\n")
+	assert.NotEqual(t, before, key(b, "name"))
+
+	before = key(b, "name")
+	require.NoError(t, os.Rename(filepath.Join(b, "templates/cm.yaml"), filepath.Join(b, "templates/secret.yaml")))
+	assert.NotEqual(t, before, key(b, "name"))
+}
+
+func TestRenderStoreVersion(t *testing.T) {
+	t.Cleanup(forget)
+	var calls int32
+	store := &mapStore{m: make(map[string]string)}
+
+	_, err := (&Cache{Store: store, Version: "v1"}).Render("versioned", counting(&calls))
+	require.NoError(t, err)
+	assert.NotContains(t, store.m, "versioned")
+
+	// other versions of Tanka render again
+	forget()
+	_, err = (&Cache{Store: store, Version: "v2"}).Render("versioned", counting(&calls))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls)
+
+	// the same version reads it from the store
+	forget()
+	_, err = (&Cache{Store: store, Version: "v1"}).Render("versioned", counting(&calls))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls)
+	assert.Len(t, store.m, 2)
+}
+
+func TestPersistent(t *testing.T) {
+	var nilCache *Cache
+	assert.False(t, nilCache.Persistent())
+	assert.False(t, New(nil).Persistent())
+	assert.True(t, New(&mapStore{}).Persistent())
+}
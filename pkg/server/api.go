@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/grafana/tanka/pkg/helm"
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/nix"
+	"github.com/grafana/tanka/pkg/process"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+// Endpoints of the server. All of them expect a Request as a POST body, except
+// for PathVersion.
+const (
+	PathVersion = "/v1/version"
+	PathEval    = "/v1/eval"
+	PathShow    = "/v1/show"
+	PathPeek    = "/v1/peek"
+	PathEnvs    = "/v1/envs"
+	PathExport  = "/v1/export"
+	PathImports = "/v1/imports"
+)
+
+// Request is the body of all requests to the server. Which fields are used
+// depends on the endpoint
+type Request struct {
+	// Dir is the working directory of the client. Relative paths are resolved
+	// against it
+	Dir string `json:"dir"`
+
+	// Path of the environment (or directory to search for environments)
+	Path string `json:"path,omitempty"`
+	Opts Opts   `json:"opts"`
+
+	// Selector filters environments by label (PathEnvs, PathExport)
+	Selector string `json:"selector,omitempty"`
+
+	// Envs to export and how (PathExport)
+	Envs   []*v1alpha1.Environment `json:"envs,omitempty"`
+	Export *ExportOpts             `json:"export,omitempty"`
+}
+
+// Opts are the serializable form of tanka.Opts
+type Opts struct {
+	ExtCode    map[string]string `json:"extCode,omitempty"`
+	TLACode    map[string]string `json:"tlaCode,omitempty"`
+	MaxStack   int               `json:"maxStack,omitempty"`
+	EvalScript string            `json:"evalScript,omitempty"`
+	Nix        nix.Opts          `json:"nix"`
+
+	// Targets are the unparsed expressions of tanka.Opts.Filters
+	Targets []string `json:"targets,omitempty"`
+	Name    string   `json:"name,omitempty"`
+
+	// CachePath, CacheEnvs and CacheMaxSize are the evaluation cache
+	// settings of tanka.JsonnetOpts, CacheEnvs in string form
+	CachePath    string   `json:"cachePath,omitempty"`
+	CacheEnvs    []string `json:"cacheEnvs,omitempty"`
+	CacheMaxSize int64    `json:"cacheMaxSize,omitempty"`
+}
+
+// NewOpts returns the serializable form of opts. As compiled filters can't be
+// serialized, they need to be passed as targets instead
+func NewOpts(opts tanka.Opts, targets []string) Opts {
+	o := Opts{
+		ExtCode:    opts.ExtCode,
+		TLACode:    opts.TLACode,
+		MaxStack:   opts.MaxStack,
+		EvalScript: opts.EvalScript,
+		Nix:        opts.Nix,
+		Targets:    targets,
+		Name:       opts.Name,
+		CachePath:  opts.CachePath,
+
+		CacheMaxSize: opts.CacheMaxSize,
+	}
+	for _, r := range opts.CachePathRegexes {
+		o.CacheEnvs = append(o.CacheEnvs, r.String())
+	}
+	return o
+}
+
+// tanka returns o as tanka.Opts, using pool for evaluating Jsonnet
+func (o Opts) tanka(pool *jsonnet.VMPool) (tanka.Opts, error) {
+	filters, err := process.StrExps(o.Targets...)
+	if err != nil {
+		return tanka.Opts{}, err
+	}
+
+	opts := tanka.Opts{
+		JsonnetOpts: tanka.JsonnetOpts{
+			ExtCode:    o.ExtCode,
+			TLACode:    o.TLACode,
+			MaxStack:   o.MaxStack,
+			EvalScript: o.EvalScript,
+			CachePath:  o.CachePath,
+			VMPool:     pool,
+
+			CacheMaxSize: o.CacheMaxSize,
+		},
+		Nix:     o.Nix,
+		Filters: filters,
+		Name:    o.Name,
+	}
+	for _, expr := range o.CacheEnvs {
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return tanka.Opts{}, err
+		}
+		opts.CachePathRegexes = append(opts.CachePathRegexes, r)
+	}
+	return opts, nil
+}
+
+// ExportOpts are the serializable form of tanka.ExportEnvOpts, next to Opts
+type ExportOpts struct {
+	To          string `json:"to"`
+	Format      string `json:"format"`
+	Extension   string `json:"extension"`
+	Merge       bool   `json:"merge"`
+	Parallelism int    `json:"parallelism"`
+}
+
+// selector parses the label selector of r
+func (r Request) selector() (labels.Selector, error) {
+	if r.Selector == "" {
+		return nil, nil
+	}
+	s, err := labels.Parse(r.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing selector: %w", err)
+	}
+	return s, nil
+}
+
+// Version is returned by PathVersion
+type Version struct {
+	Version string `json:"version"`
+	// Env is the environment of the server that changes evaluation results
+	// (see Environ)
+	Env map[string]string `json:"env"`
+}
+
+// envNames and envPrefixes select the environment variables that change
+// evaluation results: which helm, kustomize and nix run, and how
+var (
+	envNames    = []string{"PATH", helm.EngineEnvVar, "TANKA_HELM_PATH", "TANKA_KUSTOMIZE_PATH"}
+	envPrefixes = []string{"HELM_", "KUSTOMIZE_", "NIX_"}
+)
+
+// Environ returns the variables of the environment of this process that
+// change evaluation results. Clients only use a server with the same ones.
+func Environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := parts[0]
+		for _, p := range envPrefixes {
+			if strings.HasPrefix(name, p) {
+				env[name] = parts[1]
+			}
+		}
+		for _, n := range envNames {
+			if name == n {
+				env[name] = parts[1]
+			}
+		}
+	}
+	return env
+}
+
+// errorResponse is returned with a non-2xx status code if a request failed
+type errorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+// dialTimeout is how long Dial waits for a server to answer
+var dialTimeout = 200 * time.Millisecond
+
+// ErrVersionMismatch occurs when the server runs a different version of Tanka
+// than the client, so that results could differ from evaluating locally
+type ErrVersionMismatch struct {
+	Server, Client string
+}
+
+func (e ErrVersionMismatch) Error() string {
+	return fmt.Sprintf("server runs Tanka %s, but this is Tanka %s", e.Server, e.Client)
+}
+
+// ErrEnvMismatch occurs when the server runs with a different environment than
+// the client (see Environ), e.g. another $PATH, so that results could differ
+// from evaluating locally
+type ErrEnvMismatch struct {
+	Vars []string
+}
+
+func (e ErrEnvMismatch) Error() string {
+	return fmt.Sprintf("server runs with different %s", strings.Join(e.Vars, ", "))
+}
+
+// Client talks to a running Server
+type Client struct {
+	http *http.Client
+}
+
+// Dial connects to the server listening on the unix socket at path. It fails
+// if none is listening, if the socket is owned by another user, or if it runs
+// a different version of Tanka or with a different environment (see Environ).
+func Dial(path string) (*Client, error) {
+	// requests contain file contents and results, so they must not be sent
+	// to a server of another user
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fileOwner(fi); ok && fi.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("%s is not a unix socket", path)
+	}
+	if err := checkOwner(path, fi, false); err != nil {
+		return nil, err
+	}
+
+	c := &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://tanka"+PathVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var v Version
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	if v.Version != tanka.CURRENT_VERSION {
+		return nil, ErrVersionMismatch{Server: v.Version, Client: tanka.CURRENT_VERSION}
+	}
+	if vars := envDiff(v.Env, Environ()); len(vars) > 0 {
+		return nil, ErrEnvMismatch{Vars: vars}
+	}
+
+	return c, nil
+}
+
+// Eval is like tanka.Eval
+func (c *Client) Eval(path string, opts Opts) (interface{}, error) {
+	var raw interface{}
+	err := c.do(PathEval, Request{Path: path, Opts: opts}, &raw)
+	return raw, err
+}
+
+// Show is like tanka.Show
+func (c *Client) Show(path string, opts Opts) (manifest.List, error) {
+	var list manifest.List
+	err := c.do(PathShow, Request{Path: path, Opts: opts}, &list)
+	return list, err
+}
+
+// Peek is like tanka.Peek
+func (c *Client) Peek(path string, opts Opts) (*v1alpha1.Environment, error) {
+	var env v1alpha1.Environment
+	if err := c.do(PathPeek, Request{Path: path, Opts: opts}, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// FindEnvs is like tanka.FindEnvs. selector is in string form
+func (c *Client) FindEnvs(path string, opts Opts, selector string) ([]*v1alpha1.Environment, error) {
+	var envs []*v1alpha1.Environment
+	err := c.do(PathEnvs, Request{Path: path, Opts: opts, Selector: selector}, &envs)
+	return envs, err
+}
+
+// Export is like tanka.ExportEnvironments. selector is in string form
+func (c *Client) Export(envs []*v1alpha1.Environment, export ExportOpts, opts Opts, selector string) error {
+	return c.do(PathExport, Request{Envs: envs, Export: &export, Opts: opts, Selector: selector}, nil)
+}
+
+// Imports is like jsonnet.TransitiveImports
+func (c *Client) Imports(dir string) ([]string, error) {
+	var imports []string
+	err := c.do(PathImports, Request{Path: dir}, &imports)
+	return imports, err
+}
+
+// do sends req to path and decodes the response into out, unless it is nil
+func (c *Client) do(path string, req Request, out interface{}) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	req.Dir = dir
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post("http://tanka"+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("server responded with %s", resp.Status)
+		}
+		return errors.New(e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// envDiff returns the sorted names of variables that differ between a and b
+func envDiff(a, b map[string]string) []string {
+	var vars []string
+	for name, v := range a {
+		if w, ok := b[name]; !ok || v != w {
+			vars = append(vars, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			vars = append(vars, name)
+		}
+	}
+	sort.Strings(vars)
+	return vars
+}
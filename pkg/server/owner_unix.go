@@ -0,0 +1,17 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid owning the file described by fi
+func fileOwner(fi os.FileInfo) (int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
@@ -0,0 +1,337 @@
+// Package server implements `tk serve`, which keeps evaluation state (Jsonnet
+// VMs, parsed files) in memory between invocations of `tk`, and the client
+// used to talk to it.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/tanka"
+)
+
+// DefaultSocket returns the path of the unix socket the server listens on
+// and clients connect to. It can be changed using $TANKA_SERVER_SOCKET.
+// Otherwise it is placed in $XDG_RUNTIME_DIR, or in a private per-user
+// directory below the temporary directory.
+func DefaultSocket() string {
+	if env := os.Getenv("TANKA_SERVER_SOCKET"); env != "" {
+		return env
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "tanka.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("tanka-%d", os.Getuid()), "tanka.sock")
+}
+
+// checkOwner returns an error if path is owned by another user. If root is
+// set, files owned by root are accepted as well.
+func checkOwner(path string, fi os.FileInfo, root bool) error {
+	uid, ok := fileOwner(fi)
+	if !ok || uid == os.Getuid() || (root && uid == 0) {
+		return nil
+	}
+	return fmt.Errorf("%s is owned by uid %d, not by the current user", path, uid)
+}
+
+// Server answers requests of Client using pkg/tanka, reusing Jsonnet VMs
+// between requests. Whenever a file imported by any of them, or read by native
+// functions (Helm charts, Kustomizations), changes, all VMs are dropped.
+type Server struct {
+	vms     *jsonnet.VMPool
+	watcher *fsnotify.Watcher
+	// env is the environment evaluations run with (see Environ)
+	env map[string]string
+
+	// mu serializes requests, as they change the working directory
+	mu sync.Mutex
+
+	watchMu sync.Mutex
+	watched map[string]bool
+	// scanned holds the files whose native inputs are watched
+	scanned []string
+}
+
+// New returns a Server, watching files for changes
+func New() (*Server, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watching files: %w", err)
+	}
+
+	s := &Server{
+		vms:     jsonnet.NewVMPool(),
+		watcher: watcher,
+		env:     Environ(),
+		watched: make(map[string]bool),
+	}
+	go s.invalidate()
+	return s, nil
+}
+
+// Listen listens on the unix socket at path. A stale socket of a server that
+// is no longer running is removed. The directory of the socket is created if
+// missing and must be owned by the current user (or root, like /tmp).
+func Listen(path string) (net.Listener, error) {
+	// only the current user may place sockets in the directory
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(dir, fi, true); err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a server is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// other users may not connect
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve answers requests on l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	err := http.Serve(l, s.Handler())
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops watching files
+func (s *Server) Close() error {
+	return s.watcher.Close()
+}
+
+// Handler returns the http.Handler serving the API of s
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathVersion, func(w http.ResponseWriter, r *http.Request) {
+		respond(w, Version{Version: tanka.CURRENT_VERSION, Env: s.env}, nil)
+	})
+
+	mux.Handle(PathEval, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		return tanka.Eval(req.Path, opts)
+	}))
+	mux.Handle(PathShow, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		return tanka.Show(req.Path, opts)
+	}))
+	mux.Handle(PathPeek, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		return tanka.Peek(req.Path, opts)
+	}))
+	mux.Handle(PathEnvs, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		selector, err := req.selector()
+		if err != nil {
+			return nil, err
+		}
+		return tanka.FindEnvs(req.Path, tanka.FindOpts{JsonnetOpts: opts.JsonnetOpts, Nix: opts.Nix, Selector: selector})
+	}))
+	mux.Handle(PathExport, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		if req.Export == nil {
+			return nil, errors.New("export options missing")
+		}
+		selector, err := req.selector()
+		if err != nil {
+			return nil, err
+		}
+		return nil, tanka.ExportEnvironments(req.Envs, req.Export.To, &tanka.ExportEnvOpts{
+			Format:      req.Export.Format,
+			Extension:   req.Export.Extension,
+			Merge:       req.Export.Merge,
+			Opts:        opts,
+			Selector:    selector,
+			Parallelism: req.Export.Parallelism,
+		})
+	}))
+	mux.Handle(PathImports, s.handle(func(req Request, opts tanka.Opts) (interface{}, error) {
+		return jsonnet.TransitiveImports(req.Path)
+	}))
+
+	return mux
+}
+
+type handlerFunc func(req Request, opts tanka.Opts) (interface{}, error)
+
+// handle decodes the Request, runs f in the working directory of the client and
+// encodes its result
+func (s *Server) handle(f handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			respond(w, nil, fmt.Errorf("decoding request: %w", err))
+			return
+		}
+
+		opts, err := req.Opts.tanka(s.vms)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			respond(w, nil, err)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := os.Chdir(req.Dir); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			respond(w, nil, err)
+			return
+		}
+
+		result, err := f(req, opts)
+		s.watch()
+
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		respond(w, result, err)
+	})
+}
+
+func respond(w http.ResponseWriter, result interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body interface{} = result
+	if err != nil {
+		body = errorResponse{Error: err.Error()}
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("writing response:", err)
+	}
+}
+
+// watch watches the directories of all files imported so far, and those of the
+// files native functions may read when called from them
+func (s *Server) watch() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	files := s.vms.Files()
+	for _, file := range files {
+		s.add(filepath.Dir(file))
+	}
+
+	// finding native inputs walks the charts and Kustomizations, so only do
+	// it when new files were imported
+	if reflect.DeepEqual(files, s.scanned) {
+		return
+	}
+	s.scanned = files
+
+	roots := make(map[string][]string)
+	for _, file := range files {
+		// internal files (`import "tk"`) have no directory
+		if !filepath.IsAbs(file) {
+			continue
+		}
+		root, err := jpath.FindRoot(file)
+		if err != nil {
+			continue
+		}
+		roots[root] = append(roots[root], file)
+	}
+
+	for root, files := range roots {
+		inputs, err := jsonnet.NativeInputs(root, files)
+		if err != nil {
+			log.Println("watching files:", err)
+			continue
+		}
+
+		// fsnotify is not recursive: watch all directories between the
+		// input and the importing file, so that new files are noticed as well
+		for _, input := range inputs {
+			for dir := filepath.Dir(input); !s.watched[dir] && within(dir, root); dir = filepath.Dir(dir) {
+				if !s.add(dir) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// add watches dir, unless it is already. It returns whether dir is watched.
+func (s *Server) add(dir string) bool {
+	if s.watched[dir] {
+		return true
+	}
+	if err := s.watcher.Add(dir); err != nil {
+		return false
+	}
+	s.watched[dir] = true
+	return true
+}
+
+// within returns whether path is dir or below it
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// invalidate drops all VMs whenever a watched file changes
+func (s *Server) invalidate() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			s.reset()
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			// events may have been lost, so nothing can be trusted
+			log.Println("watching files:", err)
+			s.reset()
+		}
+	}
+}
+
+// reset drops all VMs. Native inputs are looked up again on the next request,
+// as the change may have added charts or Kustomizations.
+func (s *Server) reset() {
+	s.vms.Reset()
+
+	s.watchMu.Lock()
+	s.scanned = nil
+	s.watchMu.Unlock()
+}
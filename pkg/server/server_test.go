@@ -0,0 +1,222 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testEnv = `{
+  apiVersion: 'tanka.dev/v1alpha1',
+  kind: 'Environment',
+  metadata: { name: 'default' },
+  spec: { apiServer: 'https://localhost', namespace: 'default' },
+  data: {
+    config: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'config' }, data: import 'data.libsonnet' },
+    secret: { apiVersion: 'v1', kind: 'Secret', metadata: { name: 'secret' } },
+  },
+}`
+
+func TestServer(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("jsonnetfile.json", "{}")
+	write("main.jsonnet", testEnv)
+	write("data.libsonnet", "{ value: 'one' }")
+
+	s, err := New()
+	require.NoError(t, err)
+	defer s.Close()
+
+	socket := filepath.Join(t.TempDir(), "tanka.sock")
+	l, err := Listen(socket)
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer l.Close()
+
+	_, err = Listen(socket)
+	assert.Error(t, err, "only one server may listen")
+
+	c, err := Dial(socket)
+	require.NoError(t, err)
+
+	value := func() interface{} {
+		raw, err := c.Eval(dir, Opts{EvalScript: "main.data.config.data.value"})
+		require.NoError(t, err)
+		return raw
+	}
+	assert.Equal(t, "one", value())
+
+	// changed files are picked up
+	write("data.libsonnet", "{ value: 'two' }")
+	assert.Eventually(t, func() bool { return value() == "two" }, 5*time.Second, 10*time.Millisecond)
+
+	list, err := c.Show(dir, Opts{Targets: []string{"configmap/.*"}})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "ConfigMap", list[0].Kind())
+
+	envs, err := c.FindEnvs(dir, Opts{}, "")
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	assert.Equal(t, "default", envs[0].Metadata.Name)
+
+	_, err = c.Eval(filepath.Join(dir, "missing"), Opts{})
+	assert.Error(t, err)
+}
+
+func TestDialNoServer(t *testing.T) {
+	_, err := Dial(filepath.Join(t.TempDir(), "tanka.sock"))
+	assert.Error(t, err)
+}
+
+func TestDefaultSocket(t *testing.T) {
+	t.Setenv("TANKA_SERVER_SOCKET", "")
+
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	assert.Equal(t, "/run/user/1000/tanka.sock", DefaultSocket())
+
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	assert.Equal(t, filepath.Join(os.TempDir(), fmt.Sprintf("tanka-%d", os.Getuid()), "tanka.sock"), DefaultSocket())
+
+	t.Setenv("TANKA_SERVER_SOCKET", "/custom.sock")
+	assert.Equal(t, "/custom.sock", DefaultSocket())
+}
+
+func TestListenPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tanka")
+	socket := filepath.Join(dir, "tanka.sock")
+
+	l, err := Listen(socket)
+	require.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	fi, err = os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func TestDialNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tanka.sock")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+
+	_, err := Dial(path)
+	assert.EqualError(t, err, path+" is not a unix socket")
+}
+
+func TestDialForeignSocket(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of the socket requires root")
+	}
+
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "tanka.sock")
+
+	s, err := New()
+	require.NoError(t, err)
+	defer s.Close()
+
+	l, err := Listen(socket)
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer l.Close()
+
+	// a socket placed there by another user
+	require.NoError(t, os.Chown(socket, 65534, 65534))
+	_, err = Dial(socket)
+	assert.EqualError(t, err, fmt.Sprintf("%s is owned by uid 65534, not by the current user", socket))
+
+	// a directory of another user
+	require.NoError(t, os.Chown(dir, 65534, 65534))
+	_, err = Listen(filepath.Join(dir, "other.sock"))
+	assert.EqualError(t, err, fmt.Sprintf("%s is owned by uid 65534, not by the current user", dir))
+}
+
+// Helm charts used by imported libraries are watched as well, as the
+// evaluated values of imports are kept in memory
+func TestServerNativeInputs(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	}
+	write("jsonnetfile.json", "{}")
+	write("main.jsonnet", `{ value: std.objectValues(import 'lib/lib.libsonnet')[0].data.value }`)
+	write("lib/lib.libsonnet", `std.native('helmTemplate')('test', './charts/test', { calledFrom: std.thisFile })`)
+	write("lib/chartfile.yaml", "version: 1\ndirectory: charts\n")
+	write("lib/charts/test/Chart.yaml", "name: test\n")
+	write("lib/charts/test/templates/configmap.yaml", "{ apiVersion: v1, kind: ConfigMap, metadata: { name: test }, data: { value: one } }")
+
+	// prints the template of the chart, which is the third argument
+	write("helm", "#!/bin/sh\ncat \"$3/templates/configmap.yaml\"\n")
+	t.Setenv("TANKA_HELM_PATH", filepath.Join(dir, "helm"))
+
+	s, err := New()
+	require.NoError(t, err)
+	defer s.Close()
+
+	socket := filepath.Join(t.TempDir(), "tanka.sock")
+	l, err := Listen(socket)
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer l.Close()
+
+	c, err := Dial(socket)
+	require.NoError(t, err)
+
+	value := func() interface{} {
+		raw, err := c.Eval(filepath.Join(dir, "main.jsonnet"), Opts{EvalScript: "main.value"})
+		require.NoError(t, err)
+		return raw
+	}
+	assert.Equal(t, "one", value())
+
+	write("lib/charts/test/templates/configmap.yaml", "{ apiVersion: v1, kind: ConfigMap, metadata: { name: test }, data: { value: two } }")
+	assert.Eventually(t, func() bool { return value() == "two" }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDialEnvMismatch(t *testing.T) {
+	t.Setenv("TANKA_HELM_ENGINE", "")
+	t.Setenv("HELM_CACHE_HOME", "/cache")
+
+	s, err := New()
+	require.NoError(t, err)
+	defer s.Close()
+
+	socket := filepath.Join(t.TempDir(), "tanka.sock")
+	l, err := Listen(socket)
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer l.Close()
+
+	_, err = Dial(socket)
+	require.NoError(t, err)
+
+	// the client would render using other tools than the server
+	t.Setenv("TANKA_HELM_ENGINE", "go")
+	t.Setenv("HELM_CACHE_HOME", "/other")
+	t.Setenv("UNRELATED", "value")
+	_, err = Dial(socket)
+	assert.Equal(t, ErrEnvMismatch{Vars: []string{"HELM_CACHE_HOME", "TANKA_HELM_ENGINE"}}, err)
+	assert.EqualError(t, err, "server runs with different HELM_CACHE_HOME, TANKA_HELM_ENGINE")
+}
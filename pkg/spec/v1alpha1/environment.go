@@ -62,9 +62,38 @@ type Spec struct {
 	Namespace        string           `json:"namespace"`
 	DiffStrategy     string           `json:"diffStrategy,omitempty"`
 	ApplyStrategy    string           `json:"applyStrategy,omitempty"`
+	Client           string           `json:"client,omitempty"`
 	InjectLabels     bool             `json:"injectLabels,omitempty"`
 	ResourceDefaults ResourceDefaults `json:"resourceDefaults"`
 	ExpectVersions   ExpectVersions   `json:"expectVersions"`
+	DiffIgnore       []DiffIgnoreRule `json:"diffIgnore,omitempty"`
+	Nix              *Nix             `json:"nix,omitempty"`
+}
+
+// Nix configures how environments defined in a Nix flake are evaluated. Flags
+// passed on the command line take precedence.
+type Nix struct {
+	// Binary of Nix to invoke, defaults to `nix`
+	Binary string `json:"binary,omitempty"`
+	// Attribute of the flake holding the environment, defaults to `kube.tanka`
+	Attribute string `json:"attribute,omitempty"`
+	// Options set using `nix --option <name> <value>`
+	Options map[string]string `json:"options,omitempty"`
+	// Impure evaluation (`nix --impure`)
+	Impure bool `json:"impure,omitempty"`
+	// Overrides of flake inputs (`nix --override-input <input> <path>`)
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// DiffIgnoreRule excludes fields of matching objects from diffs, e.g. because
+// other controllers manage them
+type DiffIgnoreRule struct {
+	// Targets the rule applies to, in the `kind/name` regular expression
+	// format of `--target`
+	Targets []string `json:"targets"`
+	// Fields to ignore as JSON pointers (RFC 6901). `*` matches all keys of an
+	// object or elements of an array
+	Fields []string `json:"fields"`
 }
 
 // ExpectVersions holds semantic version constraints
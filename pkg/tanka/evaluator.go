@@ -0,0 +1,84 @@
+package tanka
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Evaluator evaluates environments written in a specific language, such as
+// Jsonnet or Nix. Its output is JSON that holds either the resources of a
+// static environment (spec.json), or any number of inline Environment objects.
+type Evaluator interface {
+	// Detect returns whether the environment at path is written for this
+	// evaluator
+	Detect(path string) (bool, error)
+
+	// Eval evaluates the environment at path. If opts.Name is set, inline
+	// environments that don't match it may be omitted
+	Eval(path string, opts LoaderOpts) (string, error)
+
+	// Peek is like Eval, but the data of inline environments may be omitted
+	Peek(path string, opts LoaderOpts) (string, error)
+
+	// List is like Peek, but returns all inline environments regardless of
+	// opts.Name
+	List(path string, opts LoaderOpts) (string, error)
+}
+
+var (
+	evaluatorsMu sync.RWMutex
+	evaluators   []Evaluator
+)
+
+// RegisterEvaluator adds e to the evaluators that environments are detected
+// with. Evaluators registered later take precedence, so that Jsonnet (which
+// detects everything) is only used if no other evaluator applies.
+//
+// Environments without a main.jsonnet also need their entrypoint file
+// registered using jpath.RegisterEntrypoint, so their directory is found.
+func RegisterEvaluator(e Evaluator) {
+	evaluatorsMu.Lock()
+	defer evaluatorsMu.Unlock()
+	evaluators = append([]Evaluator{e}, evaluators...)
+}
+
+func init() {
+	RegisterEvaluator(jsonnetEvaluator{})
+	RegisterEvaluator(nixEvaluator{})
+}
+
+// DetectEvaluator returns the evaluator for the environment at path
+func DetectEvaluator(path string) (Evaluator, error) {
+	evaluatorsMu.RLock()
+	defer evaluatorsMu.RUnlock()
+
+	for _, e := range evaluators {
+		ok, err := e.Detect(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return e, nil
+		}
+	}
+	return jsonnetEvaluator{}, nil
+}
+
+// evalRaw evaluates path using the evaluator for it and unmarshals the result
+func evalRaw(path string, opts LoaderOpts, eval func(Evaluator, string, LoaderOpts) (string, error)) (interface{}, error) {
+	e, err := DetectEvaluator(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := eval(e, path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
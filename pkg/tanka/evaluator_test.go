@@ -0,0 +1,76 @@
+package tanka
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+)
+
+// jsonFileEvaluator returns the contents of testEntrypoint as is
+type jsonFileEvaluator struct{}
+
+const testEntrypoint = "env.json.test"
+
+func (jsonFileEvaluator) Detect(path string) (bool, error) {
+	dir, err := jpath.FsDir(path)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(filepath.Join(dir, testEntrypoint))
+	return err == nil, nil
+}
+
+func (jsonFileEvaluator) Eval(path string, opts LoaderOpts) (string, error) {
+	dir, err := jpath.FsDir(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, testEntrypoint))
+	return string(data), err
+}
+
+func (e jsonFileEvaluator) Peek(path string, opts LoaderOpts) (string, error) {
+	return e.Eval(path, opts)
+}
+
+func (e jsonFileEvaluator) List(path string, opts LoaderOpts) (string, error) {
+	return e.Eval(path, opts)
+}
+
+func init() {
+	RegisterEvaluator(jsonFileEvaluator{})
+	jpath.RegisterEntrypoint(testEntrypoint)
+}
+
+func TestDetectEvaluator(t *testing.T) {
+	e, err := DetectEvaluator("./testdata/cases/custom-evaluator")
+	require.NoError(t, err)
+	assert.IsType(t, jsonFileEvaluator{}, e)
+
+	e, err = DetectEvaluator("./testdata/cases/withspecjson")
+	require.NoError(t, err)
+	assert.IsType(t, jsonnetEvaluator{}, e)
+}
+
+func TestCustomEvaluator(t *testing.T) {
+	path := "./testdata/cases/custom-evaluator"
+
+	envs, err := List(path, Opts{})
+	require.NoError(t, err)
+	require.Len(t, envs, 2)
+	assert.Equal(t, "cases/custom-evaluator/"+testEntrypoint, envs[0].Metadata.Namespace)
+
+	_, err = Load(path, Opts{})
+	assert.IsType(t, ErrMultipleEnvs{}, err)
+
+	l, err := Load(path, Opts{Name: "custom-dev"})
+	require.NoError(t, err)
+	assert.Equal(t, "custom-dev", l.Env.Metadata.Name)
+	require.Len(t, l.Resources, 1)
+	assert.Equal(t, "dev", l.Resources[0].Metadata().Namespace())
+}
@@ -11,18 +11,88 @@ import (
 	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/jsonnet/jpath"
 	"github.com/grafana/tanka/pkg/nix"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
 
-// EvalCommon detects the evaluation type based on the contents of the directory
-func evalDetect(path string, opts LoaderOpts) (raw string, err error) {
-	_, err = os.Stat(filepath.Join(path, "flake.nix"))
+// jsonnetEvaluator evaluates the Jsonnet entrypoint of an environment. It is
+// the default, used if no other evaluator detects an environment
+type jsonnetEvaluator struct{}
+
+func (jsonnetEvaluator) Detect(path string) (bool, error) {
+	return true, nil
+}
+
+func (jsonnetEvaluator) Eval(path string, opts LoaderOpts) (string, error) {
+	if opts.Name != "" {
+		opts.JsonnetOpts.EvalScript = fmt.Sprintf(SingleEnvEvalScript, opts.Name)
+	}
+	return evalJsonnet(path, opts.JsonnetOpts)
+}
+
+func (jsonnetEvaluator) Peek(path string, opts LoaderOpts) (string, error) {
+	opts.JsonnetOpts.EvalScript = MetadataEvalScript
+	if opts.Name != "" {
+		opts.JsonnetOpts.EvalScript = fmt.Sprintf(MetadataSingleEnvEvalScript, opts.Name)
+	}
+	return evalJsonnet(path, opts.JsonnetOpts)
+}
+
+func (jsonnetEvaluator) List(path string, opts LoaderOpts) (string, error) {
+	opts.JsonnetOpts.EvalScript = MetadataEvalScript
+	return evalJsonnet(path, opts.JsonnetOpts)
+}
+
+// nixEvaluator evaluates environments defined in a Nix flake
+type nixEvaluator struct{}
+
+// Detect returns whether the directory of path holds a Nix flake
+func (nixEvaluator) Detect(path string) (bool, error) {
+	dir, err := jpath.FsDir(path)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filepath.Join(dir, jpath.FlakeFile))
 	if os.IsNotExist(err) {
-		return evalJsonnet(path, opts.JsonnetOpts)
+		return false, nil
 	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (e nixEvaluator) Eval(path string, opts LoaderOpts) (string, error) {
+	if opts.Name != "" {
+		opts.Nix.Apply = fmt.Sprintf(NixSingleEnvApply, nixString(opts.Name))
+	}
+	return e.eval(path, opts)
+}
+
+func (e nixEvaluator) Peek(path string, opts LoaderOpts) (string, error) {
+	opts.Nix.Apply = NixMetadataApply
+	if opts.Name != "" {
+		opts.Nix.Apply = fmt.Sprintf(NixMetadataSingleEnvApply, nixString(opts.Name))
+	}
+	return e.eval(path, opts)
+}
+
+func (e nixEvaluator) List(path string, opts LoaderOpts) (string, error) {
+	opts.Nix.Apply = NixMetadataApply
+	return e.eval(path, opts)
+}
+
+func (nixEvaluator) eval(path string, opts LoaderOpts) (string, error) {
+	dir, err := jpath.FsDir(path)
+	if err != nil {
 		return "", err
 	}
 
-	return evalNix(path, "kube.tanka", opts.Nix)
+	// Nix evaluations share the cache of Jsonnet (`tk export --cache-path`)
+	if opts.Nix.CachePath == "" && opts.JsonnetOpts.CachePath != "" && opts.JsonnetOpts.PathIsCached(path) {
+		opts.Nix.CachePath = opts.JsonnetOpts.CachePath
+	}
+
+	return nix.EvalFlake(dir, opts.Nix)
 }
 
 // EvalJsonnet evaluates the jsonnet environment at the given file system path
@@ -69,9 +139,23 @@ function(%s)
 	return raw, nil
 }
 
-// EvalNix evaluates the Nix flake at the given file system path
-func evalNix(path string, expr string, opts nix.Opts) (raw string, err error) {
-	return nix.EvalFlake(path, expr, opts)
+// nixOpts returns opts, with unset fields taken from the spec.nix of env
+func nixOpts(opts nix.Opts, env *v1alpha1.Environment) nix.Opts {
+	spec := env.Spec.Nix
+	if spec == nil {
+		return opts
+	}
+
+	defaults := nix.Opts{
+		Binary:         spec.Binary,
+		Attribute:      spec.Attribute,
+		Options:        spec.Options,
+		FlakeOverrides: spec.Overrides,
+	}
+	if spec.Impure {
+		defaults.Impure = &spec.Impure
+	}
+	return opts.Merge(defaults)
 }
 
 const PatternEvalScript = "main.%s"
@@ -117,7 +201,7 @@ local singleEnv(object) =
          && std.objectHas(object, 'kind')
       then
         if object.kind == 'Environment'
-        && object.metadata.name == '%s'
+        && std.member(object.metadata.name, '%s')
         then object { data:: super.data }
         else {}
       else
@@ -168,3 +252,57 @@ local singleEnv(object) =
 
 singleEnv(main)
 `
+
+// nixEnvs is the start of a Nix function applied to a flake attribute (`main`),
+// that finds the Environment objects within it. The function body is appended
+// to it
+const nixEnvs = `
+main:
+let
+  isEnv = o: o ? apiVersion && o ? kind && o.kind == "Environment";
+  envs = o:
+    if builtins.isAttrs o then
+      if isEnv o then [ o ]
+      else if o.type or null == "derivation" then [ ]
+      else builtins.concatMap envs (builtins.attrValues o)
+    else if builtins.isList o then builtins.concatMap envs o
+    else [ ];
+
+  # data is never evaluated, as Nix is lazy
+  withoutData = env: builtins.removeAttrs env [ "data" ];
+
+  hasInfix = infix: s:
+    let
+      n = builtins.stringLength infix;
+      go = i: i + n <= builtins.stringLength s
+        && (builtins.substring i n s == infix || go (i + 1));
+    in
+    go 0;
+  named = name: builtins.filter (env: hasInfix name env.metadata.name);
+in
+`
+
+// NixMetadataApply finds the Environment objects of a flake (without their
+// .data), like MetadataEvalScript
+const NixMetadataApply = nixEnvs + `map withoutData (envs main)`
+
+// NixMetadataSingleEnvApply returns a single Environment object of a flake
+// (without its .data), like MetadataSingleEnvEvalScript
+const NixMetadataSingleEnvApply = nixEnvs + `map withoutData (named %s (envs main))`
+
+// NixSingleEnvApply returns a single Environment object of a flake, like
+// SingleEnvEvalScript
+const NixSingleEnvApply = nixEnvs + `named %s (envs main)`
+
+// nixString quotes s as a Nix string literal
+func nixString(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`$`, `\$`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	)
+	return `"` + r.Replace(s) + `"`
+}
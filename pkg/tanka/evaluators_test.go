@@ -1,11 +1,15 @@
 package tanka
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEvalJsonnet(t *testing.T) {
@@ -31,3 +35,56 @@ func TestEvalJsonnet(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `"foovalue"`, strings.TrimSpace(json))
 }
+
+func TestNixString(t *testing.T) {
+	cases := map[string]string{
+		"prod":          `"prod"`,
+		`say "hi"`:      `"say \"hi\""`,
+		"${builtins}":   `"\${builtins}"`,
+		`back\slash`:    `"back\\slash"`,
+		"line\nbreak\t": `"line\nbreak\t"`,
+	}
+
+	for in, want := range cases {
+		assert.Equal(t, want, nixString(in), in)
+	}
+}
+
+func TestInlineNixSpec(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "flake.nix"), []byte("{}\n"), 0644))
+
+	// fake Nix that logs its arguments and returns an environment configuring
+	// Nix in its metadata
+	log := filepath.Join(dir, "invocations")
+	env := `[{"apiVersion": "tanka.dev/v1alpha1", "kind": "Environment",
+  "metadata": {"name": "flake"},
+  "spec": {"apiServer": "https://localhost", "namespace": "default", "nix": {"impure": true, "options": {"cores": "4"}}},
+  "data": {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config"}}}]`
+	bin := filepath.Join(dir, "nix")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" | tr '\\n' ' ' >> %s\necho >> %s\ncat <<'EOF'\n%s\nEOF\n", log, log, env)
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0700))
+
+	invocations := func() []string {
+		data, err := os.ReadFile(log)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	loaded, err := LoadEnvironment(dir, Opts{Nix: NixOpts{Binary: bin}})
+	require.NoError(t, err)
+	assert.Equal(t, "flake", loaded.Metadata.Name)
+
+	calls := invocations()
+	require.Len(t, calls, 2)
+	assert.NotContains(t, calls[0], "--impure", "metadata is evaluated using the given options")
+	assert.Contains(t, calls[1], "--impure")
+	assert.Contains(t, calls[1], "--option cores 4")
+
+	// the command line takes precedence
+	require.NoError(t, os.Remove(log))
+	impure := false
+	_, err = LoadEnvironment(dir, Opts{Nix: NixOpts{Binary: bin, Impure: &impure}})
+	require.NoError(t, err)
+	assert.NotContains(t, invocations()[1], "--impure")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/Masterminds/sprig/v3"
 	"k8s.io/apimachinery/pkg/labels"
 
+	"github.com/grafana/tanka/pkg/jsonnet"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
 	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 )
@@ -57,6 +59,7 @@ func ExportEnvironments(envs []*v1alpha1.Environment, to string, opts *ExportEnv
 	}
 
 	// get all environments for paths
+	stats := jsonnet.ReadEvalCacheStats()
 	loadedEnvs, err := parallelLoadEnvironments(envs, parallelOpts{
 		Opts:        opts.Opts,
 		Selector:    opts.Selector,
@@ -65,6 +68,10 @@ func ExportEnvironments(envs []*v1alpha1.Environment, to string, opts *ExportEnv
 	if err != nil {
 		return err
 	}
+	if opts.Opts.CachePath != "" {
+		stats = jsonnet.ReadEvalCacheStats().Since(stats)
+		log.Printf("Evaluation cache: %d hits, %d misses", stats.Hits, stats.Misses)
+	}
 
 	for _, env := range loadedEnvs {
 		// get the manifests
@@ -14,6 +14,7 @@ import (
 // FindOpts are optional arguments for FindEnvs
 type FindOpts struct {
 	JsonnetOpts
+	Nix      NixOpts
 	Selector labels.Selector
 }
 
@@ -23,7 +24,7 @@ type FindOpts struct {
 // are not checked.
 func FindEnvs(path string, opts FindOpts) ([]*v1alpha1.Environment, error) {
 	// find all environments at dir
-	envs, errs := find(path, Opts{JsonnetOpts: opts.JsonnetOpts})
+	envs, errs := find(path, Opts{JsonnetOpts: opts.JsonnetOpts, Nix: opts.Nix})
 	if errs != nil {
 		return envs, ErrParallel{errors: errs}
 	}
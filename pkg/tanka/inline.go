@@ -19,15 +19,17 @@ import (
 type InlineLoader struct{}
 
 func (i *InlineLoader) Load(path string, opts LoaderOpts) (*v1alpha1.Environment, error) {
-	if opts.Name != "" {
-		opts.JsonnetOpts.EvalScript = fmt.Sprintf(SingleEnvEvalScript, opts.Name)
-	}
-
 	data, err := i.Eval(path, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	return i.single(path, data, opts.Name)
+}
+
+// single returns the single environment in data, or the one fully matching
+// name if there are multiple
+func (i *InlineLoader) single(path string, data interface{}, name string) (*v1alpha1.Environment, error) {
 	envs, err := extractEnvs(data)
 	if err != nil {
 		return nil, err
@@ -37,11 +39,11 @@ func (i *InlineLoader) Load(path string, opts LoaderOpts) (*v1alpha1.Environment
 		names := make([]string, 0, len(envs))
 		for _, e := range envs {
 			// If there's a full match on the given name, use this environment
-			if name := e.Metadata().Name(); name == opts.Name {
+			if n := e.Metadata().Name(); n == name {
 				envs = manifest.List{e}
 				break
 			} else {
-				names = append(names, name)
+				names = append(names, n)
 			}
 		}
 		if len(envs) > 1 {
@@ -69,16 +71,16 @@ func (i *InlineLoader) Load(path string, opts LoaderOpts) (*v1alpha1.Environment
 }
 
 func (i *InlineLoader) Peek(path string, opts LoaderOpts) (*v1alpha1.Environment, error) {
-	opts.JsonnetOpts.EvalScript = MetadataEvalScript
-	if opts.Name != "" {
-		opts.JsonnetOpts.EvalScript = fmt.Sprintf(MetadataSingleEnvEvalScript, opts.Name)
+	data, err := evalRaw(path, opts, Evaluator.Peek)
+	if err != nil {
+		return nil, err
 	}
-	return i.Load(path, opts)
+
+	return i.single(path, data, opts.Name)
 }
 
 func (i *InlineLoader) List(path string, opts LoaderOpts) ([]*v1alpha1.Environment, error) {
-	opts.JsonnetOpts.EvalScript = MetadataEvalScript
-	data, err := i.Eval(path, opts)
+	data, err := evalRaw(path, opts, Evaluator.List)
 	if err != nil {
 		return nil, err
 	}
@@ -107,17 +109,36 @@ func (i *InlineLoader) List(path string, opts LoaderOpts) ([]*v1alpha1.Environme
 }
 
 func (i *InlineLoader) Eval(path string, opts LoaderOpts) (interface{}, error) {
-	raw, err := evalDetect(path, opts)
+	opts, err := i.withNixSpec(path, opts)
 	if err != nil {
 		return nil, err
 	}
+	return evalRaw(path, opts, Evaluator.Eval)
+}
 
-	var data interface{}
-	if err := json.Unmarshal([]byte(raw), &data); err != nil {
-		return nil, err
+// withNixSpec returns opts with the spec.nix of the environment at path
+// applied, if it is defined in a Nix flake. To find it, the metadata of the
+// environment is evaluated using opts as given.
+func (i *InlineLoader) withNixSpec(path string, opts LoaderOpts) (LoaderOpts, error) {
+	e, err := DetectEvaluator(path)
+	if err != nil {
+		return opts, err
+	}
+	if _, ok := e.(nixEvaluator); !ok {
+		return opts, nil
+	}
+
+	env, err := i.Peek(path, opts)
+	if _, ok := err.(ErrMultipleEnvs); ok {
+		// evaluating all environments at once, which may configure Nix
+		// differently
+		return opts, nil
+	} else if err != nil {
+		return opts, err
 	}
 
-	return data, nil
+	opts.Nix = nixOpts(opts.Nix, env)
+	return opts, nil
 }
 
 func inlineParse(path string, data []byte) (*v1alpha1.Environment, error) {
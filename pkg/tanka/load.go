@@ -26,7 +26,13 @@ func Load(path string, opts Opts) (*LoadResult, error) {
 		return nil, err
 	}
 
-	result, err := LoadManifests(env, opts.Filters)
+	return loadResult(env, opts.Filters)
+}
+
+// loadResult processes the resources of env, like LoadManifests. Unlike it,
+// it also makes sure no inline environments are left, which can't be applied.
+func loadResult(env *v1alpha1.Environment, filters process.Matchers) (*LoadResult, error) {
+	result, err := LoadManifests(env, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,187 @@
+package tanka
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// TargetOpts specify how FindTargets resolves paths to environments
+type TargetOpts struct {
+	Opts
+
+	// Selector searches each path recursively for environments whose labels
+	// match it
+	Selector labels.Selector
+}
+
+// Target is an environment returned by FindTargets
+type Target struct {
+	Env *v1alpha1.Environment
+
+	// Path the environment is loaded from. Unlike Env.Metadata.Namespace,
+	// which is relative to the project root, it is valid regardless of the
+	// working directory
+	Path string
+}
+
+// FindTargets returns the environments at paths. Without a selector, each path
+// must contain a single environment (Opts.Name picks one of multiple inline
+// environments). With a selector, all matching environments found recursively
+// in paths are returned (like FindEnvs).
+func FindTargets(paths []string, opts TargetOpts) ([]Target, error) {
+	var targets []Target
+	seen := make(map[string]bool)
+	add := func(env *v1alpha1.Environment, path string) {
+		if !seen[envKey(env)] {
+			seen[envKey(env)] = true
+			targets = append(targets, Target{Env: env, Path: path})
+		}
+	}
+
+	for _, path := range paths {
+		if opts.Selector == nil || opts.Selector.Empty() {
+			env, err := Peek(path, opts.Opts)
+			if err != nil {
+				return nil, err
+			}
+			add(env, path)
+			continue
+		}
+
+		found, err := FindEnvs(path, FindOpts{JsonnetOpts: opts.JsonnetOpts, Nix: opts.Nix, Selector: opts.Selector})
+		if err != nil {
+			return nil, err
+		}
+		root, err := jpath.FindRoot(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range found {
+			if opts.Name != "" && opts.Name != env.Metadata.Name {
+				continue
+			}
+			add(env, filepath.Join(root, env.Metadata.Namespace))
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no environments matching selector `%s` found in %s", opts.Selector, strings.Join(paths, ", "))
+	}
+	return targets, nil
+}
+
+func envKey(env *v1alpha1.Environment) string {
+	return env.Metadata.Namespace + ":" + env.Metadata.Name
+}
+
+// loadEnvironments evaluates targets in parallel and returns their resources,
+// in the same order as targets. It fails if any of them fails to load.
+func loadEnvironments(targets []Target, opts parallelOpts) ([]*LoadResult, error) {
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	results := make([]*LoadResult, len(targets))
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// JsonnetOpts are not safe for concurrent use, see
+			// parallelLoadEnvironments
+			o := opts.Opts
+			o.JsonnetOpts = o.JsonnetOpts.Clone()
+			o.Name = t.Env.Metadata.Name
+
+			env, err := LoadEnvironment(t.Path, o)
+			if err == nil {
+				results[i], err = loadResult(env, opts.Filters)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s:\n %w", t.Env.Metadata.Name, err)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, ErrParallel{errors: failed}
+	}
+	return results, nil
+}
+
+// EnvDiff is the result of diffing a single environment using
+// DiffEnvironments
+type EnvDiff struct {
+	Env *v1alpha1.Environment
+
+	// Changes are the differences to the cluster, formatted like the result of
+	// Diff. nil if there are none
+	Changes *string
+	// Err is set if the environment could not be diffed
+	Err error
+}
+
+// DiffEnvironments evaluates targets and diffs each of them against its
+// cluster, both in parallel. Failures to diff a single environment are
+// reported in its EnvDiff, so that the others are still shown.
+func DiffEnvironments(targets []Target, opts DiffOpts) ([]EnvDiff, error) {
+	loaded, err := loadEnvironments(targets, parallelOpts{Opts: opts.Opts, Parallelism: opts.Parallelism})
+	if err != nil {
+		return nil, err
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	diffs := make([]EnvDiff, len(loaded))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, l := range loaded {
+		wg.Add(1)
+		go func(i int, l *LoadResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			diffs[i] = EnvDiff{Env: l.Env}
+			diffs[i].Changes, diffs[i].Err = diffLoaded(l, opts)
+		}(i, l)
+	}
+	wg.Wait()
+
+	return diffs, nil
+}
+
+// ApplyEnvironments evaluates targets in parallel and applies them one after
+// another, after showing all differences and asking for a single
+// confirmation. Applying stops at the first environment that fails.
+func ApplyEnvironments(targets []Target, opts ApplyOpts) error {
+	loaded, err := loadEnvironments(targets, parallelOpts{Opts: opts.Opts, Parallelism: opts.Parallelism})
+	if err != nil {
+		return err
+	}
+
+	return apply(loaded, opts)
+}
@@ -0,0 +1,98 @@
+package tanka
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestFindTargets(t *testing.T) {
+	cases := []struct {
+		name     string
+		paths    []string
+		opts     TargetOpts
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "paths",
+			paths:    []string{"./testdata/cases/withspecjson", "./testdata/cases/withenv"},
+			expected: []string{"cases/withspecjson", "withenv"},
+		},
+		{
+			name:     "duplicates",
+			paths:    []string{"./testdata/cases/withenv", "./testdata/cases/withenv"},
+			expected: []string{"withenv"},
+		},
+		{
+			name:  "multiple-inline",
+			paths: []string{"./testdata/cases/multiple-inline-envs"},
+			err:   true,
+		},
+		{
+			name:     "multiple-inline-name",
+			paths:    []string{"./testdata/cases/multiple-inline-envs"},
+			opts:     TargetOpts{Opts: Opts{Name: "project1-env2"}},
+			expected: []string{"project1-env2"},
+		},
+		{
+			name:  "selector-no-match",
+			paths: []string{"./testdata/cases/withenv"},
+			opts:  TargetOpts{Selector: labels.SelectorFromSet(labels.Set{"team": "none"})},
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			targets, err := FindTargets(c.paths, c.opts)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var names []string
+			for _, t := range targets {
+				names = append(names, t.Env.Metadata.Name)
+			}
+			assert.Equal(t, c.expected, names)
+		})
+	}
+}
+
+// TestLoadEnvironmentsOutsideRoot loads environments from a working directory
+// that is not the project root, which Metadata.Namespace is relative to
+func TestLoadEnvironmentsOutsideRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir("./testdata/cases"))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	everything, err := labels.Parse("!unset")
+	require.NoError(t, err)
+
+	for _, selector := range []labels.Selector{nil, everything} {
+		targets, err := FindTargets([]string{"withspecjson", "./withenv"}, TargetOpts{Selector: selector})
+		require.NoError(t, err)
+
+		loaded, err := loadEnvironments(targets, parallelOpts{})
+		require.NoError(t, err)
+
+		var names []string
+		for _, l := range loaded {
+			names = append(names, l.Env.Metadata.Name)
+		}
+		assert.ElementsMatch(t, []string{"cases/withspecjson", "withenv"}, names)
+	}
+
+	// failures are reported instead of dropping the environment
+	targets, err := FindTargets([]string{"withenv"}, TargetOpts{})
+	require.NoError(t, err)
+	targets[0].Path = "missing"
+	_, err = loadEnvironments(targets, parallelOpts{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,201 @@
+package tanka
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// PlanVersion is the version of the plan file format. Plans of other versions
+// are rejected.
+const PlanVersion = 1
+
+// Plan is a recorded set of changes to a cluster, that can be reviewed and
+// applied later using ApplyPlan. It contains everything needed to apply, so
+// Jsonnet is not evaluated again.
+type Plan struct {
+	Version int `json:"version"`
+
+	// Environment the plan was made for. Its data is omitted, Resources holds
+	// the processed objects instead
+	Environment *v1alpha1.Environment `json:"environment"`
+	// Cluster the plan was made against
+	Cluster PlanCluster `json:"cluster"`
+	// Resources to apply
+	Resources manifest.List `json:"resources"`
+	// ResourceVersions of the live objects the plan was diffed against, as
+	// returned by kubernetes.ResourceVersions
+	ResourceVersions map[string]string `json:"resourceVersions"`
+	// Diff of the plan at the time it was made. nil if there were no
+	// differences
+	Diff *string `json:"diff,omitempty"`
+}
+
+// PlanCluster identifies the cluster a plan was made against
+type PlanCluster struct {
+	Name    string `json:"name"`
+	Server  string `json:"server"`
+	Context string `json:"context"`
+}
+
+// PlanOpts specify additional properties for the MakePlan action
+type PlanOpts struct {
+	Opts
+
+	// DiffStrategy to use for the diff of the plan
+	DiffStrategy string
+}
+
+// ErrorPlanCluster occurs when applying a plan to a different cluster than the
+// one it was made against
+type ErrorPlanCluster struct {
+	Planned, Actual string
+}
+
+func (e ErrorPlanCluster) Error() string {
+	return fmt.Sprintf("plan was made against the cluster at '%s', but the environment now points to '%s'. Please create a new plan", e.Planned, e.Actual)
+}
+
+// ErrorPlanOutdated occurs when objects of a plan have changed in the cluster
+// since the plan was made
+type ErrorPlanOutdated struct {
+	Changed []string
+}
+
+func (e ErrorPlanOutdated) Error() string {
+	return fmt.Sprintf("the following objects changed in the cluster since the plan was made. Please create a new plan:\n - %s", strings.Join(e.Changed, "\n - "))
+}
+
+// MakePlan parses the environment at the given directory (a `baseDir`) and
+// records the changes applying it would make, along with the state of the
+// cluster they are based on.
+func MakePlan(baseDir string, opts PlanOpts) (*Plan, error) {
+	l, err := Load(baseDir, opts.Opts)
+	if err != nil {
+		return nil, err
+	}
+	kube, err := l.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer kube.Close()
+
+	// record versions before diffing: if anything changes in between, applying
+	// the plan fails instead of applying changes nobody reviewed
+	versions, err := kube.ResourceVersions(l.Resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "recording resourceVersions")
+	}
+
+	diff, err := kube.Diff(l.Resources, kubernetes.DiffOpts{
+		Strategy: opts.DiffStrategy,
+		Context:  util.DefaultDiffContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	env := *l.Env
+	env.Data = nil
+
+	info := kube.Info()
+	return &Plan{
+		Version:     PlanVersion,
+		Environment: &env,
+		Cluster: PlanCluster{
+			Name:    info.Kubeconfig.Cluster.Name,
+			Server:  info.Kubeconfig.Cluster.Cluster.Server,
+			Context: info.Kubeconfig.Context.Name,
+		},
+		Resources:        l.Resources,
+		ResourceVersions: versions,
+		Diff:             diff,
+	}, nil
+}
+
+// Save writes the plan to path. As plans may contain secrets, the file is
+// only readable by the current user.
+func (p *Plan) Save(path string) error {
+	out, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling plan")
+	}
+	return os.WriteFile(path, append(out, '\n'), 0600)
+}
+
+// LoadPlan reads a plan written by Plan.Save
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "parsing plan '%s'", path)
+	}
+	if p.Version != PlanVersion {
+		return nil, fmt.Errorf("plan '%s' has version %d, but this version of Tanka only supports version %d", path, p.Version, PlanVersion)
+	}
+	if p.Environment == nil {
+		return nil, fmt.Errorf("plan '%s' has no environment", path)
+	}
+
+	return &p, nil
+}
+
+// ApplyPlan applies the resources of a plan, without evaluating Jsonnet. It
+// refuses to do so if the environment now points to a different cluster, or
+// if any object changed in the cluster since the plan was made.
+func ApplyPlan(p *Plan, opts ApplyOpts) error {
+	l := &LoadResult{Env: p.Environment, Resources: p.Resources}
+
+	t, err := connectApply(l, opts)
+	if err != nil {
+		return err
+	}
+	defer t.kube.Close()
+
+	if server := t.kube.Info().Kubeconfig.Cluster.Cluster.Server; server != p.Cluster.Server {
+		return ErrorPlanCluster{Planned: p.Cluster.Server, Actual: server}
+	}
+
+	current, err := t.kube.ResourceVersions(p.Resources)
+	if err != nil {
+		return errors.Wrap(err, "checking resourceVersions")
+	}
+	if changed := changedVersions(p.ResourceVersions, current); len(changed) > 0 {
+		return ErrorPlanOutdated{Changed: changed}
+	}
+
+	return applyTargets([]applyTarget{t}, opts)
+}
+
+// changedVersions returns the sorted keys whose resourceVersion differs
+// between planned and current. Missing keys are the same as empty versions,
+// meaning the object does not exist.
+func changedVersions(planned, current map[string]string) []string {
+	var changed []string
+	for key, rv := range planned {
+		if current[key] != rv {
+			changed = append(changed, key)
+		}
+	}
+	for key, rv := range current {
+		if _, ok := planned[key]; !ok && rv != "" {
+			changed = append(changed, key)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
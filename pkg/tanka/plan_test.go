@@ -0,0 +1,67 @@
+package tanka
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+func TestChangedVersions(t *testing.T) {
+	planned := map[string]string{
+		"apps/Deployment/default/grafana": "42",
+		"ConfigMap/default/config":        "7",
+		"ConfigMap/default/new":           "",
+	}
+
+	assert.Empty(t, changedVersions(planned, map[string]string{
+		"apps/Deployment/default/grafana": "42",
+		"ConfigMap/default/config":        "7",
+		"ConfigMap/new":                   "",
+	}))
+
+	assert.Equal(t, []string{"ConfigMap/default/new", "apps/Deployment/default/grafana"}, changedVersions(planned, map[string]string{
+		"apps/Deployment/default/grafana": "43",
+		"ConfigMap/default/config":        "7",
+		"ConfigMap/default/new":           "1",
+	}))
+
+	assert.Equal(t, []string{"ConfigMap/default/config"}, changedVersions(planned, map[string]string{
+		"apps/Deployment/default/grafana": "42",
+	}))
+}
+
+func TestPlanSaveLoad(t *testing.T) {
+	diff := "diff"
+	env := v1alpha1.New()
+	env.Metadata.Labels["cluster"] = "dev"
+
+	p := &Plan{
+		Version:     PlanVersion,
+		Environment: env,
+		Cluster:     PlanCluster{Name: "dev", Server: "https://localhost", Context: "dev"},
+		Resources: manifest.List{{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "config"},
+		}},
+		ResourceVersions: map[string]string{"ConfigMap/default/config": "7"},
+		Diff:             &diff,
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.tkplan")
+	require.NoError(t, p.Save(path))
+
+	loaded, err := LoadPlan(path)
+	require.NoError(t, err)
+	assert.Equal(t, p, loaded)
+
+	p.Version = PlanVersion + 1
+	require.NoError(t, p.Save(path))
+	_, err = LoadPlan(path)
+	assert.Error(t, err)
+}
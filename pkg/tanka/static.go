@@ -56,18 +56,11 @@ func (s *StaticLoader) Eval(path string, opts LoaderOpts) (interface{}, error) {
 		return nil, err
 	}
 	opts.ExtCode.Set(environmentExtCode, envCode)
+	opts.Nix = nixOpts(opts.Nix, config)
 
-	raw, err := evalDetect(path, opts)
-	if err != nil {
-		return nil, err
-	}
-
-	var data interface{}
-	if err := json.Unmarshal([]byte(raw), &data); err != nil {
-		return nil, err
-	}
-
-	return data, nil
+	// static environments hold no inline environments to select by name
+	opts.Name = ""
+	return evalRaw(path, opts, Evaluator.Eval)
 }
 
 func specToExtCode(spec *v1alpha1.Environment) (string, error) {
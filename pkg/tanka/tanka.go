@@ -36,6 +36,11 @@ const DEFAULT_DEV_VERSION = "dev"
 // CURRENT_VERSION is the current version of the running Tanka code
 var CURRENT_VERSION = DEFAULT_DEV_VERSION
 
+func init() {
+	// never reuse evaluations cached by other versions
+	jsonnet.CacheVersion = CURRENT_VERSION
+}
+
 func checkVersion(constraint string) error {
 	if constraint == "" {
 		return nil
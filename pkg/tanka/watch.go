@@ -0,0 +1,256 @@
+package tanka
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/tanka/pkg/jsonnet"
+	"github.com/grafana/tanka/pkg/jsonnet/jpath"
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
+)
+
+// defaultDebounce is how long Watch waits for further changes by default
+const defaultDebounce = 100 * time.Millisecond
+
+// WatchOpts specify how Watch watches for changes
+type WatchOpts struct {
+	// Debounce is how long to wait for further changes before evaluating
+	// again, as editors often write multiple times when saving
+	Debounce time.Duration
+
+	// Stop ends watching once closed
+	Stop <-chan struct{}
+}
+
+// WatchChange is the difference between two evaluations of an environment
+type WatchChange struct {
+	Env *v1alpha1.Environment
+
+	// Changed objects, that are new or differ from the previous evaluation.
+	// On the first evaluation, these are all objects
+	Changed manifest.List
+	// Removed objects, that existed in the previous evaluation
+	Removed manifest.List
+
+	// Err is set if evaluating failed. The next evaluation is compared to the
+	// last successful one.
+	Err error
+}
+
+// Watch loads the environment at path and calls fn with the result. It does so
+// again whenever any file the environment depends on (see WatchFiles)
+// changes, passing only what changed compared to the previous evaluation. The
+// files are looked up after each change, to follow added or removed imports.
+// Watch returns once opts.Stop is closed, or if watching fails.
+func Watch(path string, opts Opts, wopts WatchOpts, fn func(WatchChange)) error {
+	if wopts.Debounce == 0 {
+		wopts.Debounce = defaultDebounce
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "watching files")
+	}
+	defer watcher.Close()
+
+	w := fileWatcher{watcher: watcher, dirs: make(map[string]bool)}
+
+	var (
+		prev   manifest.List
+		loaded bool
+		failed bool
+	)
+	load := func() {
+		// keep watching the previous files, if the new ones can't be found
+		// (e.g. because of a syntax error or an import of a missing file).
+		// Until then, any change in their directories may fix it.
+		if files, err := WatchFiles(path); err == nil {
+			w.set(files)
+		} else {
+			w.stale = true
+		}
+
+		l, err := Load(path, opts)
+		if err != nil {
+			failed = true
+			fn(WatchChange{Err: err})
+			return
+		}
+
+		changed, removed := changedObjects(prev, l.Resources)
+		// nothing changed, unless the last evaluation failed: that needs to be
+		// resolved for the user
+		if loaded && !failed && len(changed) == 0 && len(removed) == 0 {
+			return
+		}
+
+		prev, loaded, failed = l.Resources, true, false
+		fn(WatchChange{Env: l.Env, Changed: changed, Removed: removed})
+	}
+
+	load()
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-wopts.Stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op != fsnotify.Chmod && w.matches(event.Name) {
+				timer = time.After(wopts.Debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return errors.Wrap(err, "watching files")
+		case <-timer:
+			timer = nil
+			load()
+		}
+	}
+}
+
+// fileWatcher watches a set of files using the directories holding them
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+	dirs    map[string]bool
+
+	// stale is set if files could not be looked up, so that they may be
+	// missing some
+	stale bool
+}
+
+// set replaces the watched files
+func (w *fileWatcher) set(files []string) {
+	w.stale = false
+	w.files = make(map[string]bool, len(files))
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		w.files[f] = true
+		dirs[filepath.Dir(f)] = true
+	}
+
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			_ = w.watcher.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	for dir := range dirs {
+		if w.dirs[dir] {
+			continue
+		}
+		// directories that don't exist (anymore) can't be watched
+		if err := w.watcher.Add(dir); err == nil {
+			w.dirs[dir] = true
+		}
+	}
+}
+
+func (w *fileWatcher) matches(name string) bool {
+	// events are only received for the watched directories
+	if w.stale {
+		return true
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	return w.files[abs]
+}
+
+// WatchFiles returns the absolute paths of all files the environment at path
+// depends on: For Jsonnet, these are its transitive imports, plus the Helm
+// charts (chartfile.yaml and vendored charts) and Kustomizations next to them.
+// For other languages, these are all files in the directory of path.
+func WatchFiles(path string) ([]string, error) {
+	e, err := DetectEvaluator(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := e.(jsonnetEvaluator); !ok {
+		dir, err := jpath.FsDir(path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonnet.WalkFiles(dir)
+	}
+
+	root, err := jpath.FindRoot(path)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := jsonnet.TransitiveImports(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(imports))
+	for _, imp := range imports {
+		files = append(files, filepath.Join(root, filepath.FromSlash(imp)))
+	}
+
+	inputs, err := jsonnet.NativeInputs(root, files)
+	if err != nil {
+		return nil, err
+	}
+
+	files = append(files, inputs...)
+	sort.Strings(files)
+	return files, nil
+}
+
+// changedObjects returns the objects of next that are new or differ from
+// prev, and those of prev that are not in next anymore. Both keep the order of
+// their input.
+func changedObjects(prev, next manifest.List) (changed, removed manifest.List) {
+	before := make(map[string]manifest.Manifest, len(prev))
+	for _, m := range prev {
+		before[watchKey(m)] = m
+	}
+
+	seen := make(map[string]bool, len(next))
+	for _, m := range next {
+		key := watchKey(m)
+		seen[key] = true
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, m) {
+			changed = append(changed, m)
+		}
+	}
+
+	for _, m := range prev {
+		if !seen[watchKey(m)] {
+			removed = append(removed, m)
+		}
+	}
+	return changed, removed
+}
+
+func watchKey(m manifest.Manifest) string {
+	return m.APIVersion() + "/" + m.Kind() + "/" + m.Metadata().Namespace() + "/" + m.Metadata().Name()
+}
+
+// DiffChange diffs the changed objects of c against the cluster, like Diff.
+// Objects removed since the previous evaluation are not included, as they are
+// no longer part of the environment.
+func DiffChange(c WatchChange, opts DiffOpts) (*string, error) {
+	if len(c.Changed) == 0 {
+		return nil, nil
+	}
+
+	// only a subset of the objects is diffed, so pruning would report all
+	// others as deleted
+	opts.WithPrune = false
+	return diffLoaded(&LoadResult{Env: c.Env, Resources: c.Changed}, opts)
+}
@@ -0,0 +1,161 @@
+package tanka
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+)
+
+func TestChangedObjects(t *testing.T) {
+	cm := func(name, value string) manifest.Manifest {
+		return manifest.Manifest{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"data":       map[string]interface{}{"value": value},
+		}
+	}
+
+	prev := manifest.List{cm("a", "1"), cm("b", "1"), cm("c", "1")}
+	next := manifest.List{cm("a", "1"), cm("b", "2"), cm("d", "1")}
+
+	changed, removed := changedObjects(prev, next)
+	assert.Equal(t, manifest.List{cm("b", "2"), cm("d", "1")}, changed)
+	assert.Equal(t, manifest.List{cm("c", "1")}, removed)
+
+	changed, removed = changedObjects(nil, prev)
+	assert.Equal(t, prev, changed)
+	assert.Empty(t, removed)
+}
+
+// writeFiles creates files (relative path -> content) below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"jsonnetfile.json":                                  "{}",
+		"lib/lib.libsonnet":                                 "{}",
+		"vendor/dep/main.libsonnet":                         "{}",
+		"vendor/dep/kustomize/kustomization.yaml":           "",
+		"environments/default/main.jsonnet":                 "(import 'lib.libsonnet') + (import 'dep/main.libsonnet')",
+		"environments/default/unused.jsonnet":               "{}",
+		"environments/default/chartfile.yaml":               "version: 1\nrequires: []\n",
+		"environments/default/charts/foo/Chart.yaml":        "name: foo",
+		"environments/default/kustomize/kustomization.yaml": "resources: [cm.yaml]",
+		"environments/default/kustomize/cm.yaml":            "{}",
+	})
+
+	files, err := WatchFiles(filepath.Join(dir, "environments/default"))
+	require.NoError(t, err)
+
+	var rel []string
+	for _, f := range files {
+		r, err := filepath.Rel(dir, f)
+		require.NoError(t, err)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	assert.Equal(t, []string{
+		"environments/default/chartfile.yaml",
+		"environments/default/charts/foo/Chart.yaml",
+		"environments/default/kustomize/cm.yaml",
+		"environments/default/kustomize/kustomization.yaml",
+		"environments/default/main.jsonnet",
+		"lib/lib.libsonnet",
+		"vendor/dep/main.libsonnet",
+	}, rel)
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, "environments/default")
+	writeFiles(t, dir, map[string]string{
+		"jsonnetfile.json": "{}",
+		"environments/default/spec.json": `{
+  "apiVersion": "tanka.dev/v1alpha1",
+  "kind": "Environment",
+  "metadata": { "name": "default" },
+  "spec": { "namespace": "default" }
+}`,
+		"environments/default/main.jsonnet": `{
+  a: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'a' }, data: import 'a.libsonnet' },
+  b: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'b' } },
+}`,
+		"environments/default/a.libsonnet": "{ value: '1' }",
+		"environments/default/b.libsonnet": "{ value: '1' }",
+	})
+
+	changes := make(chan WatchChange)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- Watch(env, Opts{}, WatchOpts{Debounce: 10 * time.Millisecond, Stop: stop}, func(c WatchChange) {
+			changes <- c
+		})
+	}()
+
+	next := func() WatchChange {
+		select {
+		case c := <-changes:
+			require.NoError(t, c.Err)
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for change")
+			return WatchChange{}
+		}
+	}
+	names := func(list manifest.List) (out []string) {
+		for _, m := range list {
+			out = append(out, m.Metadata().Name())
+		}
+		return out
+	}
+
+	// everything on the first evaluation
+	assert.Equal(t, []string{"a", "b"}, names(next().Changed))
+
+	// only what changed afterwards
+	writeFiles(t, dir, map[string]string{"environments/default/a.libsonnet": "{ value: '2' }"})
+	assert.Equal(t, []string{"a"}, names(next().Changed))
+
+	// new imports are watched
+	writeFiles(t, dir, map[string]string{"environments/default/main.jsonnet": `{
+  a: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'a' }, data: import 'b.libsonnet' },
+}`})
+	c := next()
+	assert.Equal(t, []string{"a"}, names(c.Changed))
+	assert.Equal(t, []string{"b"}, names(c.Removed))
+
+	writeFiles(t, dir, map[string]string{"environments/default/b.libsonnet": "{ value: '3' }"})
+	c = next()
+	assert.Equal(t, "3", c.Changed[0]["data"].(map[string]interface{})["value"])
+
+	// importing a file that does not exist yet fails, until it is created
+	writeFiles(t, dir, map[string]string{"environments/default/main.jsonnet": `{
+  a: { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'a' }, data: import 'c.libsonnet' },
+}`})
+	select {
+	case c := <-changes:
+		assert.Error(t, c.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+	writeFiles(t, dir, map[string]string{"environments/default/c.libsonnet": "{ value: '4' }"})
+	c = next()
+	assert.Equal(t, "4", c.Changed[0]["data"].(map[string]interface{})["value"])
+
+	close(stop)
+	require.NoError(t, <-done)
+}
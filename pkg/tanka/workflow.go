@@ -3,12 +3,15 @@ package tanka
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/fatih/color"
 
 	"github.com/grafana/tanka/pkg/kubernetes"
 	"github.com/grafana/tanka/pkg/kubernetes/client"
 	"github.com/grafana/tanka/pkg/kubernetes/manifest"
+	"github.com/grafana/tanka/pkg/kubernetes/util"
+	"github.com/grafana/tanka/pkg/spec/v1alpha1"
 	"github.com/grafana/tanka/pkg/term"
 )
 
@@ -30,6 +33,16 @@ type ApplyOpts struct {
 	DryRun string
 	// ServerSide bool passed to kubectl as --server-side
 	ServerSide bool
+	// Wait for applied objects to become ready
+	Wait bool
+	// WaitTimeout is the maximum time to Wait for
+	WaitTimeout time.Duration
+	// Atomic rolls back all changes if the apply or the subsequent Wait
+	// fails. Implies Wait
+	Atomic bool
+	// Parallelism is the number of environments ApplyEnvironments evaluates at
+	// once
+	Parallelism int
 }
 
 // ErrorApplyStrategyUnknown occurs when an apply-strategy is requested that does
@@ -52,16 +65,95 @@ func Apply(baseDir string, opts ApplyOpts) error {
 		return err
 	}
 
+	return apply([]*LoadResult{l}, opts)
+}
+
+// applyTarget is an environment ready to be applied
+type applyTarget struct {
+	*LoadResult
+	kube *kubernetes.Kubernetes
+	opts ApplyOpts
+}
+
+// apply connects to the clusters of all environments and applies them
+func apply(loaded []*LoadResult, opts ApplyOpts) error {
+	var targets []applyTarget
+	defer func() {
+		for _, t := range targets {
+			t.kube.Close()
+		}
+	}()
+
+	for _, l := range loaded {
+		t, err := connectApply(l, opts)
+		if err != nil {
+			if len(loaded) > 1 {
+				return fmt.Errorf("%s: %w", l.Env.Metadata.Name, err)
+			}
+			return err
+		}
+		targets = append(targets, t)
+	}
+
+	return applyTargets(targets, opts)
+}
+
+// applyTargets shows the differences of all targets, asks for confirmation
+// once and then applies them in order
+func applyTargets(targets []applyTarget, opts ApplyOpts) error {
+	multi := len(targets) > 1
+	for _, t := range targets {
+		if multi {
+			fmt.Println(envHeader(t.Env))
+		}
+		t.showDiff()
+	}
+
+	// prompt for confirmation
+	if opts.AutoApprove || opts.DryRun != "" {
+	} else if !multi {
+		if err := confirmPrompt("Applying to", targets[0].Env.Spec.Namespace, targets[0].kube.Info()); err != nil {
+			return err
+		}
+	} else if err := confirmMultiPrompt("Applying to", targets); err != nil {
+		return err
+	}
+
+	for i, t := range targets {
+		if multi {
+			fmt.Println(envHeader(t.Env))
+		}
+		err := t.apply()
+		switch {
+		case err == nil:
+		case !multi:
+			return err
+		case i < len(targets)-1:
+			return fmt.Errorf("%s: %w\n\nThe remaining %d environment(s) were not applied", t.Env.Metadata.Name, err, len(targets)-1-i)
+		default:
+			return fmt.Errorf("%s: %w", t.Env.Metadata.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// connectApply resolves the strategies to apply l with and connects to its
+// cluster
+func connectApply(l *LoadResult, opts ApplyOpts) (applyTarget, error) {
 	// If the apply strategy was not set on the command-line, draw from spec or use default
 	if opts.ApplyStrategy == "" {
 		if l.Env.Spec.ApplyStrategy != "" {
 			opts.ApplyStrategy = l.Env.Spec.ApplyStrategy
+		} else if l.Env.Spec.Client == kubernetes.ClientClientGo {
+			// client-go only supports server-side apply
+			opts.ApplyStrategy = "server"
 		} else {
 			opts.ApplyStrategy = "client"
 		}
 	}
 	if opts.ApplyStrategy != "client" && opts.ApplyStrategy != "server" {
-		return ErrorApplyStrategyUnknown{Requested: opts.ApplyStrategy}
+		return applyTarget{}, ErrorApplyStrategyUnknown{Requested: opts.ApplyStrategy}
 	}
 
 	// Default to `server` diff in server apply mode
@@ -71,41 +163,80 @@ func Apply(baseDir string, opts ApplyOpts) error {
 
 	kube, err := l.Connect()
 	if err != nil {
-		return err
+		return applyTarget{}, err
 	}
-	defer kube.Close()
 
-	if opts.DiffStrategy != "none" {
-		// show diff
-		diff, err := kube.Diff(l.Resources, kubernetes.DiffOpts{Strategy: opts.DiffStrategy})
-		switch {
-		case err != nil:
-			// This is not fatal, the diff is not strictly required
-			log.Println("Error diffing:", err)
-		case diff == nil:
-			tmp := "Warning: There are no differences. Your apply may not do anything at all."
-			diff = &tmp
-		}
+	return applyTarget{LoadResult: l, kube: kube, opts: opts}, nil
+}
 
-		// in case of non-fatal error diff may be nil
-		if diff != nil {
-			b := term.Colordiff(*diff)
-			fmt.Print(b.String())
-		}
+// showDiff prints the changes applying t would make
+func (t applyTarget) showDiff() {
+	if t.opts.DiffStrategy == "none" {
+		return
 	}
 
-	// prompt for confirmation
-	if opts.AutoApprove || opts.DryRun != "" {
-	} else if err := confirmPrompt("Applying to", l.Env.Spec.Namespace, kube.Info()); err != nil {
-		return err
+	diff, err := t.kube.Diff(t.Resources, kubernetes.DiffOpts{
+		Strategy: t.opts.DiffStrategy,
+		Context:  util.DefaultDiffContext,
+	})
+	switch {
+	case err != nil:
+		// This is not fatal, the diff is not strictly required
+		log.Println("Error diffing:", err)
+	case diff == nil:
+		tmp := "Warning: There are no differences. Your apply may not do anything at all."
+		diff = &tmp
 	}
 
-	return kube.Apply(l.Resources, kubernetes.ApplyOpts{
+	// in case of non-fatal error diff may be nil
+	if diff != nil {
+		b := term.Colordiff(*diff)
+		fmt.Print(b.String())
+	}
+}
+
+// apply applies t, waits for it and rolls back on failure, as requested by
+// its options
+func (t applyTarget) apply() error {
+	opts := t.opts
+
+	// record the current state, so it can be restored on failure
+	var snapshot *kubernetes.Snapshot
+	if opts.Atomic && opts.DryRun == "" {
+		var err error
+		snapshot, err = t.kube.Snapshot(t.Resources)
+		if err != nil {
+			return err
+		}
+	}
+
+	applyOpts := kubernetes.ApplyOpts{
 		Force:         opts.Force,
 		Validate:      opts.Validate,
 		DryRun:        opts.DryRun,
 		ApplyStrategy: opts.ApplyStrategy,
-	})
+	}
+
+	err := t.kube.Apply(t.Resources, applyOpts)
+	// nothing changed in dry-run mode, so there is nothing to wait for
+	if err == nil && (opts.Wait || opts.Atomic) && opts.DryRun == "" {
+		err = t.kube.Wait(t.Resources, kubernetes.WaitOpts{Timeout: opts.WaitTimeout})
+	}
+
+	if err == nil || snapshot == nil {
+		return err
+	}
+
+	if rbErr := t.kube.Rollback(snapshot, applyOpts); rbErr != nil {
+		return fmt.Errorf("%s\n\nRollback failed as well: %s", err, rbErr)
+	}
+	return fmt.Errorf("%s\n\nAll changes have been rolled back", err)
+}
+
+// envHeader introduces the output belonging to env when operating on multiple
+// environments
+func envHeader(env *v1alpha1.Environment) string {
+	return color.New(color.Bold).Sprintf("# Environment %s", env.Metadata.Name)
 }
 
 // confirmPrompt asks the user for confirmation before apply
@@ -123,11 +254,31 @@ func confirmPrompt(action, namespace string, info client.Info) error {
 	)
 }
 
+// confirmMultiPrompt asks the user for confirmation before applying multiple
+// environments at once, listing every target
+func confirmMultiPrompt(action string, targets []applyTarget) error {
+	alert := color.New(color.FgRed, color.Bold).SprintFunc()
+
+	msg := fmt.Sprintf("%s %d environments:", action, len(targets))
+	for _, t := range targets {
+		info := t.kube.Info()
+		msg += fmt.Sprintf("\n - %s: namespace '%s' of cluster '%s' at '%s' using context '%s'",
+			t.Env.Metadata.Name,
+			alert(t.Env.Spec.Namespace),
+			alert(info.Kubeconfig.Cluster.Name),
+			alert(info.Kubeconfig.Cluster.Cluster.Server),
+			alert(info.Kubeconfig.Context.Name),
+		)
+	}
+
+	return term.Confirm(msg, "yes")
+}
+
 // DiffOpts specify additional properties for the Diff action
 type DiffOpts struct {
 	Opts
 
-	// Strategy must be one of "native", "validate", "subset" or "server"
+	// Strategy must be one of "native", "validate", "subset", "server" or "semantic"
 	Strategy string
 	// Summarize prints a summary, instead of the actual diff
 	Summarize bool
@@ -135,19 +286,30 @@ type DiffOpts struct {
 	WithPrune bool
 	// Exit with 0 even when differences are found
 	ExitZero bool
+	// Context is the number of unchanged lines shown around each change. If 0,
+	// util.DefaultDiffContext is used. Use util.NoDiffContext to show none
+	Context int
+	// Parallelism is the number of environments DiffEnvironments processes at
+	// once
+	Parallelism int
 }
 
 // Diff parses the environment at the given directory (a `baseDir`) and returns
-// the differences from the live cluster state in `diff(1)` format. If the
-// `WithDiffSummarize` modifier is used, a histogram created using `diffstat(1)`
-// is returned instead.
+// the differences from the live cluster state as a unified diff, computed
+// in-process. If opts.Summarize is set, a histogram of the changes (see
+// util.Diffstat) is returned instead.
 // The cluster information is retrieved from the environments `spec.json`.
-// NOTE: This function requires on `diff(1)`, `kubectl(1)` and perhaps `diffstat(1)`
+// NOTE: This function requires `kubectl(1)`
 func Diff(baseDir string, opts DiffOpts) (*string, error) {
 	l, err := Load(baseDir, opts.Opts)
 	if err != nil {
 		return nil, err
 	}
+
+	return diffLoaded(l, opts)
+}
+
+func diffLoaded(l *LoadResult, opts DiffOpts) (*string, error) {
 	kube, err := l.Connect()
 	if err != nil {
 		return nil, err
@@ -158,6 +320,27 @@ func Diff(baseDir string, opts DiffOpts) (*string, error) {
 		Summarize: opts.Summarize,
 		Strategy:  opts.Strategy,
 		WithPrune: opts.WithPrune,
+		Context:   opts.Context,
+	})
+}
+
+// DiffStructured parses the environment at the given directory (a `baseDir`)
+// and returns the differences to the live cluster as one record per object,
+// suitable for machine consumption.
+func DiffStructured(baseDir string, opts DiffOpts) ([]kubernetes.ObjectDiff, error) {
+	l, err := Load(baseDir, opts.Opts)
+	if err != nil {
+		return nil, err
+	}
+	kube, err := l.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer kube.Close()
+
+	return kube.DiffStructured(l.Resources, kubernetes.DiffOpts{
+		Strategy:  opts.Strategy,
+		WithPrune: opts.WithPrune,
 	})
 }
 
@@ -0,0 +1,64 @@
+package tanka
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tanka/pkg/kubernetes"
+)
+
+// fakeKubectl is a kubectl that knows a single cluster at
+// https://localhost:6443, enough to connect to it
+const fakeKubectl = `#!/bin/sh
+case "$1" in
+config)
+  echo '{"clusters": [{"name": "local", "cluster": {"server": "https://localhost:6443"}}],
+         "contexts": [{"name": "local", "context": {"cluster": "local", "user": "local"}}]}' ;;
+version)
+  echo '{"clientVersion": {"gitVersion": "v1.29.0"}, "serverVersion": {"gitVersion": "v1.29.0"}}' ;;
+*)
+  echo "unexpected call: $*" >&2; exit 1 ;;
+esac
+`
+
+func TestDiffStructuredStrategy(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"jsonnetfile.json": "{}",
+		"kubectl":          fakeKubectl,
+		"environments/default/spec.json": `{
+  "apiVersion": "tanka.dev/v1alpha1",
+  "kind": "Environment",
+  "metadata": { "name": "default" },
+  "spec": { "apiServer": "https://localhost:6443", "namespace": "default", "diffStrategy": "unknown-env" }
+}`,
+		"environments/default/main.jsonnet": "{}",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(dir, "kubectl"), 0755))
+	t.Setenv("TANKA_KUBECTL_PATH", filepath.Join(dir, "kubectl"))
+	env := filepath.Join(dir, "environments/default")
+
+	cases := []struct {
+		name     string
+		strategy string
+		want     string
+	}{
+		{name: "from spec", want: "unknown-env"},
+		{name: "from opts", strategy: "unknown-opts", want: "unknown-opts"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := DiffStructured(env, DiffOpts{Strategy: c.strategy})
+
+			var unknown kubernetes.ErrorDiffStrategyUnknown
+			require.True(t, errors.As(err, &unknown), "unexpected error: %v", err)
+			assert.Equal(t, c.want, unknown.Requested)
+		})
+	}
+}